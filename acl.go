@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// apiKey is a credential which can only trigger the custom builds of
+// some repos and contexts, eg. for the CI of another project
+type apiKey struct {
+	// the basic auth user
+	Name string `json:"name"`
+	Pass string `json:"pass"`
+	// repos and contexts the key can build, path.Match patterns or
+	// prefixes ending with a slash, eg. "mantidproject/", all if empty
+	Repos    []string `json:"repos"`
+	Contexts []string `json:"contexts"`
+}
+
+// allows reports whether the key can build the context of the repo
+func (k apiKey) allows(repo, context string) bool {
+	return (len(k.Repos) == 0 || matchesAny(repo, k.Repos)) &&
+		(len(k.Contexts) == 0 || matchesAny(context, k.Contexts))
+}
+
+// allowsDownstream reports whether the key can also build the downstream
+// builds the build of context schedules, and theirs
+func (c Config) allowsDownstream(k apiKey, repo, context string) bool {
+	seen := map[string]bool{}
+	pending := []string{context}
+	for len(pending) > 0 {
+		build, err := c.getBuildByContextAndRepo(pending[0], repo)
+		pending = pending[1:]
+		if err != nil {
+			// an unknown build fails when it is scheduled
+			continue
+		}
+		for _, downstream := range build.DownstreamBuilds {
+			if seen[downstream] {
+				continue
+			}
+			seen[downstream] = true
+			if !k.allows(repo, downstream) {
+				return false
+			}
+			pending = append(pending, downstream)
+		}
+	}
+	return true
+}
+
+// principal returns who sent the request, the configured user or one of
+// the api_keys along with the key, or false if neither matches
+func principal(r *http.Request) (string, *apiKey, bool) {
+	if isAuthorized(r) {
+		return config.User, nil, true
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return "", nil, false
+	}
+	for i, key := range config.APIKeys {
+		if key.Name == user && key.Pass == pass {
+			return key.Name, &config.APIKeys[i], true
+		}
+	}
+	return "", nil, false
+}
+
+// auditEntry records who requested a build
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal"`
+	Remote    string    `json:"remote"`
+	Action    string    `json:"action"`
+	Repo      string    `json:"repo"`
+	Context   string    `json:"context"`
+	PR        int       `json:"pr,omitempty"`
+	Sha       string    `json:"sha,omitempty"`
+	Branch    string    `json:"branch,omitempty"`
+	Allowed   bool      `json:"allowed"`
+}
+
+// auditMu serializes the writes of the audit log
+var auditMu sync.Mutex
+
+// recordAudit logs the entry, and appends it to the audit_log file as a
+// line of JSON if one is configured
+func recordAudit(e auditEntry) {
+	e.Time = time.Now().UTC()
+	log.WithFields(log.Fields{
+		"principal": e.Principal,
+		"remote":    e.Remote,
+		"repo":      e.Repo,
+		"context":   e.Context,
+		"pr":        e.PR,
+		"sha":       e.Sha,
+		"branch":    e.Branch,
+		"allowed":   e.Allowed,
+	}).Infof("audit: %s", e.Action)
+
+	if config.AuditLog == "" {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("encoding audit entry failed: %v", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(config.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Errorf("opening the audit log failed: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		log.Errorf("writing the audit log failed: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyAllows(t *testing.T) {
+	key := apiKey{
+		Repos:    []string{"mantidproject/", "other/repo"},
+		Contexts: []string{"linux-*", "docs"},
+	}
+	for _, tt := range []struct {
+		repo, context string
+		want          bool
+	}{
+		{"mantidproject/mantid", "linux-gcc", true},
+		{"mantidproject/mantid", "docs", true},
+		{"other/repo", "docs", true},
+		{"other/repo2", "docs", false},
+		{"mantidproject/mantid", "windows", false},
+		{"mantidproject/mantid", "", false},
+	} {
+		if got := key.allows(tt.repo, tt.context); got != tt.want {
+			t.Errorf("allows(%q, %q) = %t, want %t", tt.repo, tt.context, got, tt.want)
+		}
+	}
+
+	if !(apiKey{}).allows("any/repo", "any") {
+		t.Error("a key without patterns does not allow everything")
+	}
+}
+
+func TestAllowsDownstream(t *testing.T) {
+	c := Config{Builds: []Build{
+		{Repo: "mantidproject/mantid", Context: "linux", DownstreamBuilds: []string{"docs"}},
+		{Repo: "mantidproject/mantid", Context: "docs", DownstreamBuilds: []string{"deploy", "linux"}},
+		{Repo: "mantidproject/mantid", Context: "deploy"},
+	}}
+
+	key := apiKey{Contexts: []string{"linux", "docs"}}
+	if c.allowsDownstream(key, "mantidproject/mantid", "linux") {
+		t.Error("allowed the downstream build of a downstream build outside the key")
+	}
+
+	key.Contexts = append(key.Contexts, "deploy")
+	if !c.allowsDownstream(key, "mantidproject/mantid", "linux") {
+		t.Error("refused downstream builds the key allows")
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	setup(t, Config{
+		User:    "admin",
+		Pass:    "secret",
+		APIKeys: []apiKey{{Name: "ci", Pass: "key"}},
+	})
+
+	for _, tt := range []struct {
+		user, pass string
+		name       string
+		key        bool
+		ok         bool
+	}{
+		{"admin", "secret", "admin", false, true},
+		{"ci", "key", "ci", true, true},
+		{"ci", "secret", "", false, false},
+		{"admin", "key", "", false, false},
+		{"nobody", "", "", false, false},
+	} {
+		r := httptest.NewRequest("POST", "/build/custom", nil)
+		r.SetBasicAuth(tt.user, tt.pass)
+		name, key, ok := principal(r)
+		if name != tt.name || (key != nil) != tt.key || ok != tt.ok {
+			t.Errorf("principal(%s:%s) = %q, %v, %t, want %q, key %t, %t", tt.user, tt.pass, name, key, ok, tt.name, tt.key, tt.ok)
+		}
+	}
+
+	if _, _, ok := principal(httptest.NewRequest("POST", "/build/custom", nil)); ok {
+		t.Error("authorized a request without credentials")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how often GitHub's hook ranges are read again from the meta API
+const githubMetaRefresh = time.Hour
+
+// allowlistConfig restricts the notification endpoints to CIDR ranges
+type allowlistConfig struct {
+	GitHub []string `json:"github"`
+	// also allow the ranges GitHub publishes for webhooks
+	GitHubMeta bool     `json:"github_meta"`
+	Jenkins    []string `json:"jenkins"`
+	// read the client address from X-Forwarded-For, only when leeroy is
+	// behind a proxy setting it
+	TrustProxy bool `json:"trust_proxy"`
+}
+
+// ipAllowlist holds the configured ranges of an endpoint and the ones
+// refreshed periodically
+type ipAllowlist struct {
+	mu      sync.RWMutex
+	static  []*net.IPNet
+	dynamic []*net.IPNet
+}
+
+func (a *ipAllowlist) allows(ip net.IP) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, nets := range [][]*net.IPNet{a.static, a.dynamic} {
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *ipAllowlist) setDynamic(nets []*net.IPNet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.dynamic = nets
+}
+
+// allowlists of the endpoints which have one
+var allowlists = map[string]*ipAllowlist{}
+
+func parseCIDRs(cidrs []string) (nets []*net.IPNet, err error) {
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist range %q: %v", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func init() {
+	registerPlugin("allowlist", func(c Config) bool {
+		a := c.Allowlist
+		return len(a.GitHub) > 0 || a.GitHubMeta || len(a.Jenkins) > 0
+	}, setupAllowlists)
+}
+
+func setupAllowlists(c Config) error {
+	for name, cidrs := range map[string][]string{
+		"github":  c.Allowlist.GitHub,
+		"jenkins": c.Allowlist.Jenkins,
+	} {
+		if len(cidrs) == 0 && !(name == "github" && c.Allowlist.GitHubMeta) {
+			continue
+		}
+		nets, err := parseCIDRs(cidrs)
+		if err != nil {
+			return err
+		}
+		allowlists[name] = &ipAllowlist{static: nets}
+	}
+
+	if c.Allowlist.GitHubMeta {
+		// every instance refreshes its own ranges
+		refreshGitHubRanges(c)
+		go func() {
+			for range time.Tick(githubMetaRefresh) {
+				refreshGitHubRanges(c)
+			}
+		}()
+	}
+	return nil
+}
+
+func refreshGitHubRanges(c Config) {
+	cidrs, err := c.githubClient().HookRanges()
+	if err != nil {
+		log.Errorf("Refreshing GitHub's hook ranges failed, keeping the previous ones: %v", err)
+		return
+	}
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	allowlists["github"].setDynamic(nets)
+	log.Debugf("Allowing GitHub hooks from %s", strings.Join(cidrs, ", "))
+}
+
+// clientIP returns the address of the client of a request
+func clientIP(r *http.Request, trustProxy bool) net.IP {
+	if trustProxy {
+		// the proxy appends the address it received the request from
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			return net.ParseIP(strings.TrimSpace(parts[len(parts)-1]))
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// allowIPs rejects the requests to an endpoint from outside its allowlist,
+// endpoints without an allowlist accept every request
+func allowIPs(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a, ok := allowlists[name]
+		if !ok {
+			h(w, r)
+			return
+		}
+
+		ip := clientIP(r, config.Allowlist.TrustProxy)
+		if ip == nil || !a.allows(ip) {
+			writeError(w, 403, errForbidden, fmt.Errorf("Rejected %s notification from %s outside the allowlist", name, r.RemoteAddr))
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAllowlist(t *testing.T) {
+	static, err := parseCIDRs([]string{"192.30.252.0/22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamic, err := parseCIDRs([]string{"2a0a:a440::/29"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &ipAllowlist{static: static}
+	a.setDynamic(dynamic)
+
+	for ip, want := range map[string]bool{
+		"192.30.252.1":   true,
+		"192.30.255.255": true,
+		"192.30.256.1":   false,
+		"10.0.0.1":       false,
+		"2a0a:a440::1":   true,
+		"2001:db8::1":    false,
+	} {
+		if got := a.allows(net.ParseIP(ip)); got != want {
+			t.Errorf("allows(%s) = %t, want %t", ip, got, want)
+		}
+	}
+}
+
+func TestParseCIDRsInvalid(t *testing.T) {
+	if _, err := parseCIDRs([]string{"192.30.252.1"}); err == nil {
+		t.Error("got no error for an address without a mask")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/notification/github", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 192.30.252.1")
+
+	if got := clientIP(r, false); !got.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("got %v without trusting the proxy, want the remote address", got)
+	}
+	// only the address the proxy appended can be trusted
+	if got := clientIP(r, true); !got.Equal(net.ParseIP("192.30.252.1")) {
+		t.Errorf("got %v trusting the proxy, want the last forwarded address", got)
+	}
+}
+
+func TestAllowIPs(t *testing.T) {
+	setup(t, Config{})
+	nets, _ := parseCIDRs([]string{"192.30.252.0/22"})
+	allowlists["test"] = &ipAllowlist{static: nets}
+	t.Cleanup(func() { delete(allowlists, "test") })
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(204) }
+	for remote, want := range map[string]int{
+		"192.30.252.1:1234": 204,
+		"10.0.0.1:1234":     403,
+	} {
+		r := httptest.NewRequest("POST", "/notification/github", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		allowIPs("test", ok)(w, r)
+		if w.Code != want {
+			t.Errorf("got %d from %s, want %d", w.Code, remote, want)
+		}
+	}
+
+	// the endpoints without an allowlist accept everything
+	r := httptest.NewRequest("POST", "/notification/jenkins", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	allowIPs("none", ok)(w, r)
+	if w.Code != 204 {
+		t.Errorf("got %d without an allowlist, want 204", w.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import "time"
+
+// TriggerRequest schedules a build, one of Number, Sha or Branch is set
+type TriggerRequest struct {
+	Repo    string
+	Context string
+	Number  int
+	Sha     string
+	Branch  string
+	Profile string
+}
+
+func (m *TriggerRequest) unmarshal(b []byte) error {
+	fields, err := decodeFields(b)
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			m.Repo = f.string()
+		case 2:
+			m.Context = f.string()
+		case 3:
+			m.Number = f.int()
+		case 4:
+			m.Sha = f.string()
+		case 5:
+			m.Branch = f.string()
+		case 6:
+			m.Profile = f.string()
+		}
+	}
+	return err
+}
+
+// CancelRequest stops the builds of a pull request, of all its contexts
+// when Context is empty
+type CancelRequest struct {
+	Repo    string
+	Number  int
+	Context string
+	Sha     string
+}
+
+func (m *CancelRequest) unmarshal(b []byte) error {
+	fields, err := decodeFields(b)
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			m.Repo = f.string()
+		case 2:
+			m.Number = f.int()
+		case 3:
+			m.Context = f.string()
+		case 4:
+			m.Sha = f.string()
+		}
+	}
+	return err
+}
+
+// StatusRequest asks for the builds of a pull request
+type StatusRequest struct {
+	Repo   string
+	Number int
+}
+
+func (m *StatusRequest) unmarshal(b []byte) error {
+	fields, err := decodeFields(b)
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			m.Repo = f.string()
+		case 2:
+			m.Number = f.int()
+		}
+	}
+	return err
+}
+
+// BuildRecord is the last known state of a build
+type BuildRecord struct {
+	Repo        string
+	PR          int
+	Sha         string
+	Context     string
+	Job         string
+	State       string
+	Description string
+	URL         string
+	Scheduled   time.Time
+	Updated     time.Time
+}
+
+func (m BuildRecord) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Repo)
+	b = appendInt(b, 2, m.PR)
+	b = appendString(b, 3, m.Sha)
+	b = appendString(b, 4, m.Context)
+	b = appendString(b, 5, m.Job)
+	b = appendString(b, 6, m.State)
+	b = appendString(b, 7, m.Description)
+	b = appendString(b, 8, m.URL)
+	b = appendTime(b, 9, m.Scheduled)
+	return appendTime(b, 10, m.Updated)
+}
+
+// StatusResponse holds the builds of a pull request
+type StatusResponse struct {
+	Builds []BuildRecord
+}
+
+func (m StatusResponse) marshal() []byte {
+	var b []byte
+	for _, build := range m.Builds {
+		b = appendMessage(b, 1, build.marshal())
+	}
+	return b
+}
+
+// EventsRequest filters the streamed events, all of them are sent when
+// it is empty
+type EventsRequest struct {
+	Types []string
+	Repos []string
+}
+
+func (m *EventsRequest) unmarshal(b []byte) error {
+	fields, err := decodeFields(b)
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			m.Types = append(m.Types, f.string())
+		case 2:
+			m.Repos = append(m.Repos, f.string())
+		}
+	}
+	return err
+}
+
+// Event is a published event
+type Event struct {
+	Type        string
+	Time        time.Time
+	Repo        string
+	PR          int
+	Sha         string
+	Context     string
+	Job         string
+	State       string
+	Description string
+	URL         string
+}
+
+func (m Event) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Type)
+	b = appendTime(b, 2, m.Time)
+	b = appendString(b, 3, m.Repo)
+	b = appendInt(b, 4, m.PR)
+	b = appendString(b, 5, m.Sha)
+	b = appendString(b, 6, m.Context)
+	b = appendString(b, 7, m.Job)
+	b = appendString(b, 8, m.State)
+	b = appendString(b, 9, m.Description)
+	return appendString(b, 10, m.URL)
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Code is a gRPC status code
+type Code int
+
+// the gRPC status codes the server answers with
+const (
+	OK                 Code = 0
+	InvalidArgument    Code = 3
+	NotFound           Code = 5
+	PermissionDenied   Code = 7
+	FailedPrecondition Code = 9
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	Unauthenticated    Code = 16
+)
+
+// Error is a failed call, reported to the client with its code
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an Error with code and a formatted message
+func Errorf(code Code, format string, args ...interface{}) error {
+	return Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// HTTPCode returns the code matching the status of a REST endpoint
+func HTTPCode(status int) Code {
+	switch {
+	case status < 400:
+		return OK
+	case status == 400:
+		return InvalidArgument
+	case status == 401:
+		return Unauthenticated
+	case status == 403:
+		return PermissionDenied
+	case status == 404:
+		return NotFound
+	case status == 405:
+		return Unimplemented
+	case status == 409:
+		return FailedPrecondition
+	case status == 502 || status == 503:
+		return Unavailable
+	}
+	return Internal
+}
+
+// Backend runs the calls of the Admin service. r is the gRPC request,
+// its headers carry the metadata of the call like the authorization.
+type Backend interface {
+	Trigger(r *http.Request, req TriggerRequest) error
+	Cancel(r *http.Request, req CancelRequest) error
+	Status(r *http.Request, req StatusRequest) (StatusResponse, error)
+	// Events sends the events until the call is cancelled or send fails
+	Events(r *http.Request, req EventsRequest, send func(Event) error) error
+}
+
+// Prefix is the path of the calls of the Admin service
+const Prefix = "/leeroy.Admin/"
+
+// IsGRPC returns whether r is a gRPC call rather than a REST request
+func IsGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// Handler serves the Admin service with b. gRPC needs HTTP/2, which the
+// http server only negotiates over TLS.
+func Handler(b Backend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || !IsGRPC(r) {
+			http.Error(w, "only gRPC calls over HTTP/2 are served", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(200)
+
+		writeStatus(w, serve(w, r, b))
+	})
+}
+
+// serve runs the call of r and writes its responses
+func serve(w http.ResponseWriter, r *http.Request, b Backend) error {
+	msg, err := readFrame(r.Body)
+	if err == io.EOF {
+		return Errorf(InvalidArgument, "missing request message")
+	}
+	if err == errCompressed {
+		return Errorf(Unimplemented, "%v", err)
+	}
+	if err != nil {
+		return Errorf(InvalidArgument, "reading the request failed: %v", err)
+	}
+
+	switch method := strings.TrimPrefix(r.URL.Path, Prefix); method {
+	case "Trigger":
+		var req TriggerRequest
+		if err := req.unmarshal(msg); err != nil {
+			return Errorf(InvalidArgument, "decoding the request failed: %v", err)
+		}
+		if err := b.Trigger(r, req); err != nil {
+			return err
+		}
+		return writeFrame(w, nil)
+	case "Cancel":
+		var req CancelRequest
+		if err := req.unmarshal(msg); err != nil {
+			return Errorf(InvalidArgument, "decoding the request failed: %v", err)
+		}
+		if err := b.Cancel(r, req); err != nil {
+			return err
+		}
+		return writeFrame(w, nil)
+	case "Status":
+		var req StatusRequest
+		if err := req.unmarshal(msg); err != nil {
+			return Errorf(InvalidArgument, "decoding the request failed: %v", err)
+		}
+		resp, err := b.Status(r, req)
+		if err != nil {
+			return err
+		}
+		return writeFrame(w, resp.marshal())
+	case "Events":
+		var req EventsRequest
+		if err := req.unmarshal(msg); err != nil {
+			return Errorf(InvalidArgument, "decoding the request failed: %v", err)
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return Errorf(Internal, "streaming is not supported")
+		}
+		flusher.Flush()
+		return b.Events(r, req, func(e Event) error {
+			if err := writeFrame(w, e.marshal()); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		})
+	default:
+		return Errorf(Unimplemented, "unknown method %q", method)
+	}
+}
+
+// writeStatus sets the trailers reporting the outcome of a call
+func writeStatus(w http.ResponseWriter, err error) {
+	code, message := OK, ""
+	if err != nil {
+		code, message = Internal, err.Error()
+		if e, ok := err.(Error); ok {
+			code = e.Code
+		}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		w.Header().Set("Grpc-Message", encodeMessage(message))
+	}
+}
+
+// encodeMessage percent encodes a grpc-message as the protocol requires
+func encodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeBackend records the calls and answers them with err
+type fakeBackend struct {
+	trigger TriggerRequest
+	events  []Event
+	err     error
+}
+
+func (b *fakeBackend) Trigger(r *http.Request, req TriggerRequest) error {
+	b.trigger = req
+	return b.err
+}
+
+func (b *fakeBackend) Cancel(r *http.Request, req CancelRequest) error {
+	return b.err
+}
+
+func (b *fakeBackend) Status(r *http.Request, req StatusRequest) (StatusResponse, error) {
+	return StatusResponse{Builds: []BuildRecord{{Repo: req.Repo, PR: req.Number}}}, b.err
+}
+
+func (b *fakeBackend) Events(r *http.Request, req EventsRequest, send func(Event) error) error {
+	for _, e := range b.events {
+		if err := send(e); err != nil {
+			return err
+		}
+	}
+	return b.err
+}
+
+// call sends a gRPC call of method with the framed msg to b
+func call(b Backend, method string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", Prefix+method, bytes.NewReader(body))
+	r.ProtoMajor, r.ProtoMinor = 2, 0
+	r.Header.Set("Content-Type", "application/grpc")
+
+	w := httptest.NewRecorder()
+	Handler(b).ServeHTTP(w, r)
+	return w
+}
+
+func frame(t *testing.T, msg []byte) []byte {
+	var buf bytes.Buffer
+	if err := writeFrame(&buf, msg); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func status(w *httptest.ResponseRecorder) (string, string) {
+	trailer := w.Result().Trailer
+	return trailer.Get("Grpc-Status"), trailer.Get("Grpc-Message")
+}
+
+func TestHandlerTrigger(t *testing.T) {
+	b := &fakeBackend{}
+	w := call(b, "Trigger", frame(t, appendString(nil, 1, "mantidproject/mantid")))
+
+	if code, msg := status(w); code != "0" {
+		t.Fatalf("got status %s %q, want 0", code, msg)
+	}
+	if b.trigger.Repo != "mantidproject/mantid" {
+		t.Errorf("got %+v, want the repo to be decoded", b.trigger)
+	}
+	msg, err := readFrame(w.Body)
+	if err != nil || len(msg) != 0 {
+		t.Errorf("got %q, %v, want an empty response", msg, err)
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	req := appendInt(appendString(nil, 1, "mantidproject/mantid"), 2, 42)
+	w := call(&fakeBackend{}, "Status", frame(t, req))
+
+	if code, msg := status(w); code != "0" {
+		t.Fatalf("got status %s %q, want 0", code, msg)
+	}
+	msg, err := readFrame(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := StatusResponse{Builds: []BuildRecord{{Repo: "mantidproject/mantid", PR: 42}}}.marshal()
+	if !bytes.Equal(msg, want) {
+		t.Errorf("got %x, want %x", msg, want)
+	}
+}
+
+func TestHandlerEvents(t *testing.T) {
+	b := &fakeBackend{events: []Event{{Type: "build_started"}, {Type: "build_completed"}}}
+	w := call(b, "Events", frame(t, nil))
+
+	if code, msg := status(w); code != "0" {
+		t.Fatalf("got status %s %q, want 0", code, msg)
+	}
+	for _, e := range b.events {
+		msg, err := readFrame(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(msg, e.marshal()) {
+			t.Errorf("got %x, want %x", msg, e.marshal())
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		method string
+		body   []byte
+		err    error
+		code   string
+	}{
+		{"missing message", "Trigger", nil, nil, "3"},
+		{"truncated frame", "Trigger", []byte{0, 0, 0, 0, 9, 'a'}, nil, "3"},
+		{"compressed", "Trigger", []byte{1, 0, 0, 0, 0}, nil, "12"},
+		{"malformed message", "Trigger", frame(t, []byte{0x0a, 0x05}), nil, "3"},
+		{"unknown method", "Rebuild", frame(t, nil), nil, "12"},
+		{"backend error", "Cancel", frame(t, nil), Errorf(PermissionDenied, "denied"), "7"},
+		{"internal error", "Cancel", frame(t, nil), errors.New("broken"), "13"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call(&fakeBackend{err: tt.err}, tt.method, tt.body)
+			if code, msg := status(w); code != tt.code {
+				t.Errorf("got status %s %q, want %s", code, msg, tt.code)
+			}
+		})
+	}
+}
+
+func TestHandlerRejectsREST(t *testing.T) {
+	r := httptest.NewRequest("POST", Prefix+"Trigger", nil)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	Handler(&fakeBackend{}).ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("got %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	if got, want := encodeMessage("100% done\n"), "100%25 done%0A"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHTTPCode(t *testing.T) {
+	for status, want := range map[int]Code{
+		200: OK,
+		400: InvalidArgument,
+		401: Unauthenticated,
+		403: PermissionDenied,
+		404: NotFound,
+		409: FailedPrecondition,
+		418: Internal,
+		500: Internal,
+		503: Unavailable,
+	} {
+		if got := HTTPCode(status); got != want {
+			t.Errorf("HTTPCode(%d) = %d, want %d", status, got, want)
+		}
+	}
+}
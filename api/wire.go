@@ -0,0 +1,160 @@
+// Package api serves the admin API of api/leeroy.proto over gRPC. The
+// messages are few and flat, so they are encoded by hand rather than with
+// the generated code and the protobuf runtime.
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// largest message accepted from a client
+const maxMessageSize = 4 << 20
+
+var (
+	errTruncated  = errors.New("truncated message")
+	errCompressed = errors.New("compressed messages are not supported")
+)
+
+func appendTag(b []byte, num, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wire))
+}
+
+func appendString(b []byte, num int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendInt(b []byte, num int, v int) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, num, wireVarint)
+	// int32 fields are sign extended to 64 bits
+	return binary.AppendUvarint(b, uint64(int64(v)))
+}
+
+func appendMessage(b []byte, num int, m []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(m)))
+	return append(b, m...)
+}
+
+// appendTime encodes t as a google.protobuf.Timestamp
+func appendTime(b []byte, num int, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var ts []byte
+	ts = binary.AppendUvarint(appendTag(ts, 1, wireVarint), uint64(t.Unix()))
+	if n := t.Nanosecond(); n != 0 {
+		ts = binary.AppendUvarint(appendTag(ts, 2, wireVarint), uint64(n))
+	}
+	return appendMessage(b, num, ts)
+}
+
+// field is a decoded field of a message, Bytes is set for the length
+// delimited ones and Varint for the others
+type field struct {
+	Num    int
+	Wire   int
+	Varint uint64
+	Bytes  []byte
+}
+
+func (f field) string() string {
+	return string(f.Bytes)
+}
+
+func (f field) int() int {
+	return int(int32(f.Varint))
+}
+
+// decodeFields splits a message into its fields, skipping the fixed size
+// ones none of the messages use
+func decodeFields(b []byte) ([]field, error) {
+	var fields []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		b = b[n:]
+		f := field{Num: int(tag >> 3), Wire: int(tag & 7)}
+		switch f.Wire {
+		case wireVarint:
+			if f.Varint, n = binary.Uvarint(b); n <= 0 {
+				return nil, errTruncated
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errTruncated
+			}
+			f.Bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errTruncated
+			}
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errTruncated
+			}
+			b = b[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", f.Wire)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// readFrame reads a length prefixed gRPC message, io.EOF means the client
+// sent no more messages
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errCompressed
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is over the limit of %d", size, maxMessageSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errTruncated
+	}
+	return msg, nil
+}
+
+// writeFrame writes an uncompressed length prefixed gRPC message
+func writeFrame(w io.Writer, msg []byte) error {
+	header := [5]byte{}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
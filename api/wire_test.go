@@ -0,0 +1,336 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTriggerRequestRoundTrip(t *testing.T) {
+	var b []byte
+	b = appendString(b, 1, "mantidproject/mantid")
+	b = appendString(b, 2, "linux")
+	b = appendInt(b, 3, 42)
+	b = appendString(b, 4, "abc123")
+	b = appendString(b, 5, "main")
+	b = appendString(b, 6, "asan")
+
+	var req TriggerRequest
+	if err := req.unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	want := TriggerRequest{
+		Repo:    "mantidproject/mantid",
+		Context: "linux",
+		Number:  42,
+		Sha:     "abc123",
+		Branch:  "main",
+		Profile: "asan",
+	}
+	if req != want {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+}
+
+func TestCancelRequestRoundTrip(t *testing.T) {
+	var b []byte
+	b = appendString(b, 1, "mantidproject/mantid")
+	b = appendInt(b, 2, 7)
+	b = appendString(b, 3, "linux")
+	b = appendString(b, 4, "abc123")
+
+	var req CancelRequest
+	if err := req.unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	want := CancelRequest{Repo: "mantidproject/mantid", Number: 7, Context: "linux", Sha: "abc123"}
+	if req != want {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+}
+
+func TestStatusRequestRoundTrip(t *testing.T) {
+	var b []byte
+	b = appendString(b, 1, "mantidproject/mantid")
+	b = appendInt(b, 2, 7)
+
+	var req StatusRequest
+	if err := req.unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	want := StatusRequest{Repo: "mantidproject/mantid", Number: 7}
+	if req != want {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+}
+
+func TestEventsRequestRoundTrip(t *testing.T) {
+	var b []byte
+	b = appendString(b, 1, "build_started")
+	b = appendString(b, 2, "mantidproject/mantid")
+	b = appendString(b, 1, "build_completed")
+
+	var req EventsRequest
+	if err := req.unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	want := EventsRequest{
+		Types: []string{"build_started", "build_completed"},
+		Repos: []string{"mantidproject/mantid"},
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+}
+
+func TestNegativeInt(t *testing.T) {
+	var req StatusRequest
+	if err := req.unmarshal(appendInt(nil, 2, -1)); err != nil {
+		t.Fatal(err)
+	}
+	if req.Number != -1 {
+		t.Errorf("got %d, want -1", req.Number)
+	}
+}
+
+func TestUnknownFieldsAreSkipped(t *testing.T) {
+	var b []byte
+	b = appendString(b, 1, "mantidproject/mantid")
+	b = appendString(b, 15, "unknown")
+	b = appendTag(b, 16, wireFixed64)
+	b = append(b, make([]byte, 8)...)
+	b = appendTag(b, 17, wireFixed32)
+	b = append(b, make([]byte, 4)...)
+	b = appendInt(b, 2, 7)
+
+	var req StatusRequest
+	if err := req.unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	want := StatusRequest{Repo: "mantidproject/mantid", Number: 7}
+	if req != want {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+}
+
+// decodeTime decodes a google.protobuf.Timestamp
+func decodeTime(t *testing.T, b []byte) time.Time {
+	fields, err := decodeFields(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sec, nsec int64
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			sec = int64(f.Varint)
+		case 2:
+			nsec = int64(f.Varint)
+		}
+	}
+	return time.Unix(sec, nsec)
+}
+
+func TestBuildRecordMarshal(t *testing.T) {
+	scheduled := time.Unix(1700000000, 500)
+	updated := time.Unix(1700000100, 0)
+	record := BuildRecord{
+		Repo:        "mantidproject/mantid",
+		PR:          42,
+		Sha:         "abc123",
+		Context:     "linux",
+		Job:         "pull_requests-linux",
+		State:       "success",
+		Description: "passed",
+		URL:         "https://builds.mantidproject.org/job/1",
+		Scheduled:   scheduled,
+		Updated:     updated,
+	}
+
+	fields, err := decodeFields(StatusResponse{Builds: []BuildRecord{record, record}}.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 {
+		t.Fatalf("got %d builds, want 2", len(fields))
+	}
+
+	fields, err = decodeFields(fields[0].Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got BuildRecord
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			got.Repo = f.string()
+		case 2:
+			got.PR = f.int()
+		case 3:
+			got.Sha = f.string()
+		case 4:
+			got.Context = f.string()
+		case 5:
+			got.Job = f.string()
+		case 6:
+			got.State = f.string()
+		case 7:
+			got.Description = f.string()
+		case 8:
+			got.URL = f.string()
+		case 9:
+			got.Scheduled = decodeTime(t, f.Bytes)
+		case 10:
+			got.Updated = decodeTime(t, f.Bytes)
+		}
+	}
+	if !got.Scheduled.Equal(scheduled) || !got.Updated.Equal(updated) {
+		t.Errorf("got times %v and %v, want %v and %v", got.Scheduled, got.Updated, scheduled, updated)
+	}
+	got.Scheduled, got.Updated = record.Scheduled, record.Updated
+	if got != record {
+		t.Errorf("got %+v, want %+v", got, record)
+	}
+}
+
+func TestEventMarshal(t *testing.T) {
+	event := Event{
+		Type:        "build_completed",
+		Time:        time.Unix(1700000000, 0),
+		Repo:        "mantidproject/mantid",
+		PR:          42,
+		Sha:         "abc123",
+		Context:     "linux",
+		Job:         "pull_requests-linux",
+		State:       "failure",
+		Description: "failed",
+		URL:         "https://builds.mantidproject.org/job/1",
+	}
+
+	fields, err := decodeFields(event.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Event
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			got.Type = f.string()
+		case 2:
+			got.Time = decodeTime(t, f.Bytes)
+		case 3:
+			got.Repo = f.string()
+		case 4:
+			got.PR = f.int()
+		case 5:
+			got.Sha = f.string()
+		case 6:
+			got.Context = f.string()
+		case 7:
+			got.Job = f.string()
+		case 8:
+			got.State = f.string()
+		case 9:
+			got.Description = f.string()
+		case 10:
+			got.URL = f.string()
+		}
+	}
+	if !got.Time.Equal(event.Time) {
+		t.Errorf("got time %v, want %v", got.Time, event.Time)
+	}
+	got.Time = event.Time
+	if got != event {
+		t.Errorf("got %+v, want %+v", got, event)
+	}
+}
+
+func TestEmptyFieldsAreOmitted(t *testing.T) {
+	if b := (Event{}).marshal(); len(b) != 0 {
+		t.Errorf("got %x for an empty event, want nothing", b)
+	}
+}
+
+func TestDecodeFieldsMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		b    []byte
+	}{
+		{"truncated tag", []byte{0x80}},
+		{"truncated varint", []byte{0x08, 0x80}},
+		{"missing length", []byte{0x0a}},
+		{"length past the end", []byte{0x0a, 0x05, 'a', 'b'}},
+		{"huge length", append([]byte{0x0a}, binary.AppendUvarint(nil, 1<<63)...)},
+		{"truncated fixed64", []byte{0x09, 0, 0, 0}},
+		{"truncated fixed32", []byte{0x0d, 0, 0}},
+		{"group wire type", []byte{0x0b}},
+		{"invalid wire type", []byte{0x0e}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if fields, err := decodeFields(tt.b); err == nil {
+				t.Errorf("got %+v, want an error", fields)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	var req TriggerRequest
+	if err := req.unmarshal([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("got no error for a truncated string")
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, msg := range [][]byte{[]byte("hello"), nil} {
+		if err := writeFrame(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"hello", ""} {
+		got, err := readFrame(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if _, err := readFrame(&buf); err != io.EOF {
+		t.Errorf("got %v after the last frame, want io.EOF", err)
+	}
+}
+
+func TestReadFrameMalformed(t *testing.T) {
+	header := func(flag byte, size uint32) []byte {
+		b := []byte{flag, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], size)
+		return b
+	}
+
+	for _, tt := range []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"truncated header", []byte{0, 0, 0}, io.ErrUnexpectedEOF},
+		{"compressed", append(header(1, 1), 'a'), errCompressed},
+		{"truncated message", append(header(0, 5), 'a', 'b'), errTruncated},
+		{"over the limit", header(0, maxMessageSize+1), nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := readFrame(bytes.NewReader(tt.b))
+			if err == nil {
+				t.Fatalf("got %q, want an error", msg)
+			}
+			if tt.err != nil && err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// the version of the state archives, bumped if their format changes
+const archiveVersion = 1
+
+// stateArchive is an export of the state store, eg. to move leeroy to
+// another host or store backend
+type stateArchive struct {
+	Version  int          `json:"version"`
+	Exported time.Time    `json:"exported"`
+	Items    []store.Item `json:"items"`
+}
+
+// isLocalKey reports the keys only meaningful to the running instances,
+// which are neither exported nor imported
+func isLocalKey(key string) bool {
+	return key == leaderKey || key == webhookCheckKey
+}
+
+// exportState returns the items of the state store starting with prefix
+func exportState(prefix string) (stateArchive, error) {
+	items, err := state.Dump(prefix)
+	if err != nil {
+		return stateArchive{}, err
+	}
+
+	archive := stateArchive{Version: archiveVersion, Exported: time.Now().UTC(), Items: []store.Item{}}
+	for _, item := range items {
+		if !isLocalKey(item.Key) {
+			archive.Items = append(archive.Items, item)
+		}
+	}
+	sort.Slice(archive.Items, func(i, j int) bool { return archive.Items[i].Key < archive.Items[j].Key })
+	return archive, nil
+}
+
+// importState restores the items of the archive into the state store
+func importState(archive stateArchive) (int, error) {
+	if archive.Version != archiveVersion {
+		return 0, invalidRequestError(fmt.Sprintf("unsupported state archive version %d", archive.Version))
+	}
+
+	var items []store.Item
+	for _, item := range archive.Items {
+		if !isLocalKey(item.Key) {
+			items = append(items, item)
+		}
+	}
+	if err := state.Restore(items); err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+// stateHandler exports the state store with GET, only the keys starting
+// with ?prefix= if it is given, and imports an archive with POST
+func stateHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		archive, err := exportState(r.URL.Query().Get("prefix"))
+		if err != nil {
+			writeError(w, 500, errInternal, fmt.Errorf("exporting the state failed: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(archive)
+	case "POST":
+		var archive stateArchive
+		if err := json.NewDecoder(r.Body).Decode(&archive); err != nil {
+			writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the state archive as json failed: %v", err))
+			return
+		}
+		n, err := importState(archive)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		log.Infof("Imported %d keys exported at %s", n, archive.Exported.Format(time.RFC3339))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"imported": n})
+	default:
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+	}
+}
+
+// archiveSummary counts the keys of the archive by their first segment,
+// eg. "build"
+func archiveSummary(archive stateArchive) map[string]int {
+	summary := map[string]int{}
+	for _, item := range archive.Items {
+		summary[strings.SplitN(item.Key, "/", 2)[0]]++
+	}
+	return summary
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// checks deciding whether the builds of a pull request may run
+const (
+	authMembership = "membership"
+	authApproval   = "approval"
+	authOverride   = "override"
+)
+
+const (
+	// how long the decisions are kept after the last one
+	authorizationTTL = 30 * 24 * time.Hour
+	// decisions kept per pull request, the oldest are dropped first
+	maxAuthorizationDecisions = 50
+)
+
+// authDecision records why a check allowed or blocked the builds of a
+// pull request
+type authDecision struct {
+	Time    time.Time `json:"time"`
+	Sha     string    `json:"sha"`
+	Check   string    `json:"check"`
+	Allowed bool      `json:"allowed"`
+	Reason  string    `json:"reason"`
+}
+
+// the decisions are read and written back, so concurrent ones of the
+// same pull request would be lost
+var authorizationMu sync.Mutex
+
+func authorizationKey(repo string, number int) string {
+	return fmt.Sprintf("authorization/%s/%d", repo, number)
+}
+
+// authorizationDecisions returns the decisions of a pull request, the
+// oldest first
+func authorizationDecisions(repo string, number int) ([]authDecision, error) {
+	decisions := []authDecision{}
+	b, err := state.Get(authorizationKey(repo, number))
+	if err != nil {
+		if err == store.ErrNotFound {
+			return decisions, nil
+		}
+		return nil, err
+	}
+	return decisions, json.Unmarshal(b, &decisions)
+}
+
+// recordAuthorization stores a decision of a check about the builds of a
+// pull request, failing to store it does not change the decision
+func recordAuthorization(repo string, number int, sha, check string, allowed bool, reason string) {
+	log.WithFields(log.Fields{
+		"repo":    repo,
+		"pr":      number,
+		"sha":     sha,
+		"check":   check,
+		"allowed": allowed,
+	}).Debugf("authorization: %s", reason)
+
+	authorizationMu.Lock()
+	defer authorizationMu.Unlock()
+
+	decisions, err := authorizationDecisions(repo, number)
+	if err != nil {
+		log.Warnf("Reading the authorization decisions of %s #%d failed: %v", repo, number, err)
+		decisions = []authDecision{}
+	}
+	decisions = append(decisions, authDecision{
+		Time:    time.Now().UTC(),
+		Sha:     sha,
+		Check:   check,
+		Allowed: allowed,
+		Reason:  reason,
+	})
+	if len(decisions) > maxAuthorizationDecisions {
+		decisions = decisions[len(decisions)-maxAuthorizationDecisions:]
+	}
+
+	b, err := json.Marshal(decisions)
+	if err != nil {
+		log.Warnf("Encoding the authorization decisions failed: %v", err)
+		return
+	}
+	if err := state.Set(authorizationKey(repo, number), b, authorizationTTL); err != nil {
+		log.Warnf("Saving the authorization decisions of %s #%d failed: %v", repo, number, err)
+	}
+}
+
+type authorizationResponse struct {
+	Repo string `json:"repo"`
+	PR   int    `json:"pr"`
+	// whether the last decision blocked the builds
+	Blocked   bool           `json:"blocked"`
+	Decisions []authDecision `json:"decisions"`
+}
+
+// authorizationHandler reports the authorization decisions of a pull
+// request at /api/pr/{owner}/{repo}/{number}/authorization
+func authorizationHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/pr/"), "/")
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[3] != "authorization" {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("expected /api/pr/{owner}/{repo}/{number}/authorization"))
+		return
+	}
+	number, err := strconv.Atoi(parts[2])
+	if err != nil || number <= 0 {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("invalid pull request number: %q", parts[2]))
+		return
+	}
+	repo := parts[0] + "/" + parts[1]
+
+	decisions, err := authorizationDecisions(repo, number)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	resp := authorizationResponse{
+		Repo:      repo,
+		PR:        number,
+		Decisions: decisions,
+	}
+	if len(decisions) > 0 {
+		resp.Blocked = !decisions[len(decisions)-1].Allowed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"leeroy/github"
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAutoMergeLabel = "auto-merge"
+	// how often the leader looks at the head of the merge queues
+	mergeQueueInterval = time.Minute
+	// how long the head of a merge queue may stay unready, eg. waiting
+	// for an approval or a context which never reports, before it is
+	// dropped so it does not hold back the pull requests behind it
+	defaultMergeQueueTimeout = 6 * time.Hour
+)
+
+// AutoMerge merges the pull requests of a repo labelled for it once all
+// the required contexts are green, they are approved and up to date with
+// their base. The pull requests are merged one at a time, in the order
+// they were labelled, so two green pull requests are never merged
+// without the second one being built on top of the first one.
+type AutoMerge struct {
+	Repo  string `json:"github_repo"`
+	Label string `json:"label"`
+	// contexts which must succeed, all the builds of the repo which are
+	// not custom or label gated by default
+	Contexts  []string `json:"contexts"`
+	Approvals int      `json:"approvals"`
+	// "merge" (default), "squash" or "rebase"
+	Method string `json:"merge_method"`
+	// how long the head of the queue may not be ready to merge
+	Timeout duration `json:"timeout"`
+}
+
+func init() {
+	registerPlugin("auto-merge", func(c Config) bool {
+		return len(c.AutoMerge) > 0
+	}, func(c Config) error {
+		registerTask("merge-queue", mergeQueueInterval, processMergeQueues)
+		return nil
+	})
+}
+
+func (a AutoMerge) timeout() time.Duration {
+	if a.Timeout.Duration <= 0 {
+		return defaultMergeQueueTimeout
+	}
+	return a.Timeout.Duration
+}
+
+func (a AutoMerge) label() string {
+	if a.Label == "" {
+		return defaultAutoMergeLabel
+	}
+	return a.Label
+}
+
+// autoMerge returns the auto merge config of the repo, if any
+func (c Config) autoMerge(repo string) *AutoMerge {
+	for i := range c.AutoMerge {
+		if c.AutoMerge[i].Repo == repo {
+			return &c.AutoMerge[i]
+		}
+	}
+	return nil
+}
+
+func (c Config) requiredContexts(a AutoMerge) []string {
+	if len(a.Contexts) > 0 {
+		return a.Contexts
+	}
+
+	var contexts []string
+	for _, build := range c.Builds {
+		if build.Repo == a.Repo && !build.Custom && build.Label == "" {
+			contexts = append(contexts, build.Context)
+		}
+	}
+	return contexts
+}
+
+func mergeQueueKey(repo string) string {
+	return "merge-queue/" + repo
+}
+
+// enqueueAutoMerge adds a pull request to the merge queue of the repo.
+// Only the leader writes the queue itself, the pull request is moved
+// into it on the next run of the merge-queue task.
+func enqueueAutoMerge(repo string, number int) {
+	if err := state.Push(mergeQueueKey(repo)+"/incoming", []byte(strconv.Itoa(number))); err != nil {
+		log.Errorf("Adding %s #%d to the merge queue failed: %v", repo, number, err)
+		return
+	}
+	log.Infof("Added %s #%d to the merge queue", repo, number)
+}
+
+func loadMergeQueue(repo string) (queue []int, err error) {
+	b, err := state.Get(mergeQueueKey(repo))
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &queue)
+	return queue, err
+}
+
+func saveMergeQueue(repo string, queue []int) error {
+	b, err := json.Marshal(queue)
+	if err != nil {
+		return err
+	}
+	return state.Set(mergeQueueKey(repo), b, 0)
+}
+
+// mergeQueueHead is the pull request at the head of a merge queue and
+// since when
+type mergeQueueHead struct {
+	Number int       `json:"number"`
+	Since  time.Time `json:"since"`
+}
+
+func loadMergeQueueHead(repo string) (head mergeQueueHead, err error) {
+	b, err := state.Get(mergeQueueKey(repo) + "/head")
+	if err == store.ErrNotFound {
+		return head, nil
+	}
+	if err != nil {
+		return head, err
+	}
+	err = json.Unmarshal(b, &head)
+	return head, err
+}
+
+func saveMergeQueueHead(repo string, head mergeQueueHead) error {
+	b, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	return state.Set(mergeQueueKey(repo)+"/head", b, 0)
+}
+
+func processMergeQueues(c Config) {
+	for _, a := range c.AutoMerge {
+		if err := c.processMergeQueue(a); err != nil {
+			log.Errorf("Processing the merge queue of %s failed: %v", a.Repo, err)
+		}
+	}
+}
+
+// processMergeQueue moves the newly labelled pull requests into the
+// queue and merges its head once it is ready
+func (c Config) processMergeQueue(a AutoMerge) error {
+	queue, err := loadMergeQueue(a.Repo)
+	if err != nil {
+		return err
+	}
+
+	for {
+		b, err := state.Pop(mergeQueueKey(a.Repo) + "/incoming")
+		if err == store.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		number, err := strconv.Atoi(string(b))
+		if err != nil {
+			log.Warnf("Ignoring invalid merge queue entry %q for %s", b, a.Repo)
+			continue
+		}
+		if !containsInt(queue, number) {
+			queue = append(queue, number)
+		}
+	}
+
+	head, err := loadMergeQueueHead(a.Repo)
+	if err != nil {
+		return err
+	}
+
+	for len(queue) > 0 {
+		if head.Number != queue[0] {
+			head = mergeQueueHead{Number: queue[0], Since: time.Now()}
+		}
+
+		done, err := c.tryMerge(a, queue[0])
+		if err != nil {
+			log.Errorf("Auto merging %s #%d failed: %v", a.Repo, queue[0], err)
+		}
+		if !done && time.Since(head.Since) > a.timeout() {
+			reason := fmt.Sprintf("it was not ready to merge within %s", a.timeout())
+			if err := c.dropAutoMerge(a, queue[0], reason); err != nil {
+				log.Errorf("Dropping %s #%d from the merge queue failed: %v", a.Repo, queue[0], err)
+			}
+			done = true
+		}
+		if !done {
+			// the head of the queue is not ready yet, or failed in a way
+			// worth retrying
+			break
+		}
+		// dropped even when telling the author failed, so it does not
+		// block the queue nor get commented on again
+		queue = queue[1:]
+	}
+
+	if err := saveMergeQueueHead(a.Repo, head); err != nil {
+		return err
+	}
+	return saveMergeQueue(a.Repo, queue)
+}
+
+// dropAutoMerge removes the label of a pull request leaving the merge
+// queue and tells its author why
+func (c Config) dropAutoMerge(a AutoMerge, number int, reason string) error {
+	log.Infof("Dropping %s #%d from the merge queue: %s", a.Repo, number, reason)
+
+	r := strings.SplitN(a.Repo, "/", 2)
+	if len(r) < 2 {
+		return fmt.Errorf("repo name could not be parsed: %s", a.Repo)
+	}
+	repo := octokat.Repo{UserName: r[0], Name: r[1]}
+
+	g := c.githubClient()
+	comment, err := g.Templates.Render(repo, github.AutoMergeDropTemplate, struct {
+		Reason string
+		Label  string
+	}{reason, a.label()})
+	if err != nil {
+		return err
+	}
+	if _, err := g.Client().AddComment(repo, strconv.Itoa(number), comment); err != nil {
+		return err
+	}
+	return g.RemoveLabel(repo, number, a.label())
+}
+
+// tryMerge merges the pull request if it is ready. It reports whether
+// the pull request leaves the queue, either merged or dropped.
+func (c Config) tryMerge(a AutoMerge, number int) (bool, error) {
+	g := c.githubClient()
+
+	pr, err := c.loadPullRequest(a.Repo, number)
+	if err != nil {
+		return false, err
+	}
+	if pr.State != "open" {
+		log.Infof("Dropping %s #%d from the merge queue, it is %s", a.Repo, number, pr.State)
+		return true, nil
+	}
+
+	labels, err := g.Labels(pr.Repo, number)
+	if err != nil {
+		return false, err
+	}
+	labelled := false
+	for _, l := range labels {
+		if l.Name == a.label() {
+			labelled = true
+		}
+	}
+	if !labelled {
+		log.Infof("Dropping %s #%d from the merge queue, the %q label was removed", a.Repo, number, a.label())
+		return true, nil
+	}
+
+	drop := func(reason string) (bool, error) {
+		return true, c.dropAutoMerge(a, number, reason)
+	}
+
+	// every required context must be green on the head
+	statuses, err := g.CombinedStatuses(pr.Repo, pr.Head.Sha)
+	if err != nil {
+		return false, err
+	}
+	for _, context := range c.requiredContexts(a) {
+		found := false
+		for _, s := range statuses {
+			if s.Context != context {
+				continue
+			}
+			found = true
+			switch s.State {
+			case "success":
+			case "pending":
+				return false, nil
+			default:
+				return drop(fmt.Sprintf("%s is %s", context, s.State))
+			}
+		}
+		if !found {
+			// not reported yet
+			return false, nil
+		}
+	}
+
+	approvals, changesRequested, err := g.Approvals(pr.Repo, number)
+	if err != nil {
+		return false, err
+	}
+	if changesRequested {
+		return drop("changes were requested")
+	}
+	required := a.Approvals
+	if required <= 0 {
+		required = 1
+	}
+	if approvals < required {
+		return false, nil
+	}
+
+	mergeableState, err := g.MergeableState(pr.Repo, number)
+	if err != nil {
+		return false, err
+	}
+	switch mergeableState {
+	case "behind":
+		// the update is a new commit, which is built and then merged
+		log.Infof("Updating %s #%d with its base branch before merging", a.Repo, number)
+		if err := g.UpdateBranch(pr.Repo, number, pr.Head.Sha); err != nil {
+			if github.MergeRejected(err) {
+				return drop(fmt.Sprintf("updating it with %s failed: %v", pr.Base.Ref, errors.Cause(err)))
+			}
+			return false, err
+		}
+		return false, nil
+	case "dirty":
+		return drop("it has merge conflicts")
+	case "clean", "has_hooks", "unstable":
+	default:
+		// "unknown" while GitHub computes it, or "blocked"
+		return false, nil
+	}
+
+	method := a.Method
+	if method == "" {
+		method = "merge"
+	}
+	if err := g.Merge(pr.Repo, number, pr.Head.Sha, method); err != nil {
+		if github.MergeRejected(err) {
+			return drop(fmt.Sprintf("GitHub refused to merge it: %v", errors.Cause(err)))
+		}
+		return false, err
+	}
+
+	log.Infof("Merged %s #%d from the merge queue", a.Repo, number)
+	return true, nil
+}
+
+func containsInt(s []int, v int) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const apiVersion = "7.1"
+
+type Client struct {
+	Organization string `json:"organization"`
+	Project      string `json:"project"`
+	Token        string `json:"token"`
+}
+
+// Run is a run of an Azure pipeline
+type Run struct {
+	ID                 int               `json:"id"`
+	Name               string            `json:"name"`
+	State              string            `json:"state"`
+	Result             string            `json:"result"`
+	TemplateParameters map[string]string `json:"templateParameters"`
+	Pipeline           Pipeline          `json:"pipeline"`
+	Links              struct {
+		Web struct {
+			Href string `json:"href"`
+		} `json:"web"`
+	} `json:"_links"`
+}
+
+type Pipeline struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Notification is the payload of the "Run state changed" service hook
+type Notification struct {
+	EventType string `json:"eventType"`
+	Resource  struct {
+		Run      Run      `json:"run"`
+		Pipeline Pipeline `json:"pipeline"`
+	} `json:"resource"`
+}
+
+type runRequest struct {
+	TemplateParameters map[string]string `json:"templateParameters"`
+}
+
+// Sets the authentication for the Azure DevOps client.
+// Token is a personal access token with the Build (read & execute) scope.
+func New(organization, project, token string) *Client {
+	return &Client{
+		Organization: organization,
+		Project:      project,
+		Token:        token,
+	}
+}
+
+// PipelineURL returns the web url listing the runs of a pipeline
+func (c *Client) PipelineURL(pipeline int) string {
+	return fmt.Sprintf("https://dev.azure.com/%s/%s/_build?definitionId=%d", c.Organization, c.Project, pipeline)
+}
+
+// RunPipeline queues a run of a pipeline with the template parameters given
+func (c *Client) RunPipeline(pipeline int, parameters map[string]string) (*Run, error) {
+	d, err := json.Marshal(runRequest{TemplateParameters: parameters})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/pipelines/%d/runs?api-version=%s", c.Organization, c.Project, pipeline, apiVersion)
+	var run Run
+	if err := c.do("POST", url, d, &run); err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// GetRun returns a run of a pipeline, including its template parameters
+func (c *Client) GetRun(pipeline, id int) (*Run, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/pipelines/%d/runs/%d?api-version=%s", c.Organization, c.Project, pipeline, id, apiVersion)
+	var run Run
+	if err := c.do("GET", url, nil, &run); err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+func (c *Client) do(method, url string, data []byte, v interface{}) error {
+	// set up the request
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// add the auth, the username is ignored for personal access tokens
+	req.SetBasicAuth("", c.Token)
+
+	// do the request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// check the status code
+	// it should be 200
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("azure %s to %s responded with status %d", method, url, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("parsing the response from %s failed: %v", url, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"leeroy/events"
+	"leeroy/webhook"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// buildResult is a status change of a build reported by one of the backends
+type buildResult struct {
+	Repo     string
+	HeadRepo string
+	PR       int
+	// the branch of the builds of branches rather than pull requests
+	Branch string
+	Sha    string
+	// the number of the jenkins build
+	Number int
+	// a build of a commit being bisected rather than of the branch
+	Bisect      bool
+	State       string
+	Description string
+	URL         string
+	Completed   bool
+	// the build failed because of the infrastructure rather than the code
+	Infrastructure bool
+}
+
+// buildURL returns the url of the build's job/pipeline on its backend
+func (c Config) buildURL(build Build) string {
+	switch build.Backend {
+	case "azure":
+		return c.Azure.PipelineURL(build.AzurePipeline)
+	case "webhook":
+		return build.WebhookURL
+	default:
+		return c.Jenkins.Baseurl + "/job/" + build.Job
+	}
+}
+
+// triggerBuild sends the build with its parameters to the backend
+// configured for it, unless it has to wait for free agents. It reports
+// whether the build was deferred.
+func (c Config) triggerBuild(build Build, parameters map[string]string) (bool, error) {
+	c.profileParameters(build, parameters)
+
+	// optional builds wait while their agents are busy
+	if c.deferBuild(build, parameters) {
+		return true, nil
+	}
+	return false, c.sendBuild(build, parameters)
+}
+
+// sendBuild sends the build to its backend
+func (c Config) sendBuild(build Build, parameters map[string]string) error {
+	switch build.Backend {
+	case "", "jenkins":
+		if build.CheckParameters {
+			if err := c.checkParameters(build, parameters); err != nil {
+				return err
+			}
+		}
+		values := url.Values{}
+		for k, v := range parameters {
+			values.Set(k, v)
+		}
+		if err := c.jenkins().BuildWithParameters(build.Job, values.Encode()); err != nil {
+			return backendError{fmt.Errorf("scheduling jenkins build failed: %v", err)}
+		}
+	case "azure":
+		if _, err := c.Azure.RunPipeline(build.AzurePipeline, parameters); err != nil {
+			return backendError{fmt.Errorf("queueing azure pipeline %d failed: %v", build.AzurePipeline, err)}
+		}
+	case "webhook":
+		pr, _ := strconv.Atoi(parameters["PR"])
+		if err := c.Webhook.Send(build.WebhookURL, webhook.Payload{
+			Repo:       parameters["GIT_BASE_REPO"],
+			PR:         pr,
+			Sha:        parameters["GIT_SHA1"],
+			Context:    build.Context,
+			Parameters: parameters,
+		}); err != nil {
+			return backendError{fmt.Errorf("sending build webhook to %s failed: %v", build.WebhookURL, err)}
+		}
+	default:
+		return fmt.Errorf("unknown backend %q for context: %s, repo: %s", build.Backend, build.Context, build.Repo)
+	}
+
+	return nil
+}
+
+// cancelBuild stops the running and queued builds scheduled for the pr,
+// only the ones of sha if it is set so a delayed hook about an older
+// head cannot cancel the builds of a newer one. The deferred builds of
+// any backend are dropped, the running ones are only cancelled on
+// jenkins.
+func (c Config) cancelBuild(build Build, pr int, sha string) error {
+	cancelDeferred(build, pr, sha)
+
+	if build.Backend != "" && build.Backend != "jenkins" {
+		log.Debugf("Cancelling builds is not supported by the %s backend", build.Backend)
+		return nil
+	}
+
+	// the build of a fork may be running on the sandboxed job
+	for _, job := range build.jobs() {
+		numbers, err := c.jenkins().GetJobInstances(job, strconv.Itoa(pr), sha)
+		if err != nil {
+			return backendError{fmt.Errorf("getting running builds of %s failed: %v", job, err)}
+		}
+
+		// eg. the builds of several commits
+		for _, number := range numbers {
+			if err := c.jenkins().StopBuild(job, number); err != nil {
+				return backendError{fmt.Errorf("stopping jenkins build %s %d failed: %v", job, number, err)}
+			}
+
+			log.Infof("Cancelled jenkins build %s %d of %s #%d", job, number, build.Repo, pr)
+		}
+
+		// and the builds which did not start yet
+		ids, err := c.jenkins().GetQueuedInstances(job, strconv.Itoa(pr), sha)
+		if err != nil {
+			return backendError{fmt.Errorf("getting queued builds of %s failed: %v", job, err)}
+		}
+		for _, id := range ids {
+			if err := c.jenkins().CancelQueueItem(id); err != nil {
+				return backendError{fmt.Errorf("cancelling queued jenkins build %s %d failed: %v", job, id, err)}
+			}
+
+			log.Infof("Cancelled queued jenkins build %s (queue item %d) of %s #%d", job, id, build.Repo, pr)
+		}
+	}
+	return nil
+}
+
+// reportBuild updates the GitHub status of a build and schedules its
+// downstream builds once it succeeded
+func (c Config) reportBuild(build Build, res buildResult) error {
+	// the bisected commits are not the state of the branch
+	if res.Bisect {
+		res.Branch = ""
+	}
+
+	record, err := getBuildRecord(res.Repo, res.Sha, build.Context)
+	if err != nil {
+		// scheduled by another tool or the record expired
+		record = buildRecord{
+			Repo:    res.Repo,
+			PR:      res.PR,
+			Sha:     res.Sha,
+			Context: build.Context,
+			Job:     build.Job,
+		}
+	}
+	record.State = res.State
+	record.Description = res.Description
+	record.URL = res.URL
+	if !res.Completed && res.State == "pending" && record.Started.IsZero() {
+		record.Started = time.Now()
+	}
+	// the infrastructure failures do not count in the stats
+	if res.Completed && !record.Started.IsZero() && !res.Infrastructure {
+		recordDuration(record, time.Since(record.Started))
+	}
+	saveBuildRecord(record)
+
+	// published once the record is saved, so the subscribers read the
+	// completed build
+	if res.Completed {
+		events.Publish(events.Event{
+			Type:           events.BuildCompleted,
+			Repo:           res.Repo,
+			PR:             res.PR,
+			Branch:         res.Branch,
+			Sha:            res.Sha,
+			Context:        build.Context,
+			Job:            build.Job,
+			Number:         res.Number,
+			State:          res.State,
+			Description:    res.Description,
+			URL:            res.URL,
+			Infrastructure: res.Infrastructure,
+			Delivery:       record.Delivery,
+		})
+	}
+
+	// update the github status, downstream builds are still
+	// scheduled if this fails
+	if err := c.updateGithubStatus(res.Repo, build.Context, res.Sha, res.State, res.Description, withDelivery(res.URL, record.Delivery)); err != nil {
+		log.Error(err)
+	}
+	c.reportDeployments(build, res)
+	if res.Bisect {
+		// a bisection only needs the result of the build itself, not of
+		// its downstream builds on the historical commit
+		if res.Completed {
+			c.reportBisect(build, res)
+		}
+		return nil
+	}
+
+	if res.State != "success" || record.NoDownstream {
+		return nil
+	}
+
+	for _, downstream := range build.DownstreamBuilds {
+		downstreamBuild, err := c.getBuildByContextAndRepo(downstream, res.Repo)
+		if err != nil {
+			return err
+		}
+		if !c.downstreamNeeded(downstreamBuild, res) {
+			continue
+		}
+		// the builds of branches and commits have no pull request
+		if res.PR == 0 {
+			err = c.scheduleRefBuild(res.Repo, downstreamBuild, res.Sha, res.Branch, nil)
+		} else {
+			err = c.scheduleDownstreamBuild(res.Repo, res.HeadRepo, res.PR, downstreamBuild, res.Sha)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"leeroy/events"
+	"leeroy/github"
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// bisection searches the first failing commit of a branch between the
+// last green one and a broken one by building the commits in between.
+// Each round builds up to Concurrency commits evenly spread over the
+// remaining range, which shrinks to the commits between the last passing
+// and the first failing one of the round.
+type bisection struct {
+	Repo    string `json:"repo"`
+	Branch  string `json:"branch"`
+	Context string `json:"context"`
+	// from the green commit to the broken one, oldest first
+	Commits []github.Commit `json:"commits"`
+	// indexes of the last known green and first known broken commits
+	Good int `json:"good"`
+	Bad  int `json:"bad"`
+	// how many commits are built at once
+	Concurrency int `json:"concurrency"`
+	// states of the builds of the current round by sha
+	Round  map[string]string `json:"round"`
+	Builds int               `json:"builds"`
+	// when the builds of the current round were scheduled
+	RoundStarted time.Time `json:"round_started"`
+	// the first failing commit once found
+	Culprit string `json:"culprit,omitempty"`
+	// why the bisection ended without a culprit, eg. it was aborted
+	Stopped string    `json:"stopped,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+// active returns whether the bisection still builds commits
+func (b bisection) active() bool {
+	return b.Culprit == "" && b.Stopped == ""
+}
+
+type requestBisect struct {
+	Repo    string `json:"repo"`
+	Branch  string `json:"branch"`
+	Context string `json:"context"`
+	// the broken commit, the head of the branch by default
+	Sha string `json:"sha,omitempty"`
+	// the green commit, the last one the build succeeded on by default
+	Good        string `json:"good,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`
+}
+
+const (
+	// a round whose builds did not all complete by then stops the
+	// bisection, eg. when a build was lost
+	bisectRoundTimeout    = 12 * time.Hour
+	bisectTimeoutInterval = 10 * time.Minute
+)
+
+func init() {
+	registerTask("bisect-timeouts", bisectTimeoutInterval, stopStalledBisections)
+}
+
+func bisectKey(repo, context string) string {
+	return "bisect/" + repo + "/" + context
+}
+
+// lockBisection serializes the updates of a bisection by the
+// notifications, requests and timeouts on all the instances
+func lockBisection(repo, context string) (func(), error) {
+	return lockShared(bisectKey(repo, context))
+}
+
+func getBisection(repo, context string) (b bisection, err error) {
+	v, err := state.Get(bisectKey(repo, context))
+	if err != nil {
+		return b, err
+	}
+	err = json.Unmarshal(v, &b)
+	return b, err
+}
+
+func saveBisection(b bisection) error {
+	v, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return state.Set(bisectKey(b.Repo, b.Context), v, buildRecordTTL)
+}
+
+// startBisect looks up the commits between the green and the broken one
+// and builds the first round of them
+func (c Config) startBisect(req requestBisect) (bisection, error) {
+	b := bisection{
+		Repo:        req.Repo,
+		Branch:      req.Branch,
+		Context:     req.Context,
+		Concurrency: req.Concurrency,
+		Started:     time.Now(),
+	}
+	if b.Concurrency <= 0 {
+		b.Concurrency = 1
+	}
+
+	build, err := c.getBuildByContextAndRepo(req.Context, req.Repo)
+	if err != nil {
+		return b, err
+	}
+	if build.Backend != "" && build.Backend != "jenkins" {
+		return b, invalidRequestError(fmt.Sprintf("bisecting is not supported by the %s backend", build.Backend))
+	}
+
+	r := strings.SplitN(req.Repo, "/", 2)
+	if len(r) < 2 {
+		return b, fmt.Errorf("repo name could not be parsed: %s", req.Repo)
+	}
+	repo := octokat.Repo{UserName: r[0], Name: r[1]}
+	g := c.githubClient()
+
+	good := req.Good
+	if good == "" {
+		v, err := state.Get(lastGreenKey(events.Event{Repo: req.Repo, Branch: req.Branch, Context: req.Context}))
+		if err != nil {
+			return b, invalidRequestError(fmt.Sprintf("no green build of %s on %s is known, give the good commit", req.Context, req.Branch))
+		}
+		good = string(v)
+	}
+	bad := req.Sha
+	if bad == "" {
+		if bad, err = g.CommitSha(repo, req.Branch); err != nil {
+			return b, githubError{errors.Wrapf(err, "getting the head of %s %s failed", req.Repo, req.Branch)}
+		}
+	}
+
+	commits, err := g.CompareCommits(repo, good, bad)
+	if err != nil {
+		return b, githubError{errors.Wrapf(err, "getting the commits of %s between %s and %s failed", req.Repo, good, bad)}
+	}
+	if len(commits) == 0 {
+		return b, invalidRequestError(fmt.Sprintf("%s is not a descendant of %s", bad, good))
+	}
+	b.Commits = append([]github.Commit{{Sha: good}}, commits...)
+	b.Bad = len(b.Commits) - 1
+
+	unlock, err := lockBisection(req.Repo, req.Context)
+	if err != nil {
+		return b, err
+	}
+	defer unlock()
+	if current, err := getBisection(req.Repo, req.Context); err == nil && current.active() {
+		return b, invalidRequestError(fmt.Sprintf("%s of %s is already being bisected", req.Context, req.Repo))
+	}
+
+	log.Infof("Bisecting %s of %s %s over %d commits", req.Context, req.Repo, req.Branch, b.Bad)
+	if err := c.nextBisectRound(build, &b); err != nil {
+		return b, err
+	}
+	return b, saveBisection(b)
+}
+
+// nextBisectRound builds the next commits, or reports the first failing
+// commit once the range cannot shrink anymore
+func (c Config) nextBisectRound(build Build, b *bisection) error {
+	if b.Bad-b.Good <= 1 {
+		b.Culprit = b.Commits[b.Bad].Sha
+		b.Round = nil
+		if err := c.reportCulprit(*b); err != nil {
+			log.Errorf("Reporting the culprit of the bisection of %s (%s) failed: %v", b.Repo, b.Context, err)
+		}
+		return nil
+	}
+
+	n := b.Concurrency
+	if n > b.Bad-b.Good-1 {
+		n = b.Bad - b.Good - 1
+	}
+	b.Round = map[string]string{}
+	b.RoundStarted = time.Now()
+	for i := 1; i <= n; i++ {
+		sha := b.Commits[b.Good+(b.Bad-b.Good)*i/(n+1)].Sha
+		// the deferred builds and the maintenance windows still apply
+		if err := c.scheduleRefBuild(b.Repo, build, sha, "", map[string]string{"LEEROY_BISECT": "1"}); err != nil {
+			return err
+		}
+		b.Round[sha] = "pending"
+		b.Builds++
+	}
+	return nil
+}
+
+// reportBisect records the result of a build of a bisected commit, and
+// starts the next round once all the builds of the round completed
+func (c Config) reportBisect(build Build, res buildResult) {
+	unlock, err := lockBisection(res.Repo, build.Context)
+	if err != nil {
+		log.Errorf("Recording the bisected build of %s %s (%s) failed: %v", res.Repo, res.Sha, build.Context, err)
+		return
+	}
+	defer unlock()
+
+	b, err := getBisection(res.Repo, build.Context)
+	if err != nil || !b.active() {
+		return
+	}
+	if _, ok := b.Round[res.Sha]; !ok {
+		return
+	}
+	b.Round[res.Sha] = res.State
+
+	for _, state := range b.Round {
+		if state == "pending" {
+			if err := saveBisection(b); err != nil {
+				log.Errorf("Saving the bisection of %s (%s) failed: %v", b.Repo, b.Context, err)
+			}
+			return
+		}
+	}
+
+	// errored builds count as failed ones
+	good, bad := b.Good, b.Bad
+	for i := b.Good + 1; i < b.Bad; i++ {
+		state, ok := b.Round[b.Commits[i].Sha]
+		if !ok {
+			continue
+		}
+		if state == "success" {
+			if i > good {
+				good = i
+			}
+		} else if i < bad {
+			bad = i
+		}
+	}
+	// a failure before a success leaves the range between them
+	if good > bad {
+		good = b.Good
+	}
+	b.Good, b.Bad = good, bad
+
+	if err := c.nextBisectRound(build, &b); err != nil {
+		log.Errorf("Bisecting %s of %s failed: %v", b.Context, b.Repo, err)
+	}
+	if err := saveBisection(b); err != nil {
+		log.Errorf("Saving the bisection of %s (%s) failed: %v", b.Repo, b.Context, err)
+	}
+}
+
+// reportCulprit comments the first failing commit on the failure issue of
+// the branch, if there is one
+func (c Config) reportCulprit(b bisection) error {
+	log.Infof("Bisected %s of %s %s: %s is the first failing commit", b.Context, b.Repo, b.Branch, b.Culprit)
+
+	e := events.Event{Repo: b.Repo, Branch: b.Branch, Context: b.Context}
+	v, err := state.Get(failureIssueKey(e))
+	if err == store.ErrNotFound || string(v) == failureIssueClaim {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	issue, err := strconv.Atoi(string(v))
+	if err != nil {
+		return fmt.Errorf("invalid failure issue %q: %v", v, err)
+	}
+
+	r := strings.SplitN(b.Repo, "/", 2)
+	repo := octokat.Repo{UserName: r[0], Name: r[1]}
+	g := c.githubClient()
+	comment, err := g.Templates.Render(repo, github.CIBisectTemplate, map[string]interface{}{
+		"Context": b.Context,
+		"Branch":  b.Branch,
+		"Builds":  b.Builds,
+		"Good":    b.Commits[b.Good],
+		"Commit":  b.Commits[b.Bad],
+	})
+	if err != nil {
+		return err
+	}
+	return g.CommentIssue(repo, issue, comment)
+}
+
+// stopBisection ends an active bisection without a culprit, the builds of
+// its round are left to complete
+func stopBisection(repo, context, reason string) (bisection, error) {
+	unlock, err := lockBisection(repo, context)
+	if err != nil {
+		return bisection{}, err
+	}
+	defer unlock()
+
+	b, err := getBisection(repo, context)
+	if err == store.ErrNotFound || (err == nil && !b.active()) {
+		return b, invalidRequestError(fmt.Sprintf("%s of %s is not being bisected", context, repo))
+	}
+	if err != nil {
+		return b, err
+	}
+
+	log.Infof("Stopped bisecting %s of %s %s: %s", b.Context, b.Repo, b.Branch, reason)
+	b.Stopped = reason
+	b.Round = nil
+	return b, saveBisection(b)
+}
+
+// stopStalledBisections stops the bisections whose round did not complete
+// in time
+func stopStalledBisections(c Config) {
+	keys, err := state.Keys("bisect/")
+	if err != nil {
+		log.Warnf("listing the bisections failed: %v", err)
+		return
+	}
+	for _, key := range keys {
+		v, err := state.Get(key)
+		if err != nil {
+			continue
+		}
+		var b bisection
+		if err := json.Unmarshal(v, &b); err != nil || !b.active() || time.Since(b.RoundStarted) < bisectRoundTimeout {
+			continue
+		}
+		reason := fmt.Sprintf("the builds of a round did not complete within %s", bisectRoundTimeout)
+		if _, err := stopBisection(b.Repo, b.Context, reason); err != nil {
+			log.Warnf("stopping the bisection of %s (%s) failed: %v", b.Repo, b.Context, err)
+		}
+	}
+}
+
+// bisectHandler starts bisecting the breakage of a branch on POST, and
+// returns the progress of a bisection on GET or aborts it on DELETE with
+// the repo and context
+func bisectHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		b, err := getBisection(r.URL.Query().Get("repo"), r.URL.Query().Get("context"))
+		if err != nil {
+			writeError(w, 404, errNotFound, fmt.Errorf("no bisection of %s (%s)", r.URL.Query().Get("repo"), r.URL.Query().Get("context")))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b)
+
+	case "POST":
+		var req requestBisect
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the bisect request as json failed: %v", err))
+			return
+		}
+		if req.Repo == "" || req.Branch == "" || req.Context == "" {
+			writeError(w, 400, errInvalidRequest, fmt.Errorf("the repo, branch and context are required"))
+			return
+		}
+
+		b, err := config.startBisect(req)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b)
+
+	case "DELETE":
+		b, err := stopBisection(r.URL.Query().Get("repo"), r.URL.Query().Get("context"), "aborted")
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b)
+
+	default:
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"leeroy/events"
+	"leeroy/objectstore"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	buildArchiveRetentionInterval = 24 * time.Hour
+	// bytes of the end of the console log archived with the failed builds
+	archivedConsoleSize = 64 * 1024
+)
+
+// buildArchive keeps the completed builds in an S3 bucket, eg. for audits
+// long after their records expired from the state store
+type buildArchive struct {
+	S3 objectstore.S3 `json:"s3"`
+	// prepended to the keys of the objects, eg. "leeroy/"
+	Prefix string `json:"prefix"`
+	// the archived builds are deleted after this many days, never if 0
+	RetentionDays int `json:"retention_days"`
+	// how long the records of the archived builds are kept in the state
+	// store, as long as the other records if 0
+	LocalTTL duration `json:"local_ttl"`
+}
+
+// archivedBuild is the document archived for each completed build
+type archivedBuild struct {
+	Event  events.Event `json:"event"`
+	Record *buildRecord `json:"record,omitempty"`
+	// the end of the console log of the failed jenkins builds
+	Console string `json:"console,omitempty"`
+}
+
+func init() {
+	registerPlugin("build-archive", func(c Config) bool {
+		return c.BuildArchive.S3.Bucket != ""
+	}, func(c Config) error {
+		events.Subscribe(events.BuildCompleted, func(e events.Event) {
+			c.archiveBuild(e)
+		})
+		if c.BuildArchive.RetentionDays > 0 {
+			registerTask("build-archive-retention", buildArchiveRetentionInterval, expireArchivedBuilds)
+		}
+		return nil
+	})
+}
+
+// archivedBuildKey returns where the build is archived, by day
+func (c Config) archivedBuildKey(e events.Event) string {
+	t := e.Time.UTC()
+	return fmt.Sprintf("%sbuilds/%s/%s/%s/%s-%d.json", c.BuildArchive.Prefix, e.Repo, t.Format("2006/01/02"), e.Sha, e.Context, t.Unix())
+}
+
+// archiveBuild stores the completed build, along with its record and the
+// end of its console log if it failed
+func (c Config) archiveBuild(e events.Event) {
+	doc := archivedBuild{Event: e}
+	if record, err := getBuildRecord(e.Repo, e.Sha, e.Context); err == nil {
+		doc.Record = &record
+	}
+	if e.State != "success" && e.Job != "" && e.Number > 0 {
+		if build, err := c.getBuildByContextAndRepo(e.Context, e.Repo); err == nil && (build.Backend == "" || build.Backend == "jenkins") {
+			console, err := c.jenkins().GetConsoleTail(e.Job, e.Number, archivedConsoleSize)
+			if err != nil {
+				log.Warnf("Getting the console of %s %d to archive it failed: %v", e.Job, e.Number, err)
+			}
+			doc.Console = console
+		}
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		log.Warnf("encoding archived build failed: %v", err)
+		return
+	}
+	key := c.archivedBuildKey(e)
+	if err := c.BuildArchive.S3.Put(key, b, "application/json"); err != nil {
+		log.Errorf("Archiving the build of %s %s (%s) failed: %v", e.Repo, e.Sha, e.Context, err)
+		return
+	}
+	log.Debugf("Archived the build of %s %s (%s) as %s", e.Repo, e.Sha, e.Context, key)
+
+	// the record is reread as it was saved after the event was published
+	if ttl := c.BuildArchive.LocalTTL.Duration; ttl > 0 {
+		if b, err := state.Get(buildRecordKey(e.Repo, e.Sha, e.Context)); err == nil {
+			if err := state.Set(buildRecordKey(e.Repo, e.Sha, e.Context), b, ttl); err != nil {
+				log.Warnf("shortening the record of %s %s (%s) failed: %v", e.Repo, e.Sha, e.Context, err)
+			}
+		}
+	}
+}
+
+// expireArchivedBuilds deletes the archived builds older than the
+// retention
+func expireArchivedBuilds(c Config) {
+	a := c.BuildArchive
+	objects, err := a.S3.List(a.Prefix + "builds/")
+	if err != nil {
+		log.Errorf("Listing the archived builds failed: %v", err)
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -a.RetentionDays)
+	deleted := 0
+	for _, o := range objects {
+		if o.LastModified.After(cutoff) {
+			continue
+		}
+		if err := a.S3.Delete(o.Key); err != nil {
+			log.Error(err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Infof("Deleted %d archived builds older than %d days", deleted, a.RetentionDays)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how long the decisions of the canary config are kept
+const canaryReportTTL = 7 * 24 * time.Hour
+
+// canaryConfig runs the builds of another config file in shadow mode next
+// to the production ones, eg. to try a restructured build graph on the
+// live pull requests
+type canaryConfig struct {
+	// path to the config file, only its builds are used
+	Config string `json:"config"`
+	// send the builds the canary config would schedule to jenkins with
+	// LEEROY_DRY_RUN=1, otherwise they are only compared
+	JenkinsDryRun bool `json:"jenkins_dry_run"`
+}
+
+// canary is the production config with the builds of the canary config,
+// nil unless one is configured
+var canary *Config
+
+func init() {
+	registerPlugin("canary", func(c Config) bool {
+		return c.Canary.Config != ""
+	}, func(c Config) error {
+		loaded, err := readConfig(c.Canary.Config)
+		if err != nil {
+			return err
+		}
+		shadow := c
+		shadow.Builds = loaded.Builds
+		// nothing the canary does is written to github
+		shadow.shadow = true
+		if errs := shadow.validate(); len(errs) > 0 {
+			return fmt.Errorf("invalid canary config: %v", errs[0])
+		}
+		canary = &shadow
+		return nil
+	})
+}
+
+// canaryReport compares which builds the production and canary configs
+// schedule for a head of a pull request
+type canaryReport struct {
+	Repo string    `json:"repo"`
+	PR   int       `json:"pr"`
+	Sha  string    `json:"sha"`
+	Time time.Time `json:"time"`
+	// the contexts scheduled by each config
+	Production []string `json:"production"`
+	Canary     []string `json:"canary"`
+	// the contexts only one of them schedules
+	OnlyProduction []string `json:"only_production,omitempty"`
+	OnlyCanary     []string `json:"only_canary,omitempty"`
+}
+
+func (r canaryReport) differs() bool {
+	return len(r.OnlyProduction) > 0 || len(r.OnlyCanary) > 0
+}
+
+func canaryReportKey(repo string, pr int, sha string) string {
+	return fmt.Sprintf("canary/%s/%d/%s", repo, pr, sha)
+}
+
+// plannedBuilds returns the builds the config schedules for the pull
+// request when its holds allow it
+func (c Config) plannedBuilds(repo string, pr *github.PullRequest, extras pullRequestHookExtras) ([]Build, error) {
+	builds, err := c.pullRequestBuilds(repo, pr, extras)
+	if err != nil {
+		return nil, err
+	}
+
+	var planned []Build
+	for _, build := range builds {
+		if build.Downstream || !extras.labelled(build) || !extras.triaged(build) {
+			continue
+		}
+		planned = append(planned, build)
+	}
+	return planned, nil
+}
+
+// contexts returns the sorted contexts of the builds
+func contexts(builds []Build) []string {
+	names := []string{}
+	for _, build := range builds {
+		names = append(names, build.Context)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compareCanary records which builds the canary config would schedule
+// for the pull request instead of the production ones, and sends them to
+// jenkins as dry runs if it is configured to
+func compareCanary(repo string, pr *github.PullRequest, extras pullRequestHookExtras) {
+	production, err := config.plannedBuilds(repo, pr, extras)
+	if err != nil {
+		log.Warnf("Planning the production builds of %s #%d for the canary failed: %v", repo, pr.Number, err)
+		return
+	}
+	shadow, err := canary.plannedBuilds(repo, pr, extras)
+	if _, unknown := err.(unknownBuildError); err != nil && !unknown {
+		log.Warnf("Planning the canary builds of %s #%d failed: %v", repo, pr.Number, err)
+		return
+	}
+
+	report := canaryReport{
+		Repo:       repo,
+		PR:         pr.Number,
+		Sha:        pr.Head.Sha,
+		Time:       time.Now(),
+		Production: contexts(production),
+		Canary:     contexts(shadow),
+	}
+	for _, name := range report.Production {
+		if !containsString(report.Canary, name) {
+			report.OnlyProduction = append(report.OnlyProduction, name)
+		}
+	}
+	for _, name := range report.Canary {
+		if !containsString(report.Production, name) {
+			report.OnlyCanary = append(report.OnlyCanary, name)
+		}
+	}
+	if report.differs() {
+		log.Infof("The canary config schedules different builds for %s #%d: only in production %v, only in the canary %v", repo, pr.Number, report.OnlyProduction, report.OnlyCanary)
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		log.Warnf("encoding canary report failed: %v", err)
+		return
+	}
+	if err := state.Set(canaryReportKey(repo, pr.Number, pr.Head.Sha), b, canaryReportTTL); err != nil {
+		log.Warnf("saving the canary report of %s #%d failed: %v", repo, pr.Number, err)
+	}
+
+	if !config.Canary.JenkinsDryRun {
+		return
+	}
+	for _, build := range shadow {
+		if build.Backend != "" && build.Backend != "jenkins" {
+			continue
+		}
+		if isFork(pr) {
+			build = build.sandboxed()
+		}
+		parameters := map[string]string{
+			"GIT_BASE_REPO":  repo,
+			"GIT_HEAD_REPO":  fmt.Sprintf("%s/%s", pr.Head.Repo.Owner.Login, pr.Head.Repo.Name),
+			"GIT_SHA1":       pr.Head.Sha,
+			"PR":             strconv.Itoa(pr.Number),
+			"BASE_BRANCH":    pr.Base.Ref,
+			"LEEROY_DRY_RUN": "1",
+			"LEEROY_CANARY":  "1",
+		}
+		if err := canary.sendBuild(build, parameters); err != nil {
+			log.Warnf("Sending the canary build %s of %s #%d failed: %v", build.Context, repo, pr.Number, err)
+		}
+	}
+}
+
+// canaryHandler returns the recent canary reports, only the ones where
+// the configs disagree with ?diff=1
+func canaryHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	prefix := "canary/"
+	if repo := r.URL.Query().Get("repo"); repo != "" {
+		prefix += repo + "/"
+	}
+	keys, err := state.Keys(prefix)
+	if err != nil {
+		writeError(w, 500, errInternal, fmt.Errorf("listing the canary reports failed: %v", err))
+		return
+	}
+
+	reports := []canaryReport{}
+	for _, key := range keys {
+		b, err := state.Get(key)
+		if err != nil {
+			// expired since listing
+			continue
+		}
+		var report canaryReport
+		if err := json.Unmarshal(b, &report); err != nil {
+			log.Warnf("decoding canary report %s failed: %v", key, err)
+			continue
+		}
+		if r.URL.Query().Get("diff") != "" && !report.differs() {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Time.After(reports[j].Time) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
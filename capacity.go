@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how often the deferred builds are checked for free agents and the end
+// of maintenance windows
+const deferredInterval = time.Minute
+
+// deferredBuild is a build waiting for free agents or the end of a
+// maintenance window
+type deferredBuild struct {
+	Repo       string            `json:"repo"`
+	Context    string            `json:"context"`
+	Job        string            `json:"job"`
+	Parameters map[string]string `json:"parameters"`
+	Deferred   time.Time         `json:"deferred"`
+}
+
+func deferredKey(label string) string {
+	return "deferred/" + label
+}
+
+// deferredCancel is when the builds of a pull request were cancelled, only
+// the ones of Sha if it is set
+type deferredCancel struct {
+	Time time.Time `json:"time"`
+	Sha  string    `json:"sha,omitempty"`
+}
+
+func deferredCancelKey(repo string, pr int, context string) string {
+	return fmt.Sprintf("deferred-cancel/%s/%d/%s", repo, pr, context)
+}
+
+// cancelDeferred records that the builds of the pull request deferred
+// until now are cancelled, they are dropped once popped
+func cancelDeferred(build Build, pr int, sha string) {
+	b, err := json.Marshal(deferredCancel{Time: time.Now(), Sha: sha})
+	if err != nil {
+		log.Warnf("encoding the deferred cancel failed: %v", err)
+		return
+	}
+	if err := state.Set(deferredCancelKey(build.Repo, pr, build.Context), b, buildRecordTTL); err != nil {
+		log.Warnf("cancelling the deferred %s of %s #%d failed: %v", build.Context, build.Repo, pr, err)
+	}
+}
+
+func init() {
+	registerPlugin("deferred-builds", func(c Config) bool {
+		return len(c.agentLabels()) > 0 || len(c.MaintenanceWindows) > 0
+	}, func(c Config) error {
+		registerTask("deferred-builds", deferredInterval, startDeferredBuilds)
+		return nil
+	})
+}
+
+// agentLabels returns the labels of the agents of the optional builds
+func (c Config) agentLabels() (labels []string) {
+	for _, build := range c.Builds {
+		if build.Optional && build.AgentLabel != "" && !containsString(labels, build.AgentLabel) {
+			labels = append(labels, build.AgentLabel)
+		}
+	}
+	return labels
+}
+
+// saturated checks if the agents with the label have no executors to
+// spare for optional builds, keeping reserved_executors free for the
+// required ones. Unknown loads count as free so builds are not held up by
+// a failing api.
+func (c Config) saturated(label string) bool {
+	load, err := c.jenkins().GetLabelLoad(label)
+	if err != nil {
+		log.Warnf("Getting the load of the %s agents failed: %v", label, err)
+		return false
+	}
+	return load.IdleExecutors <= c.ReservedExecutors
+}
+
+// deferBuild holds a build back during maintenance windows, and an
+// optional jenkins build while the agents of its label are saturated.
+// They are started by the deferred-builds task once the window is over or
+// the agents are free again. It reports whether the build was deferred.
+func (c Config) deferBuild(build Build, parameters map[string]string) bool {
+	repo, sha := parameters["GIT_BASE_REPO"], parameters["GIT_SHA1"]
+
+	if w, end := c.maintenance(); w != nil {
+		if !pushDeferred(maintenanceKey, build, parameters) {
+			return false
+		}
+		log.Infof("Deferred %s of %s %s until the %s window ends", build.Context, repo, sha, w.Name)
+		desc := msg(repo, "Paused during the %s window until %s", w.Name, end.Format("15:04 MST"))
+		if err := c.updateGithubStatus(repo, build.Context, sha, "pending", desc, ""); err != nil {
+			log.Error(err)
+		}
+		return true
+	}
+
+	if !build.Optional || build.AgentLabel == "" || (build.Backend != "" && build.Backend != "jenkins") {
+		return false
+	}
+	if !c.saturated(build.AgentLabel) || !pushDeferred(deferredKey(build.AgentLabel), build, parameters) {
+		return false
+	}
+
+	log.Infof("Deferred %s of %s %s, the %s agents are busy", build.Context, repo, sha, build.AgentLabel)
+	if err := c.updateGithubStatus(repo, build.Context, sha, "pending", msg(repo, "Waiting for a free %s agent", build.AgentLabel), ""); err != nil {
+		log.Error(err)
+	}
+	return true
+}
+
+// pushDeferred adds the build to the deferred builds at key, it reports
+// whether it was added
+func pushDeferred(key string, build Build, parameters map[string]string) bool {
+	b, err := json.Marshal(deferredBuild{
+		Repo:       build.Repo,
+		Context:    build.Context,
+		Job:        build.Job,
+		Parameters: parameters,
+		Deferred:   time.Now(),
+	})
+	if err != nil {
+		log.Warnf("encoding deferred build failed: %v", err)
+		return false
+	}
+	if err := state.Push(key, b); err != nil {
+		log.Warnf("deferring %s of %s failed, starting it: %v", build.Context, build.Repo, err)
+		return false
+	}
+	return true
+}
+
+// popDeferred returns the next deferred build at key with its parameters,
+// ok is false once there are none left
+func (c Config) popDeferred(key string) (build Build, parameters map[string]string, ok bool) {
+	for {
+		b, err := state.Pop(key)
+		if err == store.ErrNotFound {
+			return build, nil, false
+		}
+		if err != nil {
+			log.Errorf("Getting the deferred builds of %s failed: %v", key, err)
+			return build, nil, false
+		}
+
+		var d deferredBuild
+		if err := json.Unmarshal(b, &d); err != nil {
+			log.Warnf("decoding deferred build failed: %v", err)
+			continue
+		}
+		build, err := c.getBuildByContextAndRepo(d.Context, d.Repo)
+		if err != nil {
+			log.Warnf("Dropping the deferred build: %v", err)
+			continue
+		}
+		if reason := c.supersededDeferred(build, d); reason != "" {
+			log.Infof("Dropping the deferred %s of %s %s, %s", d.Context, d.Repo, d.Parameters["GIT_SHA1"], reason)
+			continue
+		}
+		build.Job = d.Job
+		return build, d.Parameters, true
+	}
+}
+
+// supersededDeferred returns why the deferred build of a pull request is
+// not needed anymore: it was cancelled, the pull request was closed or
+// its commit is no longer part of it. It returns "" for the builds which
+// are still needed, and the builds of branches.
+func (c Config) supersededDeferred(build Build, d deferredBuild) string {
+	number, _ := strconv.Atoi(d.Parameters["PR"])
+	if number == 0 {
+		return ""
+	}
+	sha := d.Parameters["GIT_SHA1"]
+
+	if b, err := state.Get(deferredCancelKey(d.Repo, number, d.Context)); err == nil {
+		var cancel deferredCancel
+		if err := json.Unmarshal(b, &cancel); err == nil && cancel.Time.After(d.Deferred) && (cancel.Sha == "" || cancel.Sha == sha) {
+			return "it was cancelled"
+		}
+	}
+
+	pr, err := c.loadPullRequest(d.Repo, number)
+	if err != nil {
+		// better to build it than to lose it
+		log.Warnf("Getting %s #%d to check its deferred %s failed: %v", d.Repo, number, d.Context, err)
+		return ""
+	}
+	if pr.State != "open" {
+		return "the pull request is " + pr.State
+	}
+	if pr.Head.Sha == sha {
+		return ""
+	}
+	if c.buildCommits(build) != "last" {
+		for _, commit := range pr.Content.Commits() {
+			if commit.Sha == sha {
+				return ""
+			}
+		}
+	}
+	return "the pull request was updated to " + pr.Head.Sha
+}
+
+// startDeferredBuilds starts the builds deferred by a maintenance window
+// once it is over, then the builds waiting for free agents, in the order
+// they were deferred, while their agents have free executors
+func startDeferredBuilds(c Config) {
+	if w, _ := c.maintenance(); w != nil {
+		return
+	}
+
+	for {
+		build, parameters, ok := c.popDeferred(maintenanceKey)
+		if !ok {
+			break
+		}
+		// may be deferred again for free agents
+		c.startDeferred(build, parameters, c.triggerBuild)
+	}
+
+	sendNow := func(build Build, parameters map[string]string) (bool, error) {
+		return false, c.sendBuild(build, parameters)
+	}
+
+	for _, label := range c.agentLabels() {
+		for !c.saturated(label) {
+			build, parameters, ok := c.popDeferred(deferredKey(label))
+			if !ok {
+				break
+			}
+			c.startDeferred(build, parameters, sendNow)
+
+			// give jenkins time to assign the build before looking at
+			// the load again
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
+
+// startDeferred starts a deferred build with send, resetting its status.
+// send reports whether the build was deferred again.
+func (c Config) startDeferred(build Build, parameters map[string]string, send func(Build, map[string]string) (bool, error)) {
+	repo, sha := parameters["GIT_BASE_REPO"], parameters["GIT_SHA1"]
+	if err := c.updateGithubStatus(repo, build.Context, sha, "pending", msg(repo, "Build is being scheduled"), c.buildURL(build)); err != nil {
+		log.Error(err)
+	}
+	deferred, err := send(build, parameters)
+	if err != nil {
+		log.Errorf("Starting the deferred %s of %s %s failed: %v", build.Context, repo, sha, err)
+		return
+	}
+	if deferred {
+		return
+	}
+	log.Infof("Started the deferred %s of %s %s", build.Context, repo, sha)
+
+	// its place in the queue is reported from now on
+	record, err := getBuildRecord(repo, sha, build.Context)
+	if err != nil {
+		log.Warnf("getting build record for %s %s (%s) failed: %v", repo, sha, build.Context, err)
+		return
+	}
+	record.Deferred = false
+	record.Description = ""
+	saveBuildRecord(record)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+
+	"leeroy/github"
+)
+
+const commitsContext = "commits"
+
+// CommitsCheck holds the builds of pull requests with fixup!/squash!
+// commits or too many commits until the history is cleaned up, or a
+// maintainer adds the override label
+type CommitsCheck struct {
+	MaxCommits    int    `json:"max_commits"`
+	OverrideLabel string `json:"override_label"`
+}
+
+func init() {
+	registerCheck("commits", checkCommits)
+}
+
+// commitsCheck returns the commits check of the repo, if any
+func (c Config) commitsCheck(repo string) *CommitsCheck {
+	for _, checks := range c.Checks {
+		if checks.Repo == repo && checks.Commits != nil {
+			return checks.Commits
+		}
+	}
+	return nil
+}
+
+// problem returns why the history of the pull request needs a clean
+// up, or "" if it does not
+func (k CommitsCheck) problem(repo string, pr *github.PullRequest) string {
+	commits := pr.Content.Commits()
+	for _, commit := range commits {
+		if strings.HasPrefix(commit.Commit.Message, "fixup!") || strings.HasPrefix(commit.Commit.Message, "squash!") {
+			return msg(repo, "%s is a fixup commit, squash it with git rebase -i --autosquash", commit.Sha[:7])
+		}
+	}
+	if k.MaxCommits > 0 && len(commits) > k.MaxCommits {
+		return msg(repo, "%d commits, squash them to at most %d", len(commits), k.MaxCommits)
+	}
+	return ""
+}
+
+// commitsHold returns why the builds of the pull request wait for its
+// history to be cleaned up, or "" if they can run
+func (c Config) commitsHold(repo string, pr *github.PullRequest, extras pullRequestHookExtras) string {
+	k := c.commitsCheck(repo)
+	if k == nil || (k.OverrideLabel != "" && extras.hasLabel(k.OverrideLabel)) {
+		return ""
+	}
+	return k.problem(repo, pr)
+}
+
+func checkCommits(c Config, checks Checks, pr *github.PullRequest) error {
+	k := checks.Commits
+	if k == nil {
+		return nil
+	}
+
+	repo, context := checks.Repo, c.context(commitsContext)
+	problem := k.problem(repo, pr)
+	if problem == "" {
+		return c.updateGithubStatus(repo, context, pr.Head.Sha, "success", msg(repo, "The history looks clean"), "")
+	}
+
+	if k.OverrideLabel != "" {
+		labels, err := c.githubClient().Labels(pr.Repo, pr.Number)
+		if err != nil {
+			return githubError{err}
+		}
+		for _, l := range labels {
+			if l.Name == k.OverrideLabel {
+				return c.overrideCommits(repo, pr.Head.Sha, k.OverrideLabel)
+			}
+		}
+	}
+	return c.updateGithubStatus(repo, context, pr.Head.Sha, "failure", problem, "")
+}
+
+// overrideCommits clears the commits status once the override label was
+// added
+func (c Config) overrideCommits(repo, sha, label string) error {
+	return c.updateGithubStatus(repo, c.context(commitsContext), sha, "success", msg(repo, "Overridden by the %q label", label), "")
+}
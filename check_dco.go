@@ -0,0 +1,32 @@
+package main
+
+import "leeroy/github"
+
+const dcoContext = "dco"
+
+// DCOCheck makes sure every commit is signed off
+type DCOCheck struct {
+	// commits verified by GitHub (GPG, SSH or S/MIME signed) pass
+	// without a Signed-off-by trailer
+	AllowVerified bool `json:"allow_verified"`
+}
+
+func init() {
+	registerCheck("dco", checkDCO)
+}
+
+func checkDCO(c Config, checks Checks, pr *github.PullRequest) error {
+	if checks.DCO == nil {
+		return nil
+	}
+
+	unsigned := pr.Content.UnsignedCommits(checks.DCO.AllowVerified)
+	if err := c.githubClient().CheckSignedOff(pr, unsigned); err != nil {
+		return err
+	}
+
+	if len(unsigned) > 0 {
+		return c.updateGithubStatus(checks.Repo, c.context(dcoContext), pr.Head.Sha, "failure", msg(checks.Repo, "%d commit(s) missing a Signed-off-by, see the comment", len(unsigned)), pr.HtmlURL)
+	}
+	return c.updateGithubStatus(checks.Repo, c.context(dcoContext), pr.Head.Sha, "success", msg(checks.Repo, "All commits are signed off"), "")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"leeroy/github"
+)
+
+const filesContext = "files"
+
+const defaultMaxFileSizeKB = 1024
+
+// FilesCheck flags pull requests adding large or binary files, or
+// submodules, which bloat the repo for good once merged
+type FilesCheck struct {
+	MaxSizeKB int `json:"max_size_kb"`
+	// files which may be large or binary, eg. test data
+	Allow []string `json:"allow"`
+	// paths of the submodules which may be added or updated
+	Submodules []string `json:"submodules"`
+}
+
+func init() {
+	registerCheck("files", checkFiles)
+}
+
+func checkFiles(c Config, checks Checks, pr *github.PullRequest) error {
+	if checks.Files == nil {
+		return nil
+	}
+
+	problems, err := c.fileProblems(*checks.Files, checks.Repo, pr)
+	if err != nil {
+		return err
+	}
+
+	repo, context, url := checks.Repo, c.context(filesContext), pr.HtmlURL+"/files"
+	switch len(problems) {
+	case 0:
+		return c.updateGithubStatus(repo, context, pr.Head.Sha, "success", msg(repo, "No large files, binaries or submodules added"), url)
+	case 1:
+		return c.updateGithubStatus(repo, context, pr.Head.Sha, "failure", problems[0], url)
+	}
+	return c.updateGithubStatus(repo, context, pr.Head.Sha, "failure", msg(repo, "%s, and %d more", problems[0], len(problems)-1), url)
+}
+
+// fileProblems describes the files of the pull request which should not
+// be added, with what to do instead
+func (c Config) fileProblems(f FilesCheck, repo string, pr *github.PullRequest) ([]string, error) {
+	maxSize := f.MaxSizeKB
+	if maxSize <= 0 {
+		maxSize = defaultMaxFileSizeKB
+	}
+
+	tree, err := c.githubClient().Tree(pr.Repo, pr.Head.Sha)
+	if err != nil {
+		return nil, githubError{err}
+	}
+	entries := map[string]*github.TreeEntry{}
+	for i := range tree {
+		entries[tree[i].Path] = &tree[i]
+	}
+
+	var problems []string
+	for _, file := range pr.Content.Files() {
+		entry := entries[file.FileName]
+		if file.Status == "removed" || entry == nil {
+			continue
+		}
+
+		switch {
+		case entry.Type == "commit":
+			if !matchesAny(file.FileName, f.Submodules) {
+				problems = append(problems, msg(repo, "%s is a submodule, vendor the code or ask a maintainer to allow it", file.FileName))
+			}
+		case matchesAny(file.FileName, f.Allow):
+		// the files already in the repo were accepted before, and the
+		// modified ones also include mode-only changes
+		case file.Status != "added":
+		case entry.Size > int64(maxSize)*1024:
+			problems = append(problems, msg(repo, "%s is %d KB, above %d KB, use Git LFS or host it elsewhere", file.FileName, entry.Size/1024, maxSize))
+		// GitHub has no patch and no changed lines for binary files, nor
+		// for empty ones
+		case file.Patch == "" && file.Changes == 0 && entry.Size > 0:
+			problems = append(problems, msg(repo, "%s is a binary file, use Git LFS or host it elsewhere", file.FileName))
+		}
+	}
+	return problems, nil
+}
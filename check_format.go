@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const formatContext = "format"
+
+const (
+	// the formatting of larger pull requests is left to the builds
+	maxFormatFiles = 200
+	// GitHub rejects comments longer than 65536 characters
+	maxFormatPatch       = 60000
+	defaultFormatTimeout = 2 * time.Minute
+)
+
+// FormatCheck runs formatters on the C++ and Python files changed by pull
+// requests and comments with the patch fixing their formatting
+type FormatCheck struct {
+	Formatters []Formatter `json:"formatters"`
+	// files of the repo the formatters read, eg. .clang-format
+	ConfigFiles []string `json:"config_files"`
+	// prefix of the commands running them in a sandbox, eg. bwrap or
+	// nsjail, the formatters run on untrusted code and are never run
+	// without one
+	Sandbox []string `json:"sandbox"`
+	Timeout duration `json:"timeout"`
+}
+
+// Formatter formats the files given as its last arguments in place
+type Formatter struct {
+	Name string `json:"name"`
+	// "cpp" or "python"
+	Language string   `json:"language"`
+	Command  []string `json:"command"`
+}
+
+func (f Formatter) name() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return f.Command[0]
+}
+
+// formats checks if the formatter formats the file
+func (f Formatter) formats(name string) bool {
+	switch f.Language {
+	case "cpp":
+		return github.IsCppFile(name)
+	case "python":
+		return github.IsPythonFile(name)
+	}
+	return false
+}
+
+func (f FormatCheck) names() string {
+	var names []string
+	for _, formatter := range f.Formatters {
+		names = append(names, formatter.name())
+	}
+	return strings.Join(names, ", ")
+}
+
+func init() {
+	registerCheck("format", checkFormat)
+}
+
+func checkFormat(c Config, checks Checks, pr *github.PullRequest) error {
+	f := checks.Format
+	if f == nil {
+		return nil
+	}
+	needed := false
+	for _, formatter := range f.Formatters {
+		if (formatter.Language == "cpp" && pr.Content.HasCppFiles()) || (formatter.Language == "python" && pr.Content.ContainsPythonFiles()) {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil
+	}
+
+	repo, sha, context := checks.Repo, pr.Head.Sha, c.context(formatContext)
+	if len(f.Sandbox) == 0 {
+		if err := c.updateGithubStatus(repo, context, sha, "error", msg(repo, "The formatters have no sandbox to run in"), pr.HtmlURL); err != nil {
+			return err
+		}
+		return fmt.Errorf("format check for %s: sandbox is required", repo)
+	}
+	if err := c.updateGithubStatus(repo, context, sha, "pending", msg(repo, "Checking the formatting"), pr.HtmlURL); err != nil {
+		return err
+	}
+
+	// the formatters can take longer than GitHub waits for the hook
+	go func() {
+		g := c.githubClient()
+		state, desc := "success", msg(repo, "The formatting looks good")
+		patch, err := c.formatPatch(*f, pr)
+		if err != nil {
+			log.Errorf("Checking the formatting of %s #%d failed: %v", repo, pr.Number, err)
+			state, desc = "error", msg(repo, "Checking the formatting failed")
+		} else if patch != "" {
+			state, desc = "failure", msg(repo, "Some files are not formatted, see the patch in the comments")
+		}
+
+		// the check of a newer head may have finished first, the comment
+		// is only about the current head
+		current, err := g.GetPullRequest(pr.Repo, pr.Number)
+		switch {
+		case err != nil:
+			log.Errorf("Getting %s #%d to update its formatting patch failed: %v", repo, pr.Number, err)
+		case current.Head.Sha != sha:
+			log.Debugf("Not updating the formatting patch of %s #%d, its head moved from %s to %s", repo, pr.Number, sha, current.Head.Sha)
+		case state == "failure":
+			patch, truncated := truncatePatch(patch, maxFormatPatch)
+			if err := g.AddFormatComment(current, f.names(), patch, truncated); err != nil {
+				log.Errorf("Commenting the formatting patch on %s #%d failed: %v", repo, pr.Number, err)
+			}
+		case state == "success":
+			if err := g.RemoveFormatComment(current); err != nil {
+				log.Errorf("Removing the formatting patch of %s #%d failed: %v", repo, pr.Number, err)
+			}
+		}
+		if err := c.updateGithubStatus(repo, context, sha, state, desc, pr.HtmlURL); err != nil {
+			log.Error(err)
+		}
+	}()
+	return nil
+}
+
+// truncatePatch cuts patch down to max bytes at the end of a line, or of
+// a character if its first line is already too long
+func truncatePatch(patch string, max int) (string, bool) {
+	if len(patch) <= max {
+		return patch, false
+	}
+	if i := strings.LastIndex(patch[:max], "\n"); i >= 0 {
+		return patch[:i+1], true
+	}
+	for max > 0 && !utf8.RuneStart(patch[max]) {
+		max--
+	}
+	return patch[:max], true
+}
+
+// formatPatch formats the files changed by the pull request at its head
+// in a temporary directory, returning the unified diff of the changes
+// of the formatters or "" if there are none
+func (c Config) formatPatch(f FormatCheck, pr *github.PullRequest) (string, error) {
+	dir, err := ioutil.TempDir("", "leeroy-format-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	// the files are formatted in b/ and compared with the ones of a/
+	write := func(name string, content []byte) error {
+		for _, root := range []string{"a", "b"} {
+			p := filepath.Join(dir, root, filepath.FromSlash(name))
+			if !strings.HasPrefix(p, filepath.Join(dir, root)+string(filepath.Separator)) {
+				return fmt.Errorf("invalid file name %q", name)
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(p, content, 0600); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	g := c.githubClient()
+	for _, name := range f.ConfigFiles {
+		content, err := g.FileContent(pr.Repo, name, pr.Head.Sha)
+		if err != nil {
+			if apiErr, ok := errors.Cause(err).(*github.Error); ok && apiErr.StatusCode == 404 {
+				continue
+			}
+			return "", err
+		}
+		if err := write(name, content); err != nil {
+			return "", err
+		}
+	}
+
+	files := map[string][]string{}
+	count := 0
+	for _, file := range pr.Content.Files() {
+		if file.Status == "removed" {
+			continue
+		}
+		downloaded := false
+		for _, formatter := range f.Formatters {
+			if !formatter.formats(file.FileName) {
+				continue
+			}
+			if !downloaded {
+				if count++; count > maxFormatFiles {
+					return "", fmt.Errorf("more than %d files to format", maxFormatFiles)
+				}
+				content, err := g.FileContent(pr.Repo, file.FileName, pr.Head.Sha)
+				if err != nil {
+					return "", err
+				}
+				if err := write(file.FileName, content); err != nil {
+					return "", err
+				}
+				downloaded = true
+			}
+			// relative to the directory, so names starting with a dash
+			// cannot be taken for options of the formatter
+			files[formatter.name()] = append(files[formatter.name()], "."+string(filepath.Separator)+filepath.FromSlash(file.FileName))
+		}
+	}
+
+	timeout := f.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultFormatTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, formatter := range f.Formatters {
+		if len(files[formatter.name()]) == 0 {
+			continue
+		}
+		// only PATH is passed on, the credentials of leeroy are not
+		args := append(append(append([]string{}, f.Sandbox...), formatter.Command...), files[formatter.name()]...)
+		env := []string{"PATH=" + os.Getenv("PATH"), "HOME=" + filepath.Join(dir, "b")}
+		if _, err := execCommand(ctx, filepath.Join(dir, "b"), env, nil, args); err != nil {
+			return "", fmt.Errorf("%s failed: %v", formatter.name(), err)
+		}
+	}
+
+	// diff exits with 1 when the files differ
+	patch, err := execCommand(ctx, dir, []string{"PATH=" + os.Getenv("PATH")}, nil, []string{"diff", "-ru", "a", "b"})
+	if exitErr, ok := errors.Cause(err).(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return string(patch), nil
+	}
+	return string(patch), err
+}
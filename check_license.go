@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const licenseContext = "license"
+
+// the header has to be in the first lines of the files
+const defaultLicenseLines = 20
+
+// LicenseCheck makes sure the source files changed by pull requests
+// carry the license header
+type LicenseCheck struct {
+	// regexp matching the header, eg. "SPDX-License-Identifier: GPL-3.0"
+	Header string `json:"header"`
+	Lines  int    `json:"lines"`
+	// files which need the header, the C++ and Python files by default
+	Source  []string `json:"source"`
+	Exclude []string `json:"exclude"`
+}
+
+// needsHeader checks if the file has to carry the header
+func (l LicenseCheck) needsHeader(name string) bool {
+	if matchesAny(name, l.Exclude) {
+		return false
+	}
+	if len(l.Source) > 0 {
+		return matchesAny(name, l.Source)
+	}
+	return github.IsCppFile(name) || github.IsPythonFile(name)
+}
+
+// hasHeader checks if one of the first lines of the content matches the
+// header
+func (l LicenseCheck) hasHeader(re *regexp.Regexp, content []byte) bool {
+	lines := l.Lines
+	if lines <= 0 {
+		lines = defaultLicenseLines
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for i := 0; i < lines && scanner.Scan(); i++ {
+		if re.Match(scanner.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	registerCheck("license", checkLicense)
+}
+
+func checkLicense(c Config, checks Checks, pr *github.PullRequest) error {
+	l := checks.License
+	if l == nil {
+		return nil
+	}
+	re, err := regexp.Compile(l.Header)
+	if err != nil {
+		return fmt.Errorf("invalid license header %q: %v", l.Header, err)
+	}
+
+	var files []string
+	for _, f := range pr.Content.Files() {
+		if f.Status != "removed" && l.needsHeader(f.FileName) {
+			files = append(files, f.FileName)
+		}
+	}
+
+	repo, sha, context := checks.Repo, pr.Head.Sha, c.context(licenseContext)
+	if len(files) == 0 {
+		return c.updateGithubStatus(repo, context, sha, "success", msg(repo, "No source files changed"), "")
+	}
+	if err := c.updateGithubStatus(repo, context, sha, "pending", msg(repo, "Checking the license headers"), ""); err != nil {
+		return err
+	}
+
+	// downloading the files can take longer than GitHub waits for the hook
+	go func() {
+		g := c.githubClient()
+		var missing []string
+		for _, name := range files {
+			content, err := g.FileContent(pr.Repo, name, sha)
+			if err != nil {
+				log.Errorf("Checking the license header of %s in %s #%d failed: %v", name, repo, pr.Number, err)
+				if err := c.updateGithubStatus(repo, context, sha, "error", msg(repo, "Checking the license headers failed"), ""); err != nil {
+					log.Error(err)
+				}
+				return
+			}
+			if !l.hasHeader(re, content) {
+				missing = append(missing, name)
+			}
+		}
+
+		state, desc := "success", msg(repo, "All the source files have the license header")
+		if len(missing) > 0 {
+			state, desc = "failure", msg(repo, "%d files miss the license header, see the comments", len(missing))
+			if err := g.AddLicenseComment(pr, l.Header, missing); err != nil {
+				log.Errorf("Commenting the missing license headers on %s #%d failed: %v", repo, pr.Number, err)
+			}
+		} else if err := g.RemoveLicenseComment(pr); err != nil {
+			log.Errorf("Removing the missing license headers comment of %s #%d failed: %v", repo, pr.Number, err)
+		}
+		if err := c.updateGithubStatus(repo, context, sha, state, desc, ""); err != nil {
+			log.Error(err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"leeroy/github"
+)
+
+const lintContext = "pr-lint"
+
+// LintCheck validates the title and description of pull requests
+type LintCheck struct {
+	Title []LintRule `json:"title"`
+	Body  []LintRule `json:"body"`
+}
+
+// LintRule is a pattern the title or description must match, the
+// message tells the author how to fix it
+type LintRule struct {
+	Pattern string `json:"pattern"`
+	Message string `json:"message"`
+}
+
+func init() {
+	registerCheck("lint", lintPullRequest)
+}
+
+func lintPullRequest(c Config, checks Checks, pr *github.PullRequest) error {
+	if checks.Lint == nil {
+		return nil
+	}
+
+	failure, err := checks.Lint.failure(checks.Repo, pr.Title, pr.Body)
+	if err != nil {
+		return err
+	}
+
+	if failure != "" {
+		return c.updateGithubStatus(checks.Repo, c.context(lintContext), pr.Head.Sha, "failure", failure, pr.HtmlURL)
+	}
+	return c.updateGithubStatus(checks.Repo, c.context(lintContext), pr.Head.Sha, "success", msg(checks.Repo, "The title and description look good"), pr.HtmlURL)
+}
+
+// failure returns the message of the first rule not matched by the
+// title or the body
+func (l LintCheck) failure(repo, title, body string) (string, error) {
+	for _, field := range []struct {
+		name  string
+		value string
+		rules []LintRule
+	}{
+		{"title", title, l.Title},
+		{"description", body, l.Body},
+	} {
+		for _, rule := range field.rules {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return "", fmt.Errorf("invalid %s pattern %q: %v", field.name, rule.Pattern, err)
+			}
+			if re.MatchString(field.value) {
+				continue
+			}
+
+			if rule.Message != "" {
+				return rule.Message, nil
+			}
+			return msg(repo, "The "+field.name+" must match %s", rule.Pattern), nil
+		}
+	}
+
+	return "", nil
+}
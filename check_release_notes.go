@@ -0,0 +1,61 @@
+package main
+
+import (
+	"leeroy/github"
+)
+
+const releaseNotesContext = "release-notes"
+
+var (
+	defaultReleaseNotes = []string{"docs/source/release/"}
+	defaultNonSource    = []string{"docs/"}
+)
+
+// ReleaseNotesCheck makes sure pull requests changing source code add
+// or modify a release note
+type ReleaseNotesCheck struct {
+	// files counting as source code, everything outside docs/ by default
+	Source []string `json:"source"`
+	// release note files, docs/source/release/ by default
+	Notes []string `json:"notes"`
+}
+
+func init() {
+	registerCheck("release-notes", checkReleaseNotes)
+}
+
+func checkReleaseNotes(c Config, checks Checks, pr *github.PullRequest) error {
+	if checks.ReleaseNotes == nil {
+		return nil
+	}
+
+	notes := checks.ReleaseNotes.Notes
+	if len(notes) == 0 {
+		notes = defaultReleaseNotes
+	}
+
+	hasSource, hasNotes := false, false
+	for _, f := range pr.Content.Files() {
+		switch {
+		case matchesAny(f.FileName, notes):
+			// removing a release note does not document anything
+			if f.Status != "removed" {
+				hasNotes = true
+			}
+		case len(checks.ReleaseNotes.Source) > 0:
+			if matchesAny(f.FileName, checks.ReleaseNotes.Source) {
+				hasSource = true
+			}
+		case !matchesAny(f.FileName, defaultNonSource):
+			hasSource = true
+		}
+	}
+
+	switch {
+	case !hasSource:
+		return c.updateGithubStatus(checks.Repo, c.context(releaseNotesContext), pr.Head.Sha, "success", msg(checks.Repo, "No source changes, release notes not needed"), "")
+	case !hasNotes:
+		return c.updateGithubStatus(checks.Repo, c.context(releaseNotesContext), pr.Head.Sha, "failure", msg(checks.Repo, "Source changes need a release note under %s", notes[0]), "")
+	}
+	return c.updateGithubStatus(checks.Repo, c.context(releaseNotesContext), pr.Head.Sha, "success", msg(checks.Repo, "Release notes found"), "")
+}
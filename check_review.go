@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"leeroy/github"
+)
+
+const reviewContext = "review"
+
+// ReviewCheck turns the reviews of pull requests into a status, failing
+// while changes are requested
+type ReviewCheck struct {
+	// only an approval by a code owner of the changed files clears
+	// requested changes, otherwise any approval does
+	CodeOwners bool `json:"code_owners"`
+}
+
+func init() {
+	registerCheck("review", checkReview)
+}
+
+func checkReview(c Config, checks Checks, pr *github.PullRequest) error {
+	if checks.Review == nil {
+		return nil
+	}
+
+	g := c.githubClient()
+	reviews, err := g.Reviews(pr.Repo, pr.Number)
+	if err != nil {
+		return err
+	}
+
+	// the latest verdict of each reviewer, dismissed reviews no
+	// longer count
+	latest := map[string]string{}
+	for _, r := range reviews {
+		switch r.State {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			latest[r.User.Login] = r.State
+		}
+	}
+
+	var requesters, approvers []string
+	for user, state := range latest {
+		switch state {
+		case "CHANGES_REQUESTED":
+			requesters = append(requesters, user)
+		case "APPROVED":
+			approvers = append(approvers, user)
+		}
+	}
+	sort.Strings(requesters)
+
+	if len(requesters) == 0 {
+		return c.updateGithubStatus(checks.Repo, c.context(reviewContext), pr.Head.Sha, "success", msg(checks.Repo, "No changes requested"), "")
+	}
+
+	var owners github.CodeOwners
+	if checks.Review.CodeOwners {
+		if owners, err = g.GetCodeOwners(pr.Repo, pr.Base.Ref); err != nil {
+			return err
+		}
+	}
+	for _, user := range approvers {
+		owner := true
+		if checks.Review.CodeOwners {
+			if owner, err = g.IsCodeOwner(pr, owners, user); err != nil {
+				return err
+			}
+		}
+		if owner {
+			return c.updateGithubStatus(checks.Repo, c.context(reviewContext), pr.Head.Sha, "success", msg(checks.Repo, "Approved by %s", user), "")
+		}
+	}
+
+	desc := msg(checks.Repo, "Changes requested by %s", strings.Join(requesters, ", "))
+	return c.updateGithubStatus(checks.Repo, c.context(reviewContext), pr.Head.Sha, "failure", desc, pr.HtmlURL)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+
+	"leeroy/github"
+)
+
+const sizeLabelPrefix = "size/"
+
+// SizeCheck labels pull requests size/S, size/M, size/L or size/XL from
+// the number of lines they change
+type SizeCheck struct {
+	// the most lines changed by a pull request of each size
+	Small  int `json:"small"`
+	Medium int `json:"medium"`
+	Large  int `json:"large"`
+	// when set, size/XL pull requests are only built once a maintainer
+	// adds this label
+	OverrideLabel string `json:"override_label"`
+}
+
+func init() {
+	registerCheck("size", checkSize)
+}
+
+// label returns the size label of a pull request changing lines
+func (s SizeCheck) label(lines int) string {
+	small, medium, large := s.Small, s.Medium, s.Large
+	if small <= 0 {
+		small = 100
+	}
+	if medium <= 0 {
+		medium = 500
+	}
+	if large <= 0 {
+		large = 1000
+	}
+
+	switch {
+	case lines <= small:
+		return sizeLabelPrefix + "S"
+	case lines <= medium:
+		return sizeLabelPrefix + "M"
+	case lines <= large:
+		return sizeLabelPrefix + "L"
+	}
+	return sizeLabelPrefix + "XL"
+}
+
+func checkSize(c Config, checks Checks, pr *github.PullRequest) error {
+	if checks.Size == nil {
+		return nil
+	}
+
+	g := c.githubClient()
+	want := checks.Size.label(pr.Content.ChangedLines())
+
+	labels, err := g.Labels(pr.Repo, pr.Number)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, l := range labels {
+		if l.Name == want {
+			found = true
+			continue
+		}
+		if strings.HasPrefix(l.Name, sizeLabelPrefix) {
+			if err := g.RemoveLabel(pr.Repo, pr.Number, l.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if found {
+		return nil
+	}
+	return g.AddLabels(pr.Repo, pr.Number, want)
+}
+
+// sizeCheck returns the size check configured for the repo, if any
+func (c Config) sizeCheck(repo string) *SizeCheck {
+	for _, checks := range c.Checks {
+		if checks.Repo == repo && checks.Size != nil {
+			return checks.Size
+		}
+	}
+	return nil
+}
+
+// sizeOverride returns the label a maintainer has to add before the
+// builds of a size/XL pull request run, or "" if they can run
+func (c Config) sizeOverride(repo string, pr *github.PullRequest) string {
+	s := c.sizeCheck(repo)
+	if s == nil || s.OverrideLabel == "" {
+		return ""
+	}
+	if s.label(pr.Content.ChangedLines()) != sizeLabelPrefix+"XL" {
+		return ""
+	}
+	return s.OverrideLabel
+}
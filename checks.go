@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Checks configures the built-in checks of a repo. They run in leeroy
+// itself, without a build job, and each report their own status.
+type Checks struct {
+	Repo         string             `json:"github_repo"`
+	Lint         *LintCheck         `json:"lint"`
+	ReleaseNotes *ReleaseNotesCheck `json:"release_notes"`
+	DCO          *DCOCheck          `json:"dco"`
+	Size         *SizeCheck         `json:"size"`
+	Review       *ReviewCheck       `json:"review"`
+	Format       *FormatCheck       `json:"format"`
+	License      *LicenseCheck      `json:"license"`
+	Files        *FilesCheck        `json:"files"`
+	Commits      *CommitsCheck      `json:"commits"`
+}
+
+// check is a built-in check. Checks register themselves from an init
+// function in their own file, and skip the repos they are not
+// configured for.
+type check struct {
+	name string
+	run  func(c Config, checks Checks, pr *github.PullRequest) error
+}
+
+var builtinChecks []check
+
+func registerCheck(name string, run func(c Config, checks Checks, pr *github.PullRequest) error) {
+	builtinChecks = append(builtinChecks, check{
+		name: name,
+		run:  run,
+	})
+}
+
+// checksFor returns the built-in checks configured for the repo, if any
+func (c Config) checksFor(repo string) *Checks {
+	for i := range c.Checks {
+		if c.Checks[i].Repo == repo {
+			return &c.Checks[i]
+		}
+	}
+	return nil
+}
+
+// runChecks runs the built-in checks configured for the repo, a failing
+// check does not stop the others or the builds
+func (c Config) runChecks(repo string, pr *github.PullRequest) {
+	for _, checks := range c.Checks {
+		if checks.Repo != repo {
+			continue
+		}
+
+		for _, ch := range builtinChecks {
+			if err := ch.run(c, checks, pr); err != nil {
+				log.Errorf("Running check %s for %s #%d failed: %v", ch.name, repo, pr.Number, err)
+			}
+		}
+	}
+}
+
+// matchesAny checks a file name against patterns, a pattern ending with
+// a slash matches everything under that directory, others are matched
+// with path.Match
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(name, pattern) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
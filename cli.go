@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"leeroy/events"
+	"leeroy/github"
+	"leeroy/messages"
+)
+
+// client talks to the endpoints of a running leeroy server
+type client struct {
+	url  string
+	user string
+	pass string
+}
+
+// stream reads the server-sent events of path until the server closes the
+// stream, calling fn for each of them
+func (c *client) stream(path string, fn func(events.Event)) error {
+	req, err := http.NewRequest("GET", c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.user, c.pass)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("GET %s responded with %s %s", path, resp.Status, b)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var e events.Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+			return err
+		}
+		fn(e)
+	}
+	return scanner.Err()
+}
+
+// clientFlags adds the flags shared by the client subcommands
+func clientFlags(fs *flag.FlagSet) *client {
+	c := &client{}
+	fs.StringVar(&c.url, "url", envOr("LEEROY_URL", "http://localhost"), "url of the leeroy server (LEEROY_URL)")
+	fs.StringVar(&c.user, "user", os.Getenv("LEEROY_USER"), "basic auth user (LEEROY_USER)")
+	fs.StringVar(&c.pass, "pass", os.Getenv("LEEROY_PASS"), "basic auth pass (LEEROY_PASS)")
+	return c
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// do sends a request to the server and decodes the response into v if
+// it is not nil
+func (c *client) do(method, path string, body, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.url+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.user, c.pass)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s responded with %s %s", method, path, resp.Status, b)
+	}
+	if v != nil {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+	return nil
+}
+
+// runCommand runs a subcommand other than serve
+func runCommand(cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	switch cmd {
+	case "trigger", "cancel":
+		c := clientFlags(fs)
+		var b requestBuild
+		fs.StringVar(&b.Repo, "repo", "", "repo of the pull request, eg. mantidproject/mantid")
+		fs.IntVar(&b.Number, "pr", 0, "number of the pull request")
+		fs.StringVar(&b.Context, "context", "", "context of the build, all of them when cancelling without one")
+		if cmd == "trigger" {
+			fs.StringVar(&b.Sha, "sha", "", "commit to build, of the pull request if --pr is given")
+			fs.StringVar(&b.Branch, "branch", "", "branch to build instead of a pull request")
+			fs.StringVar(&b.Profile, "profile", "", "profile whose parameters are added to the build")
+			fs.BoolVar(&b.WithDownstream, "with-downstream", false, "schedule the downstream builds once the build succeeds")
+		} else {
+			fs.StringVar(&b.Sha, "sha", "", "only cancel the builds of this commit")
+		}
+		fs.Parse(args)
+		if cmd == "trigger" && (b.Repo == "" || b.Context == "" || (b.Number == 0 && b.Sha == "" && b.Branch == "")) {
+			return fmt.Errorf("trigger needs --repo, --context and --pr, --sha or --branch")
+		}
+		if cmd == "cancel" && (b.Repo == "" || b.Number == 0) {
+			return fmt.Errorf("cancel needs --repo and --pr")
+		}
+
+		path := "/build/custom"
+		if cmd == "cancel" {
+			path = "/build/cancel"
+		}
+		return c.do("POST", path, b, nil)
+
+	case "status":
+		c := clientFlags(fs)
+		repo := fs.String("repo", "", "repo of the pull request, eg. mantidproject/mantid")
+		number := fs.Int("pr", 0, "number of the pull request")
+		fs.Parse(args)
+		if *repo == "" || *number == 0 {
+			return fmt.Errorf("status needs --repo and --pr")
+		}
+
+		var records []buildRecord
+		q := url.Values{"repo": {*repo}, "pr": {strconv.Itoa(*number)}}
+		if err := c.do("GET", "/build/status?"+q.Encode(), nil, &records); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CONTEXT\tSHA\tSTATE\tUPDATED\tURL")
+		for _, r := range records {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Context, shortSha(r.Sha), r.State, r.Updated.Format("2006-01-02 15:04"), r.URL)
+		}
+		return tw.Flush()
+
+	case "watch":
+		c := clientFlags(fs)
+		repo := fs.String("repo", "", "only the events of this repo, eg. mantidproject/mantid")
+		number := fs.Int("pr", 0, "only the events of this pull request, also given as the argument")
+		types := fs.String("type", "", "only the events of these comma separated types")
+		fs.Parse(args)
+		if fs.NArg() > 0 {
+			n, err := strconv.Atoi(fs.Arg(0))
+			if err != nil {
+				return fmt.Errorf("invalid pull request %q", fs.Arg(0))
+			}
+			*number = n
+		}
+
+		q := url.Values{}
+		if *repo != "" {
+			q.Set("repo", *repo)
+		}
+		if *number != 0 {
+			q.Set("pr", strconv.Itoa(*number))
+		}
+		if *types != "" {
+			q.Set("type", *types)
+		}
+		return c.stream("/events?"+q.Encode(), func(e events.Event) {
+			fmt.Printf("%s %-16s %s #%d %s %s %s %s\n", e.Time.Format("15:04:05"), e.Type, e.Repo, e.PR, e.Context, e.State, e.Description, e.URL)
+		})
+
+	case "onboard":
+		c := clientFlags(fs)
+		var b requestOnboard
+		fs.StringVar(&b.Repo, "repo", "", "repo to onboard, eg. mantidproject/mantid")
+		fs.BoolVar(&b.SkipVerify, "skip-verify", false, "do not schedule the builds on the default branch to verify them")
+		fs.Parse(args)
+		for _, arg := range fs.Args() {
+			parts := strings.SplitN(arg, "=", 2)
+			if len(parts) < 2 {
+				return fmt.Errorf("invalid build %q, expected context=job", arg)
+			}
+			b.Builds = append(b.Builds, Build{Context: parts[0], Job: parts[1]})
+		}
+		if b.Repo == "" || len(b.Builds) == 0 {
+			return fmt.Errorf("onboard needs --repo and the builds as context=job arguments")
+		}
+
+		var res onboardResult
+		if err := c.do("POST", "/admin/onboard", b, &res); err != nil {
+			return err
+		}
+		fmt.Printf("webhook: %s\n", res.Hook)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CONTEXT\tADDED\tVERIFIED\tERROR")
+		for _, b := range res.Builds {
+			fmt.Fprintf(tw, "%s\t%t\t%s\t%s\n", b.Context, b.Added, shortSha(b.Verified), b.Error)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if res.Restart {
+			fmt.Println("restart leeroy to build the added builds")
+		}
+		return nil
+
+	case "webhooks":
+		c := clientFlags(fs)
+		repo := fs.String("repo", "", "only check the webhook of this repo")
+		repair := fs.Bool("repair", false, "create or repair the webhooks found missing or different")
+		fs.Parse(args)
+
+		method, path := "GET", "/admin/webhooks"
+		if *repair {
+			method = "POST"
+		}
+		if *repo != "" {
+			path += "?repo=" + url.QueryEscape(*repo)
+		}
+		var checks []hookCheck
+		if err := c.do(method, path, nil, &checks); err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "REPO\tSTATUS\tPROBLEMS")
+		for _, check := range checks {
+			problems := strings.Join(check.Problems, ", ")
+			if check.Error != "" {
+				problems = check.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", check.Repo, check.Status, problems)
+		}
+		return tw.Flush()
+
+	case "export-state":
+		c := clientFlags(fs)
+		prefix := fs.String("prefix", "", "only export the keys starting with this, eg. build/")
+		out := fs.String("o", "", "file to write the archive to instead of stdout")
+		fs.Parse(args)
+
+		var archive stateArchive
+		path := "/admin/state"
+		if *prefix != "" {
+			path += "?prefix=" + url.QueryEscape(*prefix)
+		}
+		if err := c.do("GET", path, nil, &archive); err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(archive, "", "  ")
+		if err != nil {
+			return err
+		}
+		if *out == "" {
+			_, err = os.Stdout.Write(append(b, '\n'))
+			return err
+		}
+		if err := ioutil.WriteFile(*out, b, 0600); err != nil {
+			return err
+		}
+		for group, n := range archiveSummary(archive) {
+			fmt.Fprintf(os.Stderr, "%s: %d\n", group, n)
+		}
+		return nil
+
+	case "import-state":
+		c := clientFlags(fs)
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return fmt.Errorf("import-state needs the archive written by export-state")
+		}
+
+		b, err := ioutil.ReadFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		var archive stateArchive
+		if err := json.Unmarshal(b, &archive); err != nil {
+			return fmt.Errorf("error parsing %s as json: %v", fs.Arg(0), err)
+		}
+		var res map[string]int
+		if err := c.do("POST", "/admin/state", archive, &res); err != nil {
+			return err
+		}
+		fmt.Printf("imported %d keys\n", res["imported"])
+		return nil
+
+	case "bisect":
+		c := clientFlags(fs)
+		var b requestBisect
+		fs.StringVar(&b.Repo, "repo", "", "repo of the branch, eg. mantidproject/mantid")
+		fs.StringVar(&b.Branch, "branch", "", "the broken branch")
+		fs.StringVar(&b.Context, "context", "", "context of the broken build")
+		fs.StringVar(&b.Sha, "sha", "", "the broken commit, the head of the branch by default")
+		fs.StringVar(&b.Good, "good", "", "the green commit, the last one the build succeeded on by default")
+		fs.IntVar(&b.Concurrency, "concurrency", 1, "how many commits to build at once")
+		abort := fs.Bool("abort", false, "abort the bisection of the context")
+		fs.Parse(args)
+		if *abort {
+			if b.Repo == "" || b.Context == "" {
+				return fmt.Errorf("bisect --abort needs --repo and --context")
+			}
+			q := url.Values{"repo": {b.Repo}, "context": {b.Context}}
+			if err := c.do("DELETE", "/admin/bisect?"+q.Encode(), nil, nil); err != nil {
+				return err
+			}
+			fmt.Printf("Aborted the bisection of %s\n", b.Context)
+			return nil
+		}
+		if b.Repo == "" || b.Branch == "" || b.Context == "" {
+			return fmt.Errorf("bisect needs --repo, --branch and --context")
+		}
+
+		var res bisection
+		if err := c.do("POST", "/admin/bisect", b, &res); err != nil {
+			return err
+		}
+		if res.Culprit != "" {
+			fmt.Printf("%s is the first failing commit\n", res.Culprit)
+			return nil
+		}
+		fmt.Printf("Bisecting %d commits, building %d of them\n", res.Bad-res.Good, len(res.Round))
+		return nil
+
+	case "validate-config":
+		fs.Parse(args)
+		path := configFile
+		if fs.NArg() > 0 {
+			path = fs.Arg(0)
+		}
+
+		c, err := readConfig(path)
+		if err != nil {
+			return err
+		}
+		errs := c.validate()
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s has %d error(s)", path, len(errs))
+		}
+		fmt.Printf("%s is valid\n", path)
+		return nil
+
+	case "replay":
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return fmt.Errorf("replay needs the fixture files to replay")
+		}
+		return replay(fs.Args())
+	}
+
+	return fmt.Errorf("unknown command %q, use serve, trigger, cancel, status, watch, onboard, webhooks, export-state, import-state, bisect, validate-config or replay", cmd)
+}
+
+// validate returns the mistakes in the config which would only show up
+// once a pull request is built
+func (c Config) validate() (errs []error) {
+	seen := map[string]bool{}
+	for i, build := range c.Builds {
+		name := fmt.Sprintf("builds[%d] (%s %s)", i, build.Repo, build.Context)
+		if build.Repo == "" || build.Context == "" {
+			errs = append(errs, fmt.Errorf("%s: github_repo and context are required", name))
+		}
+		if seen[build.Repo+" "+build.Context] {
+			errs = append(errs, fmt.Errorf("%s: duplicate context", name))
+		}
+		seen[build.Repo+" "+build.Context] = true
+
+		switch build.Backend {
+		case "", "jenkins":
+			if build.Job == "" {
+				errs = append(errs, fmt.Errorf("%s: jenkins_job_name is required", name))
+			}
+		case "azure":
+			if build.AzurePipeline == 0 {
+				errs = append(errs, fmt.Errorf("%s: azure_pipeline_id is required", name))
+			}
+		case "webhook":
+			if build.WebhookURL == "" {
+				errs = append(errs, fmt.Errorf("%s: webhook_url is required", name))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown backend %q", name, build.Backend))
+		}
+
+		if build.AgentLabel != "" && build.Backend != "" && build.Backend != "jenkins" {
+			errs = append(errs, fmt.Errorf("%s: agent_label is only supported by jenkins builds", name))
+		}
+		if build.CheckParameters && build.Backend != "" && build.Backend != "jenkins" {
+			errs = append(errs, fmt.Errorf("%s: check_parameters is only supported by jenkins builds", name))
+		}
+		if len(build.FailurePatterns) > 0 && build.Backend != "" && build.Backend != "jenkins" {
+			errs = append(errs, fmt.Errorf("%s: failure_patterns are only supported by jenkins builds", name))
+		}
+		for _, p := range build.FailurePatterns {
+			if err := p.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+
+		switch build.BuildCommits {
+		case "", "all", "last", "new", "merge":
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown build_commits %q", name, build.BuildCommits))
+		}
+
+		if len(build.Paths) > 0 && !build.Downstream {
+			errs = append(errs, fmt.Errorf("%s: paths are only supported by downstream builds", name))
+		}
+		for _, downstream := range build.DownstreamBuilds {
+			if _, err := c.getBuildByContextAndRepo(downstream, build.Repo); err != nil {
+				errs = append(errs, fmt.Errorf("%s: downstream build %s does not exist", name, downstream))
+			}
+		}
+	}
+
+	switch c.BuildCommits {
+	case "", "all", "last", "new", "merge":
+	default:
+		errs = append(errs, fmt.Errorf("unknown build_commits %q", c.BuildCommits))
+	}
+
+	switch c.State.Backend {
+	case "", "memory", "redis":
+	default:
+		errs = append(errs, fmt.Errorf("unknown state backend %q", c.State.Backend))
+	}
+
+	for _, sweep := range c.Cron {
+		if sweep.Interval.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("cron sweep for %s (%s) needs an interval", sweep.Repo, sweep.Context))
+		}
+		if _, err := c.getBuildByContextAndRepo(sweep.Context, sweep.Repo); err != nil {
+			errs = append(errs, fmt.Errorf("cron sweep: %v", err))
+		}
+		if err := sweep.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("cron sweep for %s (%s): %v", sweep.Repo, sweep.Context, err))
+		}
+	}
+
+	profiles := map[string]bool{}
+	for _, p := range c.Profiles {
+		if p.Name == "" {
+			errs = append(errs, fmt.Errorf("profiles: name is required"))
+		}
+		if profiles[p.Name] {
+			errs = append(errs, fmt.Errorf("profiles: duplicate profile %q", p.Name))
+		}
+		profiles[p.Name] = true
+	}
+
+	for _, checks := range c.Checks {
+		if checks.License != nil {
+			if checks.License.Header == "" {
+				errs = append(errs, fmt.Errorf("license check for %s: header is required", checks.Repo))
+			} else if _, err := regexp.Compile(checks.License.Header); err != nil {
+				errs = append(errs, fmt.Errorf("license check for %s: invalid header: %v", checks.Repo, err))
+			}
+		}
+		if checks.Format == nil {
+			continue
+		}
+		if len(checks.Format.Sandbox) == 0 {
+			errs = append(errs, fmt.Errorf("format check for %s: sandbox is required", checks.Repo))
+		}
+		for _, f := range checks.Format.Formatters {
+			if len(f.Command) == 0 {
+				errs = append(errs, fmt.Errorf("format check for %s: command is required", checks.Repo))
+			}
+			if f.Language != "cpp" && f.Language != "python" {
+				errs = append(errs, fmt.Errorf("format check for %s: unknown language %q", checks.Repo, f.Language))
+			}
+		}
+	}
+
+	for _, l := range c.FastLanes {
+		for _, context := range l.Contexts {
+			if _, err := c.getBuildByContextAndRepo(context, l.Repo); err != nil {
+				errs = append(errs, fmt.Errorf("fast_lanes for %s: %v", l.Repo, err))
+			}
+		}
+	}
+
+	for _, s := range c.SubprojectBuilds {
+		for _, name := range s.Subprojects {
+			if c.subproject(name) == nil {
+				errs = append(errs, fmt.Errorf("subproject_builds for %s: unknown subproject %q", s.Repo, name))
+			}
+		}
+	}
+
+	if c.GHRetry != nil {
+		for _, class := range c.GHRetry.Retryable {
+			switch class {
+			case github.RetryNotFound, github.RetryServerError, github.RetryRateLimited, github.RetryNetwork:
+			default:
+				errs = append(errs, fmt.Errorf("github_retry: unknown retryable error %q", class))
+			}
+		}
+	}
+
+	if _, err := messages.Load(c.Messages); err != nil {
+		errs = append(errs, fmt.Errorf("messages: %v", err))
+	}
+
+	for _, err := range (github.Templates{Dir: c.CommentTemplates}).Validate() {
+		errs = append(errs, fmt.Errorf("comment_templates: %v", err))
+	}
+
+	for _, nc := range c.Notifiers {
+		switch nc.Type {
+		case "slack", "mattermost", "teams":
+		default:
+			errs = append(errs, fmt.Errorf("unknown notifier type %q", nc.Type))
+		}
+	}
+
+	for _, o := range c.OutboundWebhooks {
+		if o.URL == "" {
+			errs = append(errs, fmt.Errorf("outbound_webhooks: url is required"))
+		}
+		for _, t := range o.Events {
+			switch t {
+			case events.PRReceived, events.BuildScheduled, events.BuildCompleted, events.AuthDenied, events.TokenWarning, events.HandlerPanic:
+			default:
+				errs = append(errs, fmt.Errorf("outbound_webhooks: unknown event %q", t))
+			}
+		}
+	}
+
+	if c.MergeableWindow.Duration > maxMergeableWindow {
+		errs = append(errs, fmt.Errorf("mergeable_window: %s is above the limit of %s", c.MergeableWindow.Duration, maxMergeableWindow))
+	}
+
+	for _, w := range c.MaintenanceWindows {
+		if w.Duration.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("maintenance window %s needs a duration", w.Name))
+		}
+		if _, err := w.end(time.Now()); err != nil {
+			errs = append(errs, fmt.Errorf("maintenance window %s: %v", w.Name, err))
+		}
+	}
+
+	for action, role := range c.Permissions {
+		if _, ok := roleRanks[role]; !ok {
+			errs = append(errs, fmt.Errorf("permissions: unknown role %q for %s", role, action))
+		}
+		if _, ok := commands[action]; !ok && action != permApproveFork {
+			errs = append(errs, fmt.Errorf("permissions: unknown command %q", action))
+		}
+	}
+	if c.Permissions != nil && c.Roles == nil {
+		errs = append(errs, fmt.Errorf("permissions: roles are required"))
+	}
+	for _, p := range c.ForkApprovals {
+		if p.Team == "" && c.Roles == nil {
+			errs = append(errs, fmt.Errorf("fork_approvals for %s: team is required without roles", p.Repo))
+		}
+	}
+
+	for i, key := range c.APIKeys {
+		if key.Name == "" || key.Pass == "" {
+			errs = append(errs, fmt.Errorf("api_keys[%d]: name and pass are required", i))
+		}
+		if key.Name == c.User {
+			errs = append(errs, fmt.Errorf("api_keys[%d]: %s is the name of the user", i, key.Name))
+		}
+	}
+
+	if c.GHWebhook.Secret != "" && c.GHWebhook.URL == "" {
+		errs = append(errs, fmt.Errorf("github_webhook: the secret needs the url of the webhook"))
+	}
+
+	if a := c.BuildArchive; a.S3.Bucket != "" && a.S3.Endpoint == "" {
+		errs = append(errs, fmt.Errorf("build_archive: s3 needs an endpoint"))
+	}
+
+	if v := c.Secrets.Vault; v != nil && (v.Address == "" || v.Path == "") {
+		errs = append(errs, fmt.Errorf("secrets: vault needs an address and a path"))
+	}
+	if a := c.Secrets.AWS; a != nil && (a.Region == "" || a.SecretID == "") {
+		errs = append(errs, fmt.Errorf("secrets: aws needs a region and a secret_id"))
+	}
+	if g := c.Secrets.GCP; g != nil && (g.Project == "" || g.Secret == "") {
+		errs = append(errs, fmt.Errorf("secrets: gcp needs a project and a secret"))
+	}
+	sources := 0
+	for _, set := range []bool{c.Secrets.Vault != nil, c.Secrets.AWS != nil, c.Secrets.GCP != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		errs = append(errs, fmt.Errorf("secrets: only one of vault, aws and gcp can be set"))
+	}
+
+	if c.Metrics.Statsd != nil && c.Metrics.Statsd.Address == "" {
+		errs = append(errs, fmt.Errorf("metrics: statsd needs an address"))
+	}
+
+	if c.User == "" || c.Pass == "" {
+		errs = append(errs, fmt.Errorf("user and pass are required to protect the endpoints"))
+	}
+
+	return errs
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerCommand("test", testCommand)
+	// resumes the builds of stale pull requests, see StalePolicy
+	registerCommand("retest", testCommand)
+}
+
+// testCommand builds the pull request again, only the given contexts if
+// any. "profile=<name>" schedules the builds with the parameters of a
+// profile, eg. "/test linux profile=asan". Only the hold of stale pull
+// requests is overridden, pull requests from forks still need an approval
+// and gated builds their label or triage.
+func testCommand(c Config, cmd commentCommand) error {
+	var contexts []string
+	profile := ""
+	for _, arg := range cmd.Args {
+		if strings.HasPrefix(arg, "profile=") {
+			profile = strings.TrimPrefix(arg, "profile=")
+			continue
+		}
+		contexts = append(contexts, arg)
+	}
+
+	var builds []Build
+	if len(contexts) == 0 {
+		all, err := c.getBuilds(cmd.Repo, false)
+		if err != nil {
+			return err
+		}
+		for _, build := range all {
+			if !build.Downstream {
+				builds = append(builds, build)
+			}
+		}
+	}
+	for _, context := range contexts {
+		build, err := c.getBuildByContextAndRepo(context, cmd.Repo)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, build)
+	}
+
+	defer lockPR(cmd.Repo, cmd.Number)()
+	pr, err := c.loadPullRequest(cmd.Repo, cmd.Number)
+	if err != nil {
+		return err
+	}
+	extras, err := c.pullRequestExtras(pr)
+	if err != nil {
+		return err
+	}
+
+	for i, build := range builds {
+		build.Delivery = cmd.Delivery
+		if profile != "" {
+			if build, err = c.withProfile(build, profile); err != nil {
+				return err
+			}
+		}
+		builds[i] = c.manualRebuild(build)
+	}
+
+	h, err := c.scheduleUnlessHeld(cmd.Repo, pr, extras, builds, true)
+	if err != nil {
+		return err
+	}
+	if h.held() {
+		return fmt.Errorf("not building: %s", h.Reason)
+	}
+	return nil
+}
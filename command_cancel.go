@@ -0,0 +1,38 @@
+package main
+
+func init() {
+	registerCommand("cancel", cancelCommand)
+}
+
+// cancelCommand stops the running and queued builds of the head of the
+// pull request, only the ones of the given contexts if any
+func cancelCommand(c Config, cmd commentCommand) error {
+	var builds []Build
+	if len(cmd.Args) == 0 {
+		for _, build := range c.Builds {
+			if build.Repo == cmd.Repo {
+				builds = append(builds, build)
+			}
+		}
+	}
+	for _, context := range cmd.Args {
+		build, err := c.getBuildByContextAndRepo(context, cmd.Repo)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, build)
+	}
+
+	defer lockPR(cmd.Repo, cmd.Number)()
+	pr, err := c.loadPullRequest(cmd.Repo, cmd.Number)
+	if err != nil {
+		return err
+	}
+
+	for _, build := range builds {
+		if err := c.cancelBuild(build, cmd.Number, pr.Head.Sha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+)
+
+func init() {
+	registerCommand("update-branch", updateBranchCommand)
+}
+
+// updateBranchCommand brings the pull request up to date with its base
+// branch by merging it in, or rebasing with "/update-branch rebase". The
+// new head is then built like any other push.
+func updateBranchCommand(c Config, cmd commentCommand) error {
+	pr, err := c.loadPullRequest(cmd.Repo, cmd.Number)
+	if err != nil {
+		return err
+	}
+
+	g := c.githubClient()
+	switch {
+	case len(cmd.Args) == 0 || cmd.Args[0] == "merge":
+		return g.UpdateBranch(pr.Repo, cmd.Number, pr.Head.Sha)
+	case cmd.Args[0] == "rebase":
+		return g.RebaseBranch(pr.Repo, cmd.Number, pr.Head.Sha)
+	}
+	return fmt.Errorf("unknown update method %q, use merge or rebase", cmd.Args[0])
+}
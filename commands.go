@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+)
+
+// issueCommentHook holds the fields of issue_comment hooks leeroy uses
+type issueCommentHook struct {
+	Action string `json:"action"`
+	Issue  struct {
+		Number      int              `json:"number"`
+		PullRequest *json.RawMessage `json:"pull_request"`
+	} `json:"issue"`
+	Comment struct {
+		Id   int          `json:"id"`
+		Body string       `json:"body"`
+		User octokat.User `json:"user"`
+	} `json:"comment"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// commentCommand is a command like /update-branch given on its own line
+// of a pull request comment
+type commentCommand struct {
+	Repo   string
+	Number int
+	User   string
+	Name   string
+	Args   []string
+	// the GitHub delivery of the comment
+	Delivery string
+}
+
+// command runs a comment command. Only users allowed by the roles, or
+// with write access to the repo without roles, can run commands.
+type command func(c Config, cmd commentCommand) error
+
+var commands = map[string]command{}
+
+func registerCommand(name string, run command) {
+	commands[name] = run
+}
+
+// parseCommands returns the registered commands given in a comment
+func parseCommands(body string) (cmds []commentCommand) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+			continue
+		}
+
+		name := strings.TrimPrefix(fields[0], "/")
+		if _, ok := commands[name]; !ok {
+			continue
+		}
+		cmds = append(cmds, commentCommand{
+			Name: name,
+			Args: fields[1:],
+		})
+	}
+	return cmds
+}
+
+// commentHook runs the commands given in a new pull request comment
+func commentHook(w http.ResponseWriter, body []byte, delivery string) {
+	var hook issueCommentHook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing hook: %v", err))
+		return
+	}
+
+	// only new comments on pull requests, and never our own
+	if hook.Action != "created" || hook.Issue.PullRequest == nil || strings.EqualFold(hook.Comment.User.Login, config.GHUser) {
+		return
+	}
+
+	if len(parseCommands(hook.Comment.Body)) == 0 {
+		return
+	}
+
+	repoName := hook.Repository.FullName
+	number := hook.Issue.Number
+
+	if _, err := config.getBuilds(repoName, false); err != nil {
+		log.Debugf("Ignoring commands for unconfigured repo %s", repoName)
+		return
+	}
+
+	// githubHandler only verifies the deliveries once a secret is set,
+	// anyone could send the comment of a maintainer otherwise
+	if config.GHWebhook.Secret == "" {
+		log.Warnf("Ignoring the commands on %s #%d, set the github_webhook secret to run them", repoName, number)
+		return
+	}
+
+	g := config.githubClient()
+	r := strings.SplitN(repoName, "/", 2)
+	if len(r) < 2 {
+		log.Errorf("repo name could not be parsed: %s", repoName)
+		return
+	}
+	repo := octokat.Repo{
+		Name:     r[1],
+		UserName: r[0],
+	}
+
+	// the author and the commands are taken from the comment GitHub has
+	// rather than from the delivery
+	comment, err := g.IssueComment(repo, hook.Comment.Id)
+	if err != nil {
+		writeError(w, 502, errGitHub, err)
+		return
+	}
+	if !strings.HasSuffix(comment.IssueURL, fmt.Sprintf("/issues/%d", number)) {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Comment %d is not on %s #%d", hook.Comment.Id, repoName, number))
+		return
+	}
+	user := comment.User.Login
+	if strings.EqualFold(user, config.GHUser) {
+		return
+	}
+	cmds := parseCommands(comment.Body)
+
+	for _, cmd := range cmds {
+		allowed, err := config.allowed(repoName, user, cmd.Name)
+		if err != nil {
+			writeError(w, 502, errGitHub, err)
+			return
+		}
+
+		cmd.Repo, cmd.Number, cmd.User, cmd.Delivery = repoName, number, user, delivery
+		log.Infof("Running /%s from %s on %s #%d", cmd.Name, user, repoName, number)
+
+		reply := struct {
+			User    string
+			Command string
+			// the role needed for the command, "" without roles
+			Role  string
+			Error error
+		}{User: user, Command: cmd.Name}
+		if config.Roles != nil {
+			reply.Role = config.permission(cmd.Name)
+		}
+		template := ""
+		if !allowed {
+			template = github.CommandDeniedTemplate
+		} else if err := commands[cmd.Name](config, cmd); err != nil {
+			log.Errorf("Running /%s on %s #%d failed: %v", cmd.Name, repoName, number, err)
+			template, reply.Error = github.CommandFailedTemplate, err
+		}
+
+		if template != "" {
+			comment, err := g.Templates.Render(repo, template, reply)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if _, err := g.Client().AddComment(repo, strconv.Itoa(number), comment); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
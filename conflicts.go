@@ -0,0 +1,45 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+func init() {
+	registerPlugin("conflict-checks", func(c Config) bool {
+		return c.ConflictChecks.Duration > 0
+	}, func(c Config) error {
+		registerTask("conflict-checks", c.ConflictChecks.Duration, checkConflicts)
+		return nil
+	})
+}
+
+// checkConflicts reports the open pull requests which got conflicts after
+// their base branch moved on, and clears the reports of the pull requests
+// whose conflicts were fixed in the meantime
+func checkConflicts(c Config) {
+	g := c.githubClient()
+	for _, repo := range c.repos() {
+		nums, err := c.getOpenPRs(repo, "")
+		if err != nil {
+			log.Errorf("Checking %s for conflicts failed: %v", repo, err)
+			continue
+		}
+
+		for _, number := range nums {
+			pr, err := c.loadPullRequest(repo, number)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+
+			mergeable, err := g.ReportConflicts(pr)
+			if err != nil {
+				log.Errorf("Reporting the conflicts of %s #%d failed: %v", repo, number, err)
+				continue
+			}
+			if !mergeable {
+				log.Infof("%s #%d has conflicts with %s", repo, number, pr.Base.Ref)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"leeroy/events"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func init() {
+	registerPlugin("cooldown", func(c Config) bool {
+		for _, build := range c.Builds {
+			if build.Cooldown.Duration > 0 {
+				return true
+			}
+		}
+		return false
+	}, func(c Config) error {
+		events.Subscribe(events.BuildCompleted, func(e events.Event) {
+			c.startCooldown(e)
+		})
+		return nil
+	})
+}
+
+func cooldownKey(repo, context, sha string) string {
+	return fmt.Sprintf("cooldown/%s/%s/%s", repo, context, sha)
+}
+
+// startCooldown keeps the failed build of a commit from being scheduled
+// again automatically for the cooldown of its build
+func (c Config) startCooldown(e events.Event) {
+	if e.State != "failure" && e.State != "error" {
+		return
+	}
+	build, err := c.getBuildByContextAndRepo(e.Context, e.Repo)
+	if err != nil || build.Cooldown.Duration <= 0 {
+		return
+	}
+
+	until := time.Now().Add(build.Cooldown.Duration).UTC().Format(time.RFC3339)
+	if err := state.Set(cooldownKey(e.Repo, e.Context, e.Sha), []byte(until), build.Cooldown.Duration); err != nil {
+		log.Warnf("Starting the cooldown of %s for %s %s failed: %v", e.Context, e.Repo, e.Sha, err)
+	}
+}
+
+// coolingDown checks if the build of sha failed less than its cooldown
+// ago, the builds requested by users are not held back
+func (c Config) coolingDown(repo string, build Build, sha string) bool {
+	if build.Cooldown.Duration <= 0 || build.Manual {
+		return false
+	}
+
+	until, err := state.Get(cooldownKey(repo, build.Context, sha))
+	if err != nil {
+		return false
+	}
+	log.Infof("Not scheduling %s for %s %s, it failed recently and cools down until %s", build.Context, repo, sha, until)
+	return true
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+)
+
+// Deployment tracks the builds of some branches as GitHub deployments to
+// an environment, eg. the nightly packages built from main
+type Deployment struct {
+	// branch names or path.Match patterns, eg. "release-*"
+	Branches    []string `json:"branches"`
+	Environment string   `json:"environment"`
+}
+
+func deploymentKey(repo, sha, environment string) string {
+	return "deployment/" + repo + "/" + sha + "/" + environment
+}
+
+// branchName returns the branch of a GIT_BRANCH parameter, which the
+// Jenkins git plugin prefixes with the remote
+func branchName(ref string) string {
+	ref = strings.TrimPrefix(ref, "refs/heads/")
+	return strings.TrimPrefix(ref, "origin/")
+}
+
+// reportDeployments creates the deployments of the builds of branches
+// once they succeed
+func (c Config) reportDeployments(build Build, res buildResult) {
+	if res.PR != 0 || res.Branch == "" || !res.Completed || res.State != "success" {
+		return
+	}
+
+	r := strings.SplitN(res.Repo, "/", 2)
+	if len(r) < 2 {
+		return
+	}
+	repo := octokat.Repo{UserName: r[0], Name: r[1]}
+	g := c.githubClient()
+
+	for _, d := range build.Deployments {
+		if !matchesAny(res.Branch, d.Branches) {
+			continue
+		}
+
+		// a notification sent again does not deploy the sha twice
+		key := deploymentKey(res.Repo, res.Sha, d.Environment)
+		if _, err := state.Get(key); err == nil {
+			continue
+		}
+
+		id, err := g.CreateDeployment(repo, res.Sha, d.Environment, res.Description, map[string]string{
+			"job":     build.Job,
+			"context": build.Context,
+			"branch":  res.Branch,
+		})
+		if err != nil {
+			log.Errorf("Creating the %s deployment of %s %s failed: %v", d.Environment, res.Repo, res.Branch, err)
+			continue
+		}
+		if err := state.Set(key, []byte(strconv.FormatInt(id, 10)), buildRecordTTL); err != nil {
+			log.Errorf("Saving the %s deployment of %s %s failed: %v", d.Environment, res.Repo, res.Sha, err)
+		}
+		log.Infof("Created the %s deployment %d of %s %s (%s)", d.Environment, id, res.Repo, res.Branch, res.Sha)
+
+		if err := g.SetDeploymentStatus(repo, id, "success", res.URL, res.Description); err != nil {
+			log.Errorf("Updating the %s deployment of %s %s failed: %v", d.Environment, res.Repo, res.Branch, err)
+		}
+	}
+}
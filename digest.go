@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"leeroy/email"
+	"leeroy/events"
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	digestEventsKey = "digest/events"
+	// how long a build may stay pending before it is reported as stuck
+	stuckPendingAge = 24 * time.Hour
+	// the digest is sent on the first run of the task in the configured
+	// hour, later runs find it was already sent that day
+	digestInterval = 10 * time.Minute
+)
+
+// emailDigest sends a daily digest of the failed branch builds, the
+// builds stuck pending and the pull requests not allowed to build
+type emailDigest struct {
+	email.Client
+	// local hour the digest is sent at
+	Hour int `json:"hour"`
+}
+
+func init() {
+	registerPlugin("email-digest", func(c Config) bool {
+		return len(c.Email.To) > 0
+	}, func(c Config) error {
+		// the events happen on every instance, the leader sends them
+		for _, t := range []events.Type{events.BuildCompleted, events.AuthDenied} {
+			events.Subscribe(t, collectDigestEvent)
+		}
+		registerTask("email-digest", digestInterval, sendDigest)
+		return nil
+	})
+}
+
+// collectDigestEvent keeps the events which go in the next digest, only
+// the failures of builds of branches rather than pull requests are kept
+func collectDigestEvent(e events.Event) {
+	if e.Type == events.BuildCompleted && (e.PR != 0 || (e.State != "failure" && e.State != "error")) {
+		return
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Warnf("encoding digest event failed: %v", err)
+		return
+	}
+	if err := state.Push(digestEventsKey, b); err != nil {
+		log.Warnf("saving digest event failed: %v", err)
+	}
+}
+
+func sendDigest(c Config) {
+	now := time.Now()
+	if now.Hour() != c.Email.Hour {
+		return
+	}
+	sentKey := "digest/sent/" + now.Format("2006-01-02")
+	if _, err := state.Get(sentKey); err != store.ErrNotFound {
+		// already sent today, or the state is unavailable
+		return
+	}
+
+	// the events are popped into a batch, which goes back to the store
+	// if the digest could not be sent
+	var batch [][]byte
+	for {
+		b, err := state.Pop(digestEventsKey)
+		if err == store.ErrNotFound {
+			break
+		}
+		if err != nil {
+			log.Errorf("reading digest events failed: %v", err)
+			break
+		}
+		batch = append(batch, b)
+	}
+
+	var failed, denied []events.Event
+	seen := map[string]bool{}
+	for _, b := range batch {
+		var e events.Event
+		if err := json.Unmarshal(b, &e); err != nil {
+			log.Warnf("decoding digest event failed: %v", err)
+			continue
+		}
+		switch e.Type {
+		case events.BuildCompleted:
+			failed = append(failed, e)
+		case events.AuthDenied:
+			// reported again on every update of the pull request
+			key := fmt.Sprintf("%s#%d", e.Repo, e.PR)
+			if !seen[key] {
+				seen[key] = true
+				denied = append(denied, e)
+			}
+		}
+	}
+
+	var stuck []buildRecord
+	records, err := getBuildRecords("")
+	if err != nil {
+		log.Errorf("reading build records for the digest failed: %v", err)
+	}
+	for _, r := range records {
+		if r.State == "pending" && now.Sub(r.Updated) > stuckPendingAge {
+			stuck = append(stuck, r)
+		}
+	}
+
+	if len(failed) == 0 && len(stuck) == 0 && len(denied) == 0 {
+		log.Info("Nothing to report in the email digest")
+		markDigestSent(sentKey, now)
+		return
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Failed branch builds (%d):\n", len(failed))
+	for _, e := range failed {
+		fmt.Fprintf(&body, "- %s %s %s: %s %s\n", e.Repo, e.Sha, e.Context, e.Description, e.URL)
+	}
+	fmt.Fprintf(&body, "\nPull requests pending for more than %s (%d):\n", stuckPendingAge, len(stuck))
+	for _, r := range stuck {
+		fmt.Fprintf(&body, "- %s #%d %s since %s: %s\n", r.Repo, r.PR, r.Context, r.Updated.Format(time.RFC822), r.URL)
+	}
+	fmt.Fprintf(&body, "\nPull requests not allowed to build (%d):\n", len(denied))
+	for _, e := range denied {
+		fmt.Fprintf(&body, "- %s #%d: %s %s\n", e.Repo, e.PR, e.Description, e.URL)
+	}
+
+	subject := fmt.Sprintf("leeroy digest for %s", now.Format("2006-01-02"))
+	if err := c.Email.Send(subject, body.String()); err != nil {
+		log.Errorf("sending the email digest failed, it is retried on the next run: %v", err)
+		for _, b := range batch {
+			if err := state.Push(digestEventsKey, b); err != nil {
+				log.Errorf("restoring digest event failed: %v", err)
+			}
+		}
+		return
+	}
+	markDigestSent(sentKey, now)
+}
+
+// markDigestSent records the digest of the day was sent, so the later
+// runs of the hour skip it
+func markDigestSent(key string, now time.Time) {
+	if err := state.Set(key, []byte(now.Format(time.RFC3339)), 48*time.Hour); err != nil {
+		log.Errorf("saving the digest was sent failed: %v", err)
+	}
+}
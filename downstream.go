@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how long the files changed by the pull requests are kept for their
+// downstream builds
+const changedFilesTTL = 7 * 24 * time.Hour
+
+func changedFilesKey(repo, sha string) string {
+	return fmt.Sprintf("files/%s/%s", repo, sha)
+}
+
+// hasPathConditions reports whether some downstream builds of the repo
+// depend on the files changed
+func (c Config) hasPathConditions(repo string) bool {
+	for _, build := range c.Builds {
+		if build.Repo == repo && build.Downstream && len(build.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// saveChangedFiles keeps the files changed by the pull request for the
+// downstream builds scheduled once the builds of sha succeed, as the
+// notifications of the backends do not carry them
+func (c Config) saveChangedFiles(repo string, pr *github.PullRequest, sha string) {
+	if !c.hasPathConditions(repo) || pr.Content == nil {
+		return
+	}
+
+	files := []string{}
+	for _, f := range pr.Content.Files() {
+		files = append(files, f.FileName)
+	}
+	b, err := json.Marshal(files)
+	if err != nil {
+		log.Warnf("encoding the changed files failed: %v", err)
+		return
+	}
+	if err := state.Set(changedFilesKey(repo, sha), b, changedFilesTTL); err != nil {
+		log.Warnf("saving the files changed by %s #%d failed: %v", repo, pr.Number, err)
+	}
+}
+
+// changedFiles returns the files changed by the pull request built at
+// sha, read from GitHub if they were not saved when scheduling it
+func (c Config) changedFiles(repo string, number int, sha string) ([]string, error) {
+	var files []string
+	b, err := state.Get(changedFilesKey(repo, sha))
+	if err == nil {
+		return files, json.Unmarshal(b, &files)
+	}
+
+	pr, err := c.loadPullRequest(repo, number)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range pr.Content.Files() {
+		files = append(files, f.FileName)
+	}
+	return files, nil
+}
+
+// downstreamNeeded reports whether the downstream build has to run for
+// the build result, the builds of branches and commits always run it
+func (c Config) downstreamNeeded(build Build, res buildResult) bool {
+	if len(build.Paths) == 0 || res.PR == 0 {
+		return true
+	}
+
+	files, err := c.changedFiles(res.Repo, res.PR, res.Sha)
+	if err != nil {
+		log.Warnf("Getting the files changed by %s #%d failed, running %s: %v", res.Repo, res.PR, build.Context, err)
+		return true
+	}
+	for _, f := range files {
+		if matchesAny(f, build.Paths) {
+			return true
+		}
+	}
+
+	// no status, it would satisfy a required context without a build
+	log.Infof("Not scheduling %s for %s #%d, it changes nothing in %s", build.Context, res.Repo, res.PR, strings.Join(build.Paths, ", "))
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// the first line of the files encrypted with age
+const ageHeader = "age-encryption.org/v1"
+
+// decryptConfig returns the config file decrypted, or as is if it is not
+// encrypted. Files encrypted with age are decrypted with the identity in
+// LEEROY_AGE_KEY, the ones encrypted with sops by sops itself, which
+// reads its keys from the environment, eg. SOPS_AGE_KEY.
+func decryptConfig(path string, b []byte) ([]byte, error) {
+	switch {
+	case isAge(b):
+		return decryptAge(b)
+	case isSops(b):
+		return decryptWith(nil, "sops", "--decrypt", "--input-type", "json", "--output-type", "json", path)
+	}
+	return b, nil
+}
+
+// isAge checks for the header of the binary and armored age files
+func isAge(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(ageHeader)) ||
+		bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN AGE ENCRYPTED FILE-----"))
+}
+
+// isSops checks for the metadata sops adds to the files it encrypts
+func isSops(b []byte) bool {
+	var v struct {
+		Sops json.RawMessage `json:"sops"`
+	}
+	return json.Unmarshal(b, &v) == nil && len(v.Sops) > 0
+}
+
+func decryptAge(b []byte) ([]byte, error) {
+	key := os.Getenv("LEEROY_AGE_KEY")
+	if key == "" {
+		return nil, fmt.Errorf("the config file is encrypted with age but LEEROY_AGE_KEY is not set")
+	}
+
+	// age only reads the identities from files
+	f, err := ioutil.TempFile("", "leeroy-age-key")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(key + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	return decryptWith(b, "age", "--decrypt", "--identity", f.Name())
+}
+
+// decryptWith runs the decryption tool name with stdin and returns the
+// decrypted config
+func decryptWith(stdin []byte, name string, args ...string) ([]byte, error) {
+	out, err := execCommand(context.Background(), "", nil, stdin, append([]string{name}, args...))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting the config file with %s failed: %v", name, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// codes of the json error responses, so clients can tell the failures
+// apart without parsing the messages
+const (
+	errUnauthorized     = "unauthorized"
+	errForbidden        = "forbidden"
+	errMethodNotAllowed = "method_not_allowed"
+	errInvalidRequest   = "invalid_request"
+	errUnknownBuild     = "unknown_build"
+	errNotFound         = "not_found"
+	errHeld             = "held"
+	errBackend          = "backend_error"
+	errGitHub           = "github_error"
+	errInternal         = "internal_error"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// unknownBuildError is returned when no build is configured for a
+// context, job or pipeline
+type unknownBuildError string
+
+func (e unknownBuildError) Error() string {
+	return string(e)
+}
+
+// invalidRequestError is returned when a request cannot be carried out
+// as asked
+type invalidRequestError string
+
+func (e invalidRequestError) Error() string {
+	return string(e)
+}
+
+// backendError is returned when a build backend failed a request
+type backendError struct {
+	err error
+}
+
+func (e backendError) Error() string {
+	return e.err.Error()
+}
+
+func (e backendError) Cause() error {
+	return e.err
+}
+
+// githubError is returned when the GitHub API failed a request
+type githubError struct {
+	err error
+}
+
+func (e githubError) Error() string {
+	return e.err.Error()
+}
+
+func (e githubError) Cause() error {
+	return e.err
+}
+
+// writeError logs err and writes it as a json error response. Only the
+// first error of a request is written, the later ones are only logged.
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	if err == nil {
+		err = fmt.Errorf("%s", http.StatusText(status))
+	}
+	if status >= 500 {
+		log.Error(err)
+	} else {
+		log.Warn(err)
+	}
+
+	if sw, ok := w.(*statusWriter); ok && sw.wrote {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error: err.Error(),
+		Code:  code,
+	})
+}
+
+// writeFailure writes err with the status and code matching its cause.
+// The errors wrapped with errors.Wrap are unwrapped down to the first
+// known kind, errors.Cause itself would skip the githubError and
+// backendError which are causers too.
+func writeFailure(w http.ResponseWriter, err error) {
+	for cause := err; cause != nil; {
+		switch e := cause.(type) {
+		case unknownBuildError:
+			writeError(w, 404, errUnknownBuild, err)
+			return
+		case invalidRequestError:
+			writeError(w, 400, errInvalidRequest, err)
+			return
+		case backendError:
+			writeError(w, 502, errBackend, err)
+			return
+		case githubError:
+			if apiErr, ok := errors.Cause(e).(*github.Error); ok && apiErr.StatusCode == http.StatusNotFound {
+				writeError(w, 404, errNotFound, err)
+				return
+			}
+			writeError(w, 502, errGitHub, err)
+			return
+		}
+
+		c, ok := cause.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		cause = c.Cause()
+	}
+	writeError(w, 500, errInternal, err)
+}
@@ -0,0 +1,148 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Type is the kind of an event
+type Type string
+
+const (
+	// PRReceived is published when a pull request webhook is accepted
+	PRReceived Type = "pr_received"
+	// BuildScheduled is published when a build was sent to its backend
+	BuildScheduled Type = "build_scheduled"
+	// BuildCompleted is published when a backend reports a finished build
+	BuildCompleted Type = "build_completed"
+	// AuthDenied is published when a pull request is not allowed to run CI
+	AuthDenied Type = "auth_denied"
+	// TokenWarning is published when a GitHub token is about to expire
+	// or misses scopes
+	TokenWarning Type = "token_warning"
+	// HandlerPanic is published when an endpoint panicked handling a
+	// request
+	HandlerPanic Type = "handler_panic"
+)
+
+// Event describes something that happened to a pull request or build
+type Event struct {
+	Type        Type      `json:"type"`
+	Time        time.Time `json:"time"`
+	Repo        string    `json:"repo"`
+	PR          int       `json:"pr,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+	Sha         string    `json:"sha,omitempty"`
+	Context     string    `json:"context,omitempty"`
+	Job         string    `json:"job,omitempty"`
+	Number      int       `json:"number,omitempty"`
+	State       string    `json:"state,omitempty"`
+	Description string    `json:"description,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	// the GitHub delivery of the hook which scheduled the build
+	Delivery string `json:"delivery,omitempty"`
+	// the build failed because of the infrastructure rather than the code
+	Infrastructure bool `json:"infrastructure,omitempty"`
+}
+
+// Handler is called for every published event it subscribed to
+type Handler func(Event)
+
+// Bus dispatches published events to the subscribed handlers
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[Type][]Handler
+	all      []Handler
+	watchers map[chan Event]bool
+}
+
+// New returns an empty event bus
+func New() *Bus {
+	return &Bus{handlers: map[Type][]Handler{}, watchers: map[chan Event]bool{}}
+}
+
+// Subscribe registers h to be called for events of type t
+func (b *Bus) Subscribe(t Type, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[t] = append(b.handlers[t], h)
+}
+
+// SubscribeAll registers h to be called for every event
+func (b *Bus) SubscribeAll(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.all = append(b.all, h)
+}
+
+// Watch returns a channel receiving every event published from now on,
+// until stop is called. Events are dropped while the channel is full, so
+// slow watchers cannot hold up the publishers.
+func (b *Bus) Watch(size int) (watched <-chan Event, stop func()) {
+	c := make(chan Event, size)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.watchers[c] = true
+
+	return c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.watchers, c)
+	}
+}
+
+// Publish sends e to every handler subscribed to its type. Handlers run
+// in their own goroutine so slow subscribers don't hold up the caller.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := append(append([]Handler{}, b.handlers[e.Type]...), b.all...)
+	for c := range b.watchers {
+		select {
+		case c <- e:
+		default:
+			logrus.Warnf("Dropped %s event for %s #%d, a watcher is too slow", e.Type, e.Repo, e.PR)
+		}
+	}
+	b.mu.RUnlock()
+
+	logrus.Debugf("Publishing %s event for %s #%d", e.Type, e.Repo, e.PR)
+	for _, h := range handlers {
+		go func(h Handler) {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.Errorf("event handler for %s panicked: %v", e.Type, r)
+				}
+			}()
+			h(e)
+		}(h)
+	}
+}
+
+var defaultBus = New()
+
+// Subscribe registers h on the default bus
+func Subscribe(t Type, h Handler) {
+	defaultBus.Subscribe(t, h)
+}
+
+// SubscribeAll registers h for every event on the default bus
+func SubscribeAll(h Handler) {
+	defaultBus.SubscribeAll(h)
+}
+
+// Watch watches the events of the default bus
+func Watch(size int) (<-chan Event, func()) {
+	return defaultBus.Watch(size)
+}
+
+// Publish sends e to the handlers of the default bus
+func Publish(e Event) {
+	defaultBus.Publish(e)
+}
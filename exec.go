@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// execCommand runs args in dir, the working directory of leeroy if "",
+// with stdin and env, the environment of leeroy if nil, and returns its
+// output. The errors carry the standard error of the command.
+func execCommand(ctx context.Context, dir string, env []string, stdin []byte, args []string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if stderr.Len() == 0 {
+			return stdout.Bytes(), err
+		}
+		return stdout.Bytes(), errors.Wrap(err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
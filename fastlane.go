@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// FastLane only runs lightweight builds for the pull requests of members
+// changing nothing but trusted paths, eg. docs/ or .github/
+type FastLane struct {
+	Repo string `json:"github_repo"`
+	// prefixes ending with a slash or path.Match patterns, docs/ by default
+	Paths []string `json:"paths"`
+	// "org/team-slug" the author has to be in, by default the author needs
+	// write access to the repo
+	Team     string   `json:"team"`
+	Contexts []string `json:"contexts"`
+}
+
+// fastLane returns the fast lane rule of the repo, if any
+func (c Config) fastLane(repo string) *FastLane {
+	for i := range c.FastLanes {
+		if c.FastLanes[i].Repo == repo {
+			return &c.FastLanes[i]
+		}
+	}
+	return nil
+}
+
+// onlyChanges checks if the pull request only changes the trusted paths
+func (l FastLane) onlyChanges(pr *github.PullRequest) bool {
+	if len(l.Paths) == 0 {
+		return pr.Content.IsOnlyDocsChanges()
+	}
+
+	files := pr.Content.Files()
+	if len(files) == 0 {
+		return false
+	}
+	for _, f := range files {
+		if !matchesAny(f.FileName, l.Paths) {
+			return false
+		}
+	}
+	return true
+}
+
+// isMember checks if the author of the pull request is trusted by the
+// fast lane
+func (c Config) isMember(l FastLane, pr *github.PullRequest) (bool, error) {
+	if pr.User.Login == "" {
+		return false, nil
+	}
+
+	g := c.githubClient()
+	if l.Team == "" {
+		return g.CanWrite(pr.Repo, pr.User.Login)
+	}
+	t := strings.SplitN(l.Team, "/", 2)
+	if len(t) < 2 {
+		return false, fmt.Errorf("team could not be parsed: %s", l.Team)
+	}
+	return g.IsTeamMember(t[0], t[1], pr.User.Login)
+}
+
+// selectFastLaneBuilds returns the builds to run for the pull request.
+// When a member only changes the trusted paths, only the contexts of the
+// fast lane run and the other builds are reported as skipped so they do
+// not block merging.
+func (c Config) selectFastLaneBuilds(repo string, pr *github.PullRequest, builds []Build) ([]Build, bool) {
+	l := c.fastLane(repo)
+	if l == nil || !l.onlyChanges(pr) {
+		return builds, false
+	}
+
+	member, err := c.isMember(*l, pr)
+	if err != nil {
+		// better to run everything than to skip builds
+		log.Warnf("Checking if %s is a member for %s failed, running all the builds: %v", pr.User.Login, repo, err)
+		return builds, false
+	}
+	if !member {
+		return builds, false
+	}
+
+	log.Infof("%s #%d by %s only changes trusted paths", repo, pr.Number, pr.User.Login)
+	var selected []Build
+	for _, build := range builds {
+		if containsString(l.Contexts, build.Context) {
+			selected = append(selected, build)
+			continue
+		}
+		if build.Downstream {
+			continue
+		}
+		if err := c.updateGithubStatus(repo, build.Context, pr.Head.Sha, "success", msg(repo, "Skipped (docs-only)"), ""); err != nil {
+			log.Error(err)
+		}
+	}
+	return selected, true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// number of build results in a feed
+const feedSize = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+// feedHandler serves the latest build results of a repo from the build
+// records as an atom feed at /feed/{owner}/{name}.atom
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	repo := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/feed/"), ".atom")
+	if _, err := config.getBuilds(repo, false); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	records, err := getBuildRecords(repo + "/")
+	if err != nil {
+		writeError(w, 500, errInternal, fmt.Errorf("reading build records of %s failed: %v", repo, err))
+		return
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Updated.After(records[j].Updated)
+	})
+	if len(records) > feedSize {
+		records = records[:feedSize]
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	feed := atomFeed{
+		Title:   "leeroy builds of " + repo,
+		ID:      "urn:leeroy:feed:" + repo,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "leeroy"},
+		Links:   []atomLink{{Rel: "self", Href: scheme + "://" + r.Host + r.URL.Path}},
+	}
+	if len(records) > 0 {
+		feed.Updated = records[0].Updated.UTC().Format(time.RFC3339)
+	}
+
+	for _, record := range records {
+		entry := atomEntry{
+			Title:   fmt.Sprintf("%s %s on %s", record.Context, record.State, shortSha(record.Sha)),
+			ID:      fmt.Sprintf("urn:leeroy:build:%s:%s:%s:%d", repo, record.Sha, record.Context, record.Updated.Unix()),
+			Updated: record.Updated.UTC().Format(time.RFC3339),
+			Summary: record.Description,
+		}
+		if record.PR != 0 {
+			entry.Title = fmt.Sprintf("%s %s on #%d (%s)", record.Context, record.State, record.PR, shortSha(record.Sha))
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: fmt.Sprintf("https://github.com/%s/pull/%d", repo, record.PR)})
+		}
+		if record.URL != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "related", Href: record.URL})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		log.Errorf("encoding the feed of %s failed: %v", repo, err)
+	}
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
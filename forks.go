@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"leeroy/events"
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+const unauthorizedContext = "unauthorized"
+
+// ForkApproval holds the builds of pull requests from forks until
+// members of a team approved their head commit, so untrusted code is
+// always looked at by someone before it runs on the build machines
+type ForkApproval struct {
+	Repo string `json:"github_repo"`
+	// "org/team-slug", authors in the team do not need an approval.
+	// Without a team, the users allowed to "approve-fork" by the roles
+	// approve the builds.
+	Team      string `json:"team"`
+	Approvals int    `json:"approvals"`
+}
+
+// forkApproval returns the fork approval policy of the repo, if any
+func (c Config) forkApproval(repo string) *ForkApproval {
+	for i := range c.ForkApprovals {
+		if c.ForkApprovals[i].Repo == repo {
+			return &c.ForkApprovals[i]
+		}
+	}
+	return nil
+}
+
+// approvers returns the teams approving the builds, as mentioned in the
+// statuses and comments
+func (c Config) approvers(p ForkApproval) string {
+	if p.Team != "" || c.Roles == nil {
+		return p.Team
+	}
+	return strings.Join(c.Roles.teams(c.permission(permApproveFork)), " or @")
+}
+
+// isApproverTeam checks if the members of team approve the builds
+func (c Config) isApproverTeam(p ForkApproval, team string) bool {
+	if p.Team != "" || c.Roles == nil {
+		return strings.EqualFold(p.Team, team)
+	}
+	for _, t := range c.Roles.teams(c.permission(permApproveFork)) {
+		if strings.EqualFold(t, team) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFork checks if the head of the pull request is in another repo,
+// deleted forks count as forks
+func isFork(pr *github.PullRequest) bool {
+	return pr.Head.Repo == nil || pr.Head.Repo.FullName != pr.Base.Repo.FullName
+}
+
+// forkApproved checks if the head commit of a pull request from a fork
+// was approved by enough members of the team, recording the decisions
+func (c Config) forkApproved(p ForkApproval, pr *github.PullRequest) (bool, error) {
+	repo, sha, approvers := p.Repo, pr.Head.Sha, c.approvers(p)
+
+	g := c.githubClient()
+	isApprover := func(user string) (bool, error) {
+		return c.allowed(repo, user, permApproveFork)
+	}
+	if p.Team != "" {
+		t := strings.SplitN(p.Team, "/", 2)
+		if len(t) < 2 {
+			err := fmt.Errorf("team could not be parsed: %s", p.Team)
+			recordAuthorization(repo, pr.Number, sha, authMembership, false, err.Error())
+			return false, err
+		}
+		isApprover = func(user string) (bool, error) {
+			return g.IsTeamMember(t[0], t[1], user)
+		}
+	}
+
+	if pr.User.Login != "" {
+		member, err := isApprover(pr.User.Login)
+		if err != nil {
+			recordAuthorization(repo, pr.Number, sha, authMembership, false, fmt.Sprintf("checking if %s is in %s failed: %v", pr.User.Login, approvers, err))
+			return false, err
+		}
+		if member {
+			recordAuthorization(repo, pr.Number, sha, authMembership, true, fmt.Sprintf("%s is in %s", pr.User.Login, approvers))
+			return true, nil
+		}
+		recordAuthorization(repo, pr.Number, sha, authMembership, false, fmt.Sprintf("%s is not in %s", pr.User.Login, approvers))
+	}
+
+	users, err := g.Approvers(pr.Repo, pr.Number, pr.Head.Sha)
+	if err != nil {
+		recordAuthorization(repo, pr.Number, sha, authApproval, false, fmt.Sprintf("getting the approvals failed: %v", err))
+		return false, err
+	}
+
+	required := p.Approvals
+	if required <= 0 {
+		required = 1
+	}
+	approvals := 0
+	for _, user := range users {
+		member, err := isApprover(user)
+		if err != nil {
+			recordAuthorization(repo, pr.Number, sha, authApproval, false, fmt.Sprintf("checking if %s is in %s failed: %v", user, approvers, err))
+			return false, err
+		}
+		if member {
+			approvals++
+		}
+	}
+	approved := approvals >= required
+	recordAuthorization(repo, pr.Number, sha, authApproval, approved, fmt.Sprintf("%d of %d approvals from %s", approvals, required, approvers))
+	return approved, nil
+}
+
+// hold is why the builds of a pull request have to wait for a
+// maintainer, see holdReason
+type hold struct {
+	// shown in the pending statuses, "" if the builds can run
+	Reason string
+	// only held for being stale, which a /retest resumes
+	Stale bool
+	// the fork approval policy which applied to the pull request, and
+	// whether its head commit was approved
+	Fork     *ForkApproval
+	Approved bool
+}
+
+// held checks if the builds have to wait
+func (h hold) held() bool {
+	return h.Reason != ""
+}
+
+// holdReason returns why the builds of a pull request have to wait for
+// a maintainer. Builds gated by their own label or triage are checked
+// separately. Nothing is reported on the pull request, the callers
+// reporting the hook which opened or approved it call reportForkApproval.
+func (c Config) holdReason(repo string, pr *github.PullRequest, extras pullRequestHookExtras) (hold, error) {
+	if override := c.sizeOverride(repo, pr); override != "" {
+		if !extras.hasLabel(override) {
+			recordAuthorization(repo, pr.Number, pr.Head.Sha, authOverride, false, fmt.Sprintf("size/XL without the %q label", override))
+			return hold{Reason: msg(repo, "Large pull request, waiting for the %q label before building", override)}, nil
+		}
+		recordAuthorization(repo, pr.Number, pr.Head.Sha, authOverride, true, fmt.Sprintf("size/XL with the %q label", override))
+	}
+
+	if problem := c.commitsHold(repo, pr, extras); problem != "" {
+		return hold{Reason: msg(repo, "Waiting for a clean history before building: %s", problem)}, nil
+	}
+
+	var h hold
+	if p := c.forkApproval(repo); p != nil && isFork(pr) {
+		approved, err := c.forkApproved(*p, pr)
+		if err != nil {
+			return h, err
+		}
+		if !approved {
+			return hold{Reason: msg(repo, "Waiting for an approval from %s before building", c.approvers(*p)), Fork: p}, nil
+		}
+		h.Fork, h.Approved = p, true
+	}
+
+	// checked last, so a stale pull request resumed by a /retest is not
+	// held for anything else
+	if c.isStale(repo, pr) {
+		h.Reason, h.Stale = msg(repo, "CI paused for stale PR, comment /retest to resume"), true
+	}
+
+	return h, nil
+}
+
+// reportForkApproval fails the unauthorized status of a pull request from
+// a fork and asks for an approval while it waits for one, and clears the
+// status once it was approved
+func (c Config) reportForkApproval(repo string, pr *github.PullRequest, h hold) {
+	if h.Fork == nil {
+		return
+	}
+
+	if !h.Approved {
+		events.Publish(events.Event{
+			Type:        events.AuthDenied,
+			Repo:        repo,
+			PR:          pr.Number,
+			Sha:         pr.Head.Sha,
+			Description: "waiting for an approval from " + c.approvers(*h.Fork),
+			URL:         pr.HtmlURL,
+		})
+		if err := c.markUnauthorized(repo, pr, c.approvers(*h.Fork)); err != nil {
+			log.Errorf("Reporting %s #%d as unauthorized failed: %v", repo, pr.Number, err)
+		}
+		return
+	}
+
+	if err := c.markAuthorized(repo, pr); err != nil {
+		log.Errorf("Clearing the unauthorized statuses of %s #%d failed: %v", repo, pr.Number, err)
+	}
+}
+
+// markUnauthorized fails the unauthorized status of the head commit of a
+// pull request from a fork and asks the team for an approval
+func (c Config) markUnauthorized(repo string, pr *github.PullRequest, team string) error {
+	if err := c.updateGithubStatus(repo, c.context(unauthorizedContext), pr.Head.Sha, "failure", msg(repo, "Waiting for an approval from %s", team), pr.HtmlURL); err != nil {
+		return err
+	}
+	return c.githubClient().AddUnauthorizedComment(pr, team)
+}
+
+// markAuthorized overrides the failed unauthorized statuses of all the
+// commits of a pull request once it was approved, and removes the
+// comment asking for an approval
+func (c Config) markAuthorized(repo string, pr *github.PullRequest) error {
+	g := c.githubClient()
+
+	// only pull requests which were denied have the comment
+	if !g.HasUnauthorizedComment(pr) {
+		return nil
+	}
+
+	context := c.context(unauthorizedContext)
+	for _, commit := range pr.Content.Commits() {
+		statuses, err := g.CombinedStatuses(pr.Repo, commit.Sha)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.Context != context || status.State != "failure" {
+				continue
+			}
+			if err := c.updateGithubStatus(repo, context, commit.Sha, "success", msg(repo, "Approved for building"), pr.HtmlURL); err != nil {
+				return err
+			}
+		}
+	}
+
+	// removed last, so the statuses are cleared again if this failed
+	if err := g.RemoveUnauthorizedComment(pr); err != nil {
+		return err
+	}
+
+	log.Infof("Cleared the unauthorized statuses of %s #%d", repo, pr.Number)
+	return nil
+}
+
+// reviewHookPayload holds the fields of pull_request_review hooks leeroy uses
+type reviewHookPayload struct {
+	Action string `json:"action"`
+	Review struct {
+		State    string       `json:"state"`
+		CommitID string       `json:"commit_id"`
+		User     octokat.User `json:"user"`
+	} `json:"review"`
+	PullRequest struct {
+		Number int `json:"number"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// reviewHook updates the review status and builds pull requests from
+// forks once they were approved
+func reviewHook(w http.ResponseWriter, body []byte, delivery string) {
+	var hook reviewHookPayload
+	if err := json.Unmarshal(body, &hook); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing hook: %v", err))
+		return
+	}
+
+	repo := hook.Repository.FullName
+
+	// submitted and dismissed reviews change the review status
+	if checks := config.checksFor(repo); checks != nil && checks.Review != nil && (hook.Action == "submitted" || hook.Action == "dismissed") {
+		pr, err := config.loadPullRequest(repo, hook.PullRequest.Number)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		if err := checkReview(config, *checks, pr); err != nil {
+			log.Errorf("Updating the review status of %s #%d failed: %v", repo, pr.Number, err)
+		}
+	}
+
+	if hook.Action != "submitted" || !strings.EqualFold(hook.Review.State, "approved") || config.forkApproval(repo) == nil {
+		return
+	}
+
+	var extras pullRequestHookExtras
+	if err := json.Unmarshal(body, &extras); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing hook: %v", err))
+		return
+	}
+	extras.Delivery = delivery
+
+	pr, err := config.loadPullRequest(repo, hook.PullRequest.Number)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if !isFork(pr) || hook.Review.CommitID != pr.Head.Sha {
+		return
+	}
+
+	log.Infof("%s #%d was approved by %s", repo, pr.Number, hook.Review.User.Login)
+	h, err := config.rebuildUnlessHeld(repo, pr, extras)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	config.reportForkApproval(repo, pr, h)
+}
+
+// membershipHookPayload holds the fields of membership hooks leeroy uses,
+// they are only sent by organization webhooks
+type membershipHookPayload struct {
+	Action string       `json:"action"`
+	Member octokat.User `json:"member"`
+	Team   struct {
+		Slug string `json:"slug"`
+	} `json:"team"`
+	Organization struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+}
+
+// membershipHook builds the open pull requests from forks of users who
+// were just added to a team allowed to build them
+func membershipHook(w http.ResponseWriter, body []byte) {
+	var hook membershipHookPayload
+	if err := json.Unmarshal(body, &hook); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing hook: %v", err))
+		return
+	}
+	if hook.Action != "added" {
+		return
+	}
+
+	team := hook.Organization.Login + "/" + hook.Team.Slug
+	user := hook.Member.Login
+	for _, p := range config.ForkApprovals {
+		if !config.isApproverTeam(p, team) {
+			continue
+		}
+
+		log.Infof("%s was added to %s, building their pull requests to %s", user, team, p.Repo)
+		if err := config.buildMemberPRs(p.Repo, user); err != nil {
+			writeFailure(w, err)
+		}
+	}
+}
+
+// buildMemberPRs builds the open pull requests from forks of a user
+// waiting for an approval
+func (c Config) buildMemberPRs(repoName, user string) error {
+	r := strings.SplitN(repoName, "/", 2)
+	if len(r) < 2 {
+		return fmt.Errorf("repo name could not be parsed: %s", repoName)
+	}
+	repo := octokat.Repo{
+		Name:     r[1],
+		UserName: r[0],
+	}
+
+	prs, err := c.githubClient().PullRequests(repo, "open")
+	if err != nil {
+		return githubError{errors.Wrapf(err, "requesting open pull requests for %s failed", repoName)}
+	}
+
+	for _, listed := range prs {
+		if !strings.EqualFold(listed.User.Login, user) {
+			continue
+		}
+
+		pr, err := c.loadPullRequest(repoName, listed.Number)
+		if err != nil {
+			return err
+		}
+		if !isFork(pr) {
+			continue
+		}
+		h, err := c.rebuildUnlessHeld(repoName, pr, listedExtras(listed))
+		if err != nil {
+			return err
+		}
+		c.reportForkApproval(repoName, pr, h)
+	}
+	return nil
+}
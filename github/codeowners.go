@@ -0,0 +1,146 @@
+package github
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// where GitHub looks for the CODEOWNERS file, in order
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// CodeOwners are the rules of a CODEOWNERS file, the last matching rule
+// of a path gives its owners
+type CodeOwners []CodeOwnersRule
+
+// CodeOwnersRule gives the owners of the paths matching a pattern
+type CodeOwnersRule struct {
+	Pattern string
+	Owners  []string
+	re      *regexp.Regexp
+}
+
+// ParseCodeOwners parses the content of a CODEOWNERS file, invalid
+// lines are skipped like GitHub does
+func ParseCodeOwners(content string) (owners CodeOwners) {
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		re, err := regexp.Compile(codeOwnersRegexp(fields[0]))
+		if err != nil {
+			continue
+		}
+		owners = append(owners, CodeOwnersRule{
+			Pattern: fields[0],
+			Owners:  fields[1:],
+			re:      re,
+		})
+	}
+	return owners
+}
+
+// codeOwnersRegexp converts a gitignore style pattern to a regexp
+// matching the paths it covers
+func codeOwnersRegexp(pattern string) string {
+	// patterns with a slash before their end are relative to the root
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.Trim(pattern, "/")
+
+	var re strings.Builder
+	if anchored {
+		re.WriteString("^")
+	} else {
+		re.WriteString("^(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// a directory covers everything under it, but "docs/*" only
+	// covers the files directly in docs
+	if strings.HasSuffix(pattern, "*") {
+		re.WriteString("$")
+	} else {
+		re.WriteString("(/.*)?$")
+	}
+	return re.String()
+}
+
+// Owners returns the owners of a path, "@user", "@org/team" or emails
+func (c CodeOwners) Owners(path string) []string {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].re.MatchString(path) {
+			return c[i].Owners
+		}
+	}
+	return nil
+}
+
+// GetCodeOwners returns the CODEOWNERS rules of a repo at ref, or no
+// rules if it does not have the file
+func (g GitHub) GetCodeOwners(repo octokat.Repo, ref string) (CodeOwners, error) {
+	for _, path := range codeOwnersPaths {
+		content, err := g.FileContent(repo, path, ref)
+		if err != nil {
+			if apiErr, ok := errors.Cause(err).(*Error); ok && apiErr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, errors.Wrap(err, "CODEOWNERS")
+		}
+		return ParseCodeOwners(string(content)), nil
+	}
+
+	return nil, nil
+}
+
+// IsCodeOwner checks if a user owns any of the files changed by the pull
+// request, directly or through a team
+func (g GitHub) IsCodeOwner(pr *PullRequest, owners CodeOwners, user string) (bool, error) {
+	seen := map[string]bool{}
+	for _, f := range pr.Content.Files() {
+		for _, owner := range owners.Owners(f.FileName) {
+			if seen[owner] || !strings.HasPrefix(owner, "@") {
+				continue
+			}
+			seen[owner] = true
+
+			name := strings.TrimPrefix(owner, "@")
+			t := strings.SplitN(name, "/", 2)
+			if len(t) < 2 {
+				if strings.EqualFold(name, user) {
+					return true, nil
+				}
+				continue
+			}
+
+			member, err := g.IsTeamMember(t[0], t[1], user)
+			if err != nil {
+				return false, err
+			}
+			if member {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -1,39 +1,101 @@
 package github
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/crosbymichael/octokat"
 )
 
-func (g GitHub) addDCOUnsignedComment(repo octokat.Repo, pr *PullRequest, content *PullRequestContent) error {
-	comment := `Please sign your commits following these rules:
-https://github.com/docker/docker/blob/master/CONTRIBUTING.md#sign-your-work
-The easiest way to do this is to amend the last commit:
-~~~console
-`
-	comment += fmt.Sprintf("$ git clone -b %q %s %s\n", pr.Head.Ref, pr.Head.Repo.CloneURL, "somewhere")
-	comment += "$ cd somewhere\n"
+func (g GitHub) addDCOUnsignedComment(repo octokat.Repo, pr *PullRequest, content *PullRequestContent, unsigned []Commit) error {
+	comment, err := g.renderComment(repo, DCOTemplate, dcoComment, struct {
+		PR       *PullRequest
+		Unsigned []Commit
+	}{pr, unsigned})
+	if err != nil {
+		return err
+	}
+
+	// replace the comment when the unsigned commits changed
+	return g.replaceComment(repo, pr.Number, comment, dcoComment, content)
+}
 
-	if pr.Commits > 1 {
-		comment += fmt.Sprintf("$ git rebase -i HEAD~%d\n", pr.Commits)
-		comment += "editor opens\nchange each 'pick' to 'edit'\nsave the file and quit\n"
+// dcoComment marks the comment listing the unsigned commits
+const dcoComment = "sign your commits"
+
+// unauthorizedComment marks the comment on pull requests from forks which
+// wait for an approval
+const unauthorizedComment = "needs an approval"
+
+// AddUnauthorizedComment tells the author of a pull request from a fork
+// that it is only built once members of the team approved it
+func (g GitHub) AddUnauthorizedComment(pr *PullRequest, team string) error {
+	comment, err := g.renderComment(pr.Repo, UnauthorizedTemplate, unauthorizedComment, struct {
+		PR   *PullRequest
+		Team string
+	}{pr, team})
+	if err != nil {
+		return err
 	}
+	return g.addUniqueComment(pr.Repo, strconv.Itoa(pr.Number), comment, unauthorizedComment, pr.Content)
+}
+
+// HasUnauthorizedComment checks if the pull request was commented on as
+// waiting for an approval
+func (g GitHub) HasUnauthorizedComment(pr *PullRequest) bool {
+	return pr.Content.AlreadyCommented(unauthorizedComment, g.User)
+}
+
+// RemoveUnauthorizedComment removes the comment once the pull request
+// was approved
+func (g GitHub) RemoveUnauthorizedComment(pr *PullRequest) error {
+	return g.removeComment(pr.Repo, unauthorizedComment, pr.Content)
+}
+
+// formatComment marks the comment with the patch fixing the formatting
+const formatComment = "fix the formatting"
 
-	comment += "$ git commit --amend -s --no-edit\n"
-	if pr.Commits > 1 {
-		comment += "$ git rebase --continue # and repeat the amend for each commit\n"
+// AddFormatComment asks the author of a pull request to apply the patch
+// of the formatters, replacing the previous patch
+func (g GitHub) AddFormatComment(pr *PullRequest, formatters, patch string, truncated bool) error {
+	comment, err := g.renderComment(pr.Repo, FormatTemplate, formatComment, struct {
+		PR         *PullRequest
+		Formatters string
+		Patch      string
+		Truncated  bool
+	}{pr, formatters, patch, truncated})
+	if err != nil {
+		return err
 	}
+	return g.replaceComment(pr.Repo, pr.Number, comment, formatComment, pr.Content)
+}
+
+// RemoveFormatComment removes the patch once the formatting was fixed
+func (g GitHub) RemoveFormatComment(pr *PullRequest) error {
+	return g.removeComment(pr.Repo, formatComment, pr.Content)
+}
 
-	comment += "$ git push -f\n"
-	comment += `~~~
+// licenseComment marks the comment listing the files without the license
+// header
+const licenseComment = "missing the license header"
 
-Amending updates the existing PR. You **DO NOT** need to open a new one.
-`
+// AddLicenseComment lists the files of a pull request without the
+// license header, replacing the previous list
+func (g GitHub) AddLicenseComment(pr *PullRequest, header string, files []string) error {
+	comment, err := g.renderComment(pr.Repo, LicenseTemplate, licenseComment, struct {
+		PR     *PullRequest
+		Header string
+		Files  []string
+	}{pr, header, files})
+	if err != nil {
+		return err
+	}
+	return g.replaceComment(pr.Repo, pr.Number, comment, licenseComment, pr.Content)
+}
 
-	return g.addUniqueComment(repo, strconv.Itoa(pr.Number), comment, "sign your commits", content)
+// RemoveLicenseComment removes the list once the headers were added
+func (g GitHub) RemoveLicenseComment(pr *PullRequest) error {
+	return g.removeComment(pr.Repo, licenseComment, pr.Content)
 }
 
 func (g GitHub) removeComment(repo octokat.Repo, commentType string, content *PullRequestContent) error {
@@ -44,6 +106,22 @@ func (g GitHub) removeComment(repo octokat.Repo, commentType string, content *Pu
 	return nil
 }
 
+// replaceComment adds the comment, replacing the previous comment of the
+// same type unless it is the same
+func (g GitHub) replaceComment(repo octokat.Repo, number int, comment, commentType string, content *PullRequestContent) error {
+	if c := content.FindComment(commentType, g.User); c != nil {
+		if c.Body == comment {
+			return nil
+		}
+		if err := g.Client().RemoveComment(repo, c.Id); err != nil {
+			return err
+		}
+	}
+
+	_, err := g.Client().AddComment(repo, strconv.Itoa(number), comment)
+	return err
+}
+
 func (g GitHub) addUniqueComment(repo octokat.Repo, prNum, comment, commentType string, content *PullRequestContent) error {
 	// check if we already made the comment
 	if content.AlreadyCommented(commentType, g.User) {
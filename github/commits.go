@@ -0,0 +1,22 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// CommitSha resolves a branch, tag or (abbreviated) sha of a repo to
+// the full sha of the commit
+func (g GitHub) CommitSha(repo octokat.Repo, ref string) (string, error) {
+	var commit struct {
+		Sha string `json:"sha"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/commits/%s", APIURL, repo.UserName, repo.Name, url.PathEscape(ref))
+	if _, err := g.do("GET", u, nil, &commit); err != nil {
+		return "", errors.Wrapf(err, "commit %s", ref)
+	}
+	return commit.Sha, nil
+}
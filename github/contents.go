@@ -0,0 +1,41 @@
+package github
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// FileContent returns the content of the file of a repo at ref
+func (g GitHub) FileContent(repo octokat.Repo, path, ref string) ([]byte, error) {
+	var file struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", APIURL, repo.UserName, repo.Name, escapePath(path), url.QueryEscape(ref))
+	if _, err := g.do("GET", u, nil, &file); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	if file.Encoding != "base64" {
+		return nil, fmt.Errorf("%s: unsupported encoding %q", path, file.Encoding)
+	}
+
+	content, err := base64.StdEncoding.DecodeString(strings.Replace(file.Content, "\n", "", -1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "decoding %s", path)
+	}
+	return content, nil
+}
+
+// escapePath escapes each segment of a path of the repo
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
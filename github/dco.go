@@ -0,0 +1,32 @@
+package github
+
+import (
+	"regexp"
+)
+
+var signedOffRegexp = regexp.MustCompile(`(?m)^Signed-off-by: ([^<]+) <([^<>@]+@[^<>]+)>\s*$`)
+
+// UnsignedCommits returns the commits of the pull request without a
+// Signed-off-by trailer. Commits verified by GitHub count as signed when
+// allowVerified is set.
+func (p *PullRequestContent) UnsignedCommits(allowVerified bool) (unsigned []Commit) {
+	for _, c := range p.commits {
+		if allowVerified && c.Commit.Verification.Verified {
+			continue
+		}
+		if !signedOffRegexp.MatchString(c.Commit.Message) {
+			unsigned = append(unsigned, c)
+		}
+	}
+	return unsigned
+}
+
+// CheckSignedOff comments on the pull request with the commits missing
+// a Signed-off-by trailer, or removes the comment once they are all
+// signed
+func (g GitHub) CheckSignedOff(pr *PullRequest, unsigned []Commit) error {
+	if len(unsigned) > 0 {
+		return g.addDCOUnsignedComment(pr.Repo, pr, pr.Content, unsigned)
+	}
+	return g.removeComment(pr.Repo, dcoComment, pr.Content)
+}
@@ -0,0 +1,45 @@
+package github
+
+import (
+	"fmt"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// CreateDeployment creates a deployment of the sha to the environment and
+// returns its id. The deployment does not wait for the statuses of the
+// sha, it is created once leeroy knows they succeeded.
+func (g GitHub) CreateDeployment(repo octokat.Repo, sha, environment, description string, payload interface{}) (int64, error) {
+	body := map[string]interface{}{
+		"ref":               sha,
+		"environment":       environment,
+		"description":       description,
+		"auto_merge":        false,
+		"required_contexts": []string{},
+		"payload":           payload,
+	}
+	var deployment struct {
+		ID int64 `json:"id"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/deployments", APIURL, repo.UserName, repo.Name)
+	if _, err := g.do("POST", u, body, &deployment); err != nil {
+		return 0, errors.Wrapf(err, "creating the %s deployment of %s", environment, sha)
+	}
+	return deployment.ID, nil
+}
+
+// SetDeploymentStatus sets the state of a deployment: "in_progress",
+// "success", "failure" or "error"
+func (g GitHub) SetDeploymentStatus(repo octokat.Repo, id int64, state, logURL, description string) error {
+	body := map[string]string{
+		"state":       state,
+		"log_url":     logURL,
+		"description": description,
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/deployments/%d/statuses", APIURL, repo.UserName, repo.Name, id)
+	if _, err := g.do("POST", u, body, nil); err != nil {
+		return errors.Wrapf(err, "setting the status of deployment %d", id)
+	}
+	return nil
+}
@@ -3,6 +3,9 @@ package github
 import (
 	"net/http"
 	"os"
+	"time"
+
+	"leeroy/messages"
 
 	"github.com/crosbymichael/octokat"
 	"github.com/gregjones/httpcache"
@@ -12,25 +15,57 @@ import (
 // GitHub holds the client information for connecting to the GitHub API
 type GitHub struct {
 	AuthToken string
-	User      string
+	// rotates the requests between several tokens instead of AuthToken
+	Tokens *TokenPool
+	User   string
+	// namespaces the status contexts reported by leeroy itself
+	ContextPrefix string
+	// retries the reads of the API, DefaultRetryPolicy if nil
+	Retry *RetryPolicy
+	// how long to wait for GitHub to compute if a pull request is mergeable
+	MergeableWindow time.Duration
+	// renders the comments
+	Templates Templates
+	// translates the status descriptions, English if nil
+	Messages *messages.Catalog
+	// answers the requests changing anything with an empty success
+	// instead of sending them, eg. for the canary config
+	ReadOnly bool
+	// skips writing the statuses which did not change, see SetStatus
+	StatusCache StatusCache
 }
 
 // Client initializes the authorization with the GitHub API
 func (g GitHub) Client() *octokat.Client {
+	c := &http.Client{Transport: g.transport()}
+
+	gh := octokat.NewClient()
+	gh = gh.WithToken(g.AuthToken)
+	gh = gh.WithHTTPClient(c)
+	return gh
+}
+
+func (g GitHub) transport() http.RoundTripper {
 	var cache httpcache.Cache
 	if cachePath := os.Getenv("GITHUB_CACHE_PATH"); cachePath != "" {
 		cache = diskcache.New(cachePath)
 	} else {
 		cache = httpcache.NewMemoryCache()
 	}
-	tr := httpcache.NewTransport(cache)
-
-	c := &http.Client{Transport: tr}
+	t := httpcache.NewTransport(cache)
+	t.Transport = healthTransport{base: http.DefaultTransport}
+	if g.Tokens != nil {
+		t.Transport = poolTransport{pool: g.Tokens, base: t.Transport}
+	}
+	if g.ReadOnly {
+		return readOnlyTransport{base: t}
+	}
+	return t
+}
 
-	gh := octokat.NewClient()
-	gh = gh.WithToken(g.AuthToken)
-	gh = gh.WithHTTPClient(c)
-	return gh
+// fullName returns the "owner/name" of the repo
+func fullName(repo octokat.Repo) string {
+	return repo.UserName + "/" + repo.Name
 }
 
 func nameWithOwner(repo *octokat.Repository) octokat.Repo {
@@ -0,0 +1,115 @@
+package github
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// consecutive failed or slow responses starting an outage
+	outageFailures = 10
+	slowResponse   = 20 * time.Second
+)
+
+// ErrOutage is returned for the writes while the GitHub API is down
+var ErrOutage = errors.New("GitHub API is down, writes are paused")
+
+// IsOutage checks if err is ErrOutage, the clients wrap it
+func IsOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	cause := errors.Cause(err)
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = urlErr.Err
+	}
+	// octokat only keeps the message
+	return cause == ErrOutage || strings.Contains(err.Error(), ErrOutage.Error())
+}
+
+// health tracks the responses of the GitHub API of all the clients, an
+// outage starts with a series of server errors, network errors or slow
+// responses and ends with the first good response
+var health struct {
+	sync.Mutex
+	failures int
+	// start of the outage, zero while the API is healthy
+	since time.Time
+	// writes not sent during the outage
+	paused int
+}
+
+// Outage returns since when the GitHub API is down, if it is
+func Outage() (time.Time, bool) {
+	health.Lock()
+	defer health.Unlock()
+	return health.since, !health.since.IsZero()
+}
+
+// Degraded checks if the last responses of the GitHub API failed, eg.
+// the write which just failed
+func Degraded() bool {
+	health.Lock()
+	defer health.Unlock()
+	return health.failures > 0
+}
+
+func recordResponse(resp *http.Response, err error, elapsed time.Duration) {
+	health.Lock()
+	defer health.Unlock()
+
+	if err == nil && resp.StatusCode < 500 && elapsed < slowResponse {
+		if !health.since.IsZero() {
+			logrus.Warnf("GitHub API recovered after %s, %d writes were paused", time.Since(health.since).Round(time.Second), health.paused)
+		}
+		health.failures, health.since, health.paused = 0, time.Time{}, 0
+		return
+	}
+
+	health.failures++
+	if health.failures == outageFailures {
+		health.since = time.Now()
+		logrus.Warnf("GitHub API looks down after %d failed or slow responses, pausing the writes until it recovers", outageFailures)
+	}
+}
+
+// healthTransport records the health of the API and fails the writes
+// fast during outages
+type healthTransport struct {
+	base http.RoundTripper
+}
+
+func (t healthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		health.Lock()
+		down := !health.since.IsZero()
+		if down {
+			health.paused++
+		}
+		health.Unlock()
+		if down {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, ErrOutage
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	recordResponse(resp, err, time.Since(start))
+	return resp, err
+}
+
+// Ping requests the rate limits, which do not count against them, so
+// the end of an outage is noticed without other requests
+func (g GitHub) Ping() error {
+	_, err := g.do("GET", APIURL+"/rate_limit", nil, nil)
+	return err
+}
@@ -0,0 +1,84 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// Hook is a webhook of a repo
+type Hook struct {
+	ID     int64      `json:"id,omitempty"`
+	Name   string     `json:"name"`
+	Active bool       `json:"active"`
+	Events []string   `json:"events"`
+	Config HookConfig `json:"config"`
+}
+
+// HookConfig is where and how a webhook delivers the events. GitHub
+// never returns the secret, only "********" when one is set.
+type HookConfig struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Secret      string `json:"secret,omitempty"`
+	InsecureSSL string `json:"insecure_ssl,omitempty"`
+}
+
+// Hooks returns the webhooks of a repo
+func (g GitHub) Hooks(repo octokat.Repo) ([]Hook, error) {
+	var hooks []Hook
+	url := fmt.Sprintf("%s/repos/%s/%s/hooks?per_page=100", APIURL, repo.UserName, repo.Name)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var h []Hook
+		if err := json.Unmarshal(page, &h); err != nil {
+			return err
+		}
+		hooks = append(hooks, h...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "hooks")
+	}
+	return hooks, nil
+}
+
+// CreateHook adds a webhook to a repo and returns its id
+func (g GitHub) CreateHook(repo octokat.Repo, hook Hook) (int64, error) {
+	var created Hook
+	url := fmt.Sprintf("%s/repos/%s/%s/hooks", APIURL, repo.UserName, repo.Name)
+	if _, err := g.do("POST", url, hook, &created); err != nil {
+		return 0, errors.Wrapf(err, "creating the hook to %s", hook.Config.URL)
+	}
+	return created.ID, nil
+}
+
+// EditHook replaces the events and config of a webhook of a repo
+func (g GitHub) EditHook(repo octokat.Repo, id int64, hook Hook) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/hooks/%d", APIURL, repo.UserName, repo.Name, id)
+	if _, err := g.do("PATCH", url, hook, nil); err != nil {
+		return errors.Wrapf(err, "editing hook %d", id)
+	}
+	return nil
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header of a delivery
+// against the secret of the webhook
+func VerifySignature(secret, signature string, body []byte) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// Sign returns the X-Hub-Signature-256 header of a delivery of body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"fmt"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// CreateIssue opens an issue with the labels and returns its number
+func (g GitHub) CreateIssue(repo octokat.Repo, title, body string, labels []string) (int, error) {
+	var issue struct {
+		Number int `json:"number"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/issues", APIURL, repo.UserName, repo.Name)
+	req := map[string]interface{}{
+		"title":  title,
+		"body":   body,
+		"labels": labels,
+	}
+	if _, err := g.do("POST", u, req, &issue); err != nil {
+		return 0, errors.Wrapf(err, "creating issue %q", title)
+	}
+	return issue.Number, nil
+}
+
+// Issue holds the fields of the issue of a pull request which its hooks
+// carry but the pull request itself does not
+type Issue struct {
+	Labels    []Label    `json:"labels"`
+	Milestone *Milestone `json:"milestone"`
+}
+
+// Issue returns the issue of an issue/pull request
+func (g GitHub) Issue(repo octokat.Repo, number int) (*Issue, error) {
+	var issue Issue
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d", APIURL, repo.UserName, repo.Name, number)
+	if _, err := g.do("GET", u, nil, &issue); err != nil {
+		return nil, errors.Wrapf(err, "getting issue #%d", number)
+	}
+	return &issue, nil
+}
+
+// CommentIssue adds a comment to an issue or pull request
+func (g GitHub) CommentIssue(repo octokat.Repo, number int, body string) error {
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments", APIURL, repo.UserName, repo.Name, number)
+	if _, err := g.do("POST", u, map[string]string{"body": body}, nil); err != nil {
+		return errors.Wrapf(err, "commenting on #%d", number)
+	}
+	return nil
+}
+
+// CloseIssue closes an issue
+func (g GitHub) CloseIssue(repo octokat.Repo, number int) error {
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d", APIURL, repo.UserName, repo.Name, number)
+	if _, err := g.do("PATCH", u, map[string]string{"state": "closed"}, nil); err != nil {
+		return errors.Wrapf(err, "closing #%d", number)
+	}
+	return nil
+}
+
+// CompareCommits returns the commits reachable from head but not from
+// base, oldest first
+func (g GitHub) CompareCommits(repo octokat.Repo, base, head string) ([]Commit, error) {
+	var comparison struct {
+		Commits []Commit `json:"commits"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", APIURL, repo.UserName, repo.Name, base, head)
+	if _, err := g.do("GET", u, nil, &comparison); err != nil {
+		return nil, errors.Wrapf(err, "comparing %s...%s", base, head)
+	}
+	return comparison.Commits, nil
+}
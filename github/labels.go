@@ -0,0 +1,48 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// Label is a label of an issue/pull request
+type Label struct {
+	Name string `json:"name"`
+}
+
+// Milestone is the milestone of an issue/pull request
+type Milestone struct {
+	Title string `json:"title"`
+}
+
+// Labels returns the labels of an issue/pull request
+func (g GitHub) Labels(repo octokat.Repo, number int) ([]Label, error) {
+	var labels []Label
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d/labels?per_page=100", APIURL, repo.UserName, repo.Name, number)
+	if _, err := g.do("GET", u, nil, &labels); err != nil {
+		return nil, errors.Wrap(err, "labels")
+	}
+	return labels, nil
+}
+
+// AddLabels adds labels to an issue/pull request
+func (g GitHub) AddLabels(repo octokat.Repo, number int, labels ...string) error {
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d/labels", APIURL, repo.UserName, repo.Name, number)
+	body := map[string][]string{"labels": labels}
+	if _, err := g.do("POST", u, body, nil); err != nil {
+		return errors.Wrap(err, "adding labels")
+	}
+	return nil
+}
+
+// RemoveLabel removes a label from an issue/pull request
+func (g GitHub) RemoveLabel(repo octokat.Repo, number int, label string) error {
+	u := fmt.Sprintf("%s/repos/%s/%s/issues/%d/labels/%s", APIURL, repo.UserName, repo.Name, number, url.PathEscape(label))
+	if _, err := g.do("DELETE", u, nil, nil); err != nil {
+		return errors.Wrap(err, "removing label")
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// Review is a review of a pull request
+type Review struct {
+	User     octokat.User `json:"user"`
+	State    string       `json:"state"`
+	CommitID string       `json:"commit_id"`
+}
+
+// Reviews returns all the reviews of a pull request, oldest first
+func (g GitHub) Reviews(repo octokat.Repo, number int) ([]Review, error) {
+	var reviews []Review
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/reviews?per_page=100", APIURL, repo.UserName, repo.Name, number)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var r []Review
+		if err := json.Unmarshal(page, &r); err != nil {
+			return err
+		}
+		reviews = append(reviews, r...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "reviews")
+	}
+
+	return reviews, nil
+}
+
+// Approvals returns the number of reviewers whose latest review approves
+// the pull request, and whether any reviewer still requests changes
+func (g GitHub) Approvals(repo octokat.Repo, number int) (approvals int, changesRequested bool, err error) {
+	reviews, err := g.Reviews(repo, number)
+	if err != nil {
+		return 0, false, err
+	}
+
+	latest := map[string]string{}
+	for _, r := range reviews {
+		// comments do not change the verdict of a reviewer
+		if r.State == "COMMENTED" || r.State == "PENDING" {
+			continue
+		}
+		latest[r.User.Login] = r.State
+	}
+
+	for _, state := range latest {
+		switch state {
+		case "APPROVED":
+			approvals++
+		case "CHANGES_REQUESTED":
+			changesRequested = true
+		}
+	}
+	return approvals, changesRequested, nil
+}
+
+// Approvers returns the reviewers whose latest review approves the
+// commit sha of the pull request
+func (g GitHub) Approvers(repo octokat.Repo, number int, sha string) ([]string, error) {
+	reviews, err := g.Reviews(repo, number)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]Review{}
+	for _, r := range reviews {
+		if r.State == "COMMENTED" || r.State == "PENDING" {
+			continue
+		}
+		latest[r.User.Login] = r
+	}
+
+	var approvers []string
+	for user, r := range latest {
+		if r.State == "APPROVED" && r.CommitID == sha {
+			approvers = append(approvers, user)
+		}
+	}
+	return approvers, nil
+}
+
+// MergeableState returns GitHub's mergeable_state of a pull request, eg.
+// "clean", "behind", "dirty", "blocked" or "unknown" while it is computed
+func (g GitHub) MergeableState(repo octokat.Repo, number int) (string, error) {
+	var pr struct {
+		MergeableState string `json:"mergeable_state"`
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", APIURL, repo.UserName, repo.Name, number)
+	if _, err := g.do("GET", url, nil, &pr); err != nil {
+		return "", errors.Wrapf(err, "pull request %d", number)
+	}
+	return pr.MergeableState, nil
+}
+
+// UpdateBranch merges the base branch into the head of a pull request.
+// The update fails if the head is no longer sha.
+func (g GitHub) UpdateBranch(repo octokat.Repo, number int, sha string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/update-branch", APIURL, repo.UserName, repo.Name, number)
+	body := map[string]string{"expected_head_sha": sha}
+	if _, err := g.do("PUT", url, body, nil); err != nil {
+		return errors.Wrapf(err, "updating the branch of pull request %d", number)
+	}
+	return nil
+}
+
+// RebaseBranch rebases the head of a pull request on its base branch.
+// The update fails if the head is no longer sha.
+func (g GitHub) RebaseBranch(repo octokat.Repo, number int, sha string) error {
+	var pr struct {
+		NodeID string `json:"node_id"`
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", APIURL, repo.UserName, repo.Name, number)
+	if _, err := g.do("GET", url, nil, &pr); err != nil {
+		return errors.Wrapf(err, "pull request %d", number)
+	}
+
+	// the REST endpoint can only merge, rebasing needs GraphQL
+	query := map[string]interface{}{
+		"query": `mutation($id: ID!, $sha: GitObjectID!) {
+  updatePullRequestBranch(input: {pullRequestId: $id, expectedHeadOid: $sha, updateMethod: REBASE}) {
+    pullRequest { id }
+  }
+}`,
+		"variables": map[string]string{"id": pr.NodeID, "sha": sha},
+	}
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := g.do("POST", APIURL+"/graphql", query, &resp); err != nil {
+		return errors.Wrapf(err, "rebasing the branch of pull request %d", number)
+	}
+	if len(resp.Errors) > 0 {
+		return errors.Wrapf(&Error{Message: resp.Errors[0].Message}, "rebasing the branch of pull request %d", number)
+	}
+	return nil
+}
+
+// MergeRejected reports whether GitHub refused a merge or a branch update
+// for good, eg. because of the branch protection or the merge method,
+// rather than failing in a way worth retrying. A head which changed
+// since is not a refusal, the new head is built and merged instead.
+func MergeRejected(err error) bool {
+	cause, ok := errors.Cause(err).(*Error)
+	if !ok || errorClass(err) != "" {
+		return false
+	}
+	return cause.StatusCode >= 400 && cause.StatusCode < 500 && cause.StatusCode != 409
+}
+
+// Merge merges a pull request with method ("merge", "squash" or
+// "rebase"). The merge fails if the head is no longer sha.
+func (g GitHub) Merge(repo octokat.Repo, number int, sha, method string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/merge", APIURL, repo.UserName, repo.Name, number)
+	body := map[string]string{"sha": sha, "merge_method": method}
+	if _, err := g.do("PUT", url, body, nil); err != nil {
+		return errors.Wrapf(err, "merging pull request %d", number)
+	}
+	return nil
+}
@@ -1,48 +1,102 @@
 package github
 
 import (
-	"strconv"
+	"fmt"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
 )
 
+// mergeableContext is the status reported on pull requests with conflicts
+const mergeableContext = "mergeability"
+
 // IsMergeable makes sure the pull request can be merged
 func (g GitHub) IsMergeable(pr *PullRequest) (mergeable bool, err error) {
-	// assume the PR is mergable unless we specifically set to false
-	// because mergable true is equivalent to skip
-	mergeable = true
-
 	// we only want the prs that are opened/synchronized
 	if !pr.Hook.IsOpened() && !pr.Hook.IsSynchronize() {
-		return mergeable, nil
+		return true, nil
+	}
+
+	return g.ReportConflicts(pr)
+}
+
+// ReportConflicts fails the mergeability status of a pull request with
+// conflicts and asks its author to rebase, or clears both once the
+// conflicts were fixed. It reports whether the pull request is mergeable,
+// which it is assumed to be if GitHub did not compute it in time.
+func (g GitHub) ReportConflicts(pr *PullRequest) (mergeable bool, err error) {
+	// GitHub computes the merge in the background after a push
+	if err := g.pollMergeable(pr); err != nil {
+		return true, err
 	}
 
 	commentType := "merge conflicts"
 	if !isMergeable(pr) {
-		mergeable = false
-		logrus.Debugf("Found pr %d was not mergable, going to add comment", pr.Hook.Number)
+		logrus.Debugf("Found pr %d was not mergable, going to add comment", pr.Number)
 
-		// add a comment
-		comment := "Looks like we would not be able to merge this PR because of merge conflicts. Please fix conflicts, and push to your branch."
-		if err := g.addUniqueComment(pr.Repo, strconv.Itoa(pr.Hook.Number), comment, commentType, pr.Content); err != nil {
-			return mergeable, err
+		// add a comment, or update it if the base changed
+		comment, err := g.renderComment(pr.Repo, ConflictsTemplate, commentType, struct {
+			PR *PullRequest
+		}{pr})
+		if err != nil {
+			return false, err
+		}
+		if err := g.replaceComment(pr.Repo, pr.Number, comment, commentType, pr.Content); err != nil {
+			return false, err
 		}
 
 		// set the status
-		// TODO for context do we want "mantid/is-mergable" or something else?
-		if err := g.failureStatus(pr.Repo, pr.Head.Sha, "mantid/is-mergable", "This PR is not mergable, please fix conflicts.", "https://github.com/mantidproject/mantid/pulls/"); err != nil {
-			return mergeable, err
+		if err := g.failureStatus(pr.Repo, pr.Head.Sha, g.ContextPrefix+mergeableContext, g.Messages.Sprintf(fullName(pr.Repo), "Conflicts with %s, please rebase and fix them", pr.Base.Ref), pr.HtmlURL); err != nil {
+			return false, err
 		}
 
-		return mergeable, nil
+		return false, nil
 	}
 
 	// otherwise try to find the comment and remove it
 	if err := g.removeComment(pr.Repo, commentType, pr.Content); err != nil {
-		return mergeable, err
+		return true, err
 	}
 
-	return mergeable, nil
+	// and clear our status if the pr had conflicts
+	found, err := g.HasStatus(pr, pr.Head.Sha, g.ContextPrefix+mergeableContext)
+	if err != nil {
+		return true, err
+	}
+	if found {
+		if err := g.successStatus(pr.Repo, pr.Head.Sha, g.ContextPrefix+mergeableContext, g.Messages.Sprintf(fullName(pr.Repo), "The conflicts were fixed")); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// pollMergeable requests the pull request again while GitHub is still
+// computing whether it is mergeable, for up to the client's
+// MergeableWindow. It stays unknown if the window runs out.
+func (g GitHub) pollMergeable(pr *PullRequest) error {
+	deadline := time.Now().Add(g.MergeableWindow)
+	delay := time.Second
+	for pr.Mergeable == nil && time.Now().Add(delay).Before(deadline) {
+		time.Sleep(delay)
+		delay *= 2
+
+		var polled struct {
+			Mergeable *bool `json:"mergeable"`
+		}
+		url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", APIURL, pr.Repo.UserName, pr.Repo.Name, pr.Number)
+		if _, err := g.do("GET", url, nil, &polled); err != nil {
+			return errors.Wrapf(err, "pull request %d", pr.Number)
+		}
+		pr.Mergeable = polled.Mergeable
+	}
+
+	if pr.Mergeable == nil {
+		logrus.Infof("GitHub did not compute whether %s #%d is mergeable in time, building it anyway", pr.Repo, pr.Number)
+	}
+	return nil
 }
 
 func isMergeable(pr *PullRequest) bool {
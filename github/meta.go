@@ -0,0 +1,17 @@
+package github
+
+import (
+	"github.com/pkg/errors"
+)
+
+// HookRanges returns the CIDR ranges GitHub sends webhooks from, as
+// published by the meta API
+func (g GitHub) HookRanges() ([]string, error) {
+	var meta struct {
+		Hooks []string `json:"hooks"`
+	}
+	if _, err := g.do("GET", APIURL+"/meta", nil, &meta); err != nil {
+		return nil, errors.Wrap(err, "meta")
+	}
+	return meta.Hooks, nil
+}
@@ -0,0 +1,38 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// Permission returns the permission of a user on a repo: "admin",
+// "maintain", "write", "triage", "read" or "none"
+func (g GitHub) Permission(repo octokat.Repo, user string) (string, error) {
+	var perm struct {
+		Permission string `json:"permission"`
+		RoleName   string `json:"role_name"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/collaborators/%s/permission", APIURL, repo.UserName, repo.Name, url.PathEscape(user))
+	if _, err := g.do("GET", u, nil, &perm); err != nil {
+		return "", errors.Wrapf(err, "permission of %s", user)
+	}
+
+	// the legacy permission reports maintain as write and triage as read
+	switch perm.RoleName {
+	case "maintain", "triage":
+		return perm.RoleName, nil
+	}
+	return perm.Permission, nil
+}
+
+// CanWrite checks if a user can push to a repo
+func (g GitHub) CanWrite(repo octokat.Repo, user string) (bool, error) {
+	perm, err := g.Permission(repo, user)
+	if err != nil {
+		return false, err
+	}
+	return perm == "admin" || perm == "maintain" || perm == "write", nil
+}
@@ -1,8 +1,11 @@
 package github
 
 import (
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/crosbymichael/octokat"
 	"github.com/pkg/errors"
@@ -34,13 +37,87 @@ func (g GitHub) LoadPullRequest(hook *octokat.PullRequestHook) (*PullRequest, er
 	}, nil
 }
 
+// Commit describes a commit of a pull request
+type Commit struct {
+	Sha    string `json:"sha"`
+	Commit struct {
+		Message   string `json:"message"`
+		Committer struct {
+			Date time.Time `json:"date"`
+		} `json:"committer"`
+		Verification struct {
+			Verified bool `json:"verified"`
+		} `json:"verification"`
+	} `json:"commit"`
+}
+
+// GetPullRequest fetches a pull request by number and converts it to the
+// PullRequest type. The Hook is left empty.
+func (g GitHub) GetPullRequest(repo octokat.Repo, number int) (*PullRequest, error) {
+	var pr *octokat.PullRequest
+	err := g.retry(func() (err error) {
+		pr, err = g.Client().PullRequest(repo, strconv.Itoa(number), &octokat.Options{})
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "pull request %d", number)
+	}
+
+	content, err := g.GetContent(repo, number, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PullRequest{
+		Repo:        repo,
+		Content:     content,
+		PullRequest: pr,
+	}, nil
+}
+
 // PullRequestContent contains the files, commits, and comments for a given
 // pull request
 type PullRequestContent struct {
 	id       int
 	files    []*octokat.PullRequestFile
-	commits  []octokat.Commit
+	commits  []Commit
 	comments []octokat.Comment
+
+	// statuses of the commits, fetched on demand
+	statuses map[string][]octokat.Status
+}
+
+// Commits returns the commits of the pull request.
+func (p *PullRequestContent) Commits() []Commit {
+	return p.commits
+}
+
+// Files returns the files changed by the pull request.
+func (p *PullRequestContent) Files() []*octokat.PullRequestFile {
+	return p.files
+}
+
+// ChangedLines returns the number of lines added and deleted by the
+// pull request.
+func (p *PullRequestContent) ChangedLines() (lines int) {
+	for _, f := range p.files {
+		lines += f.Additions + f.Deletions
+	}
+	return lines
+}
+
+// LastActivity returns when the head commit was committed or someone
+// other than user last commented, whichever is later.
+func (p *PullRequestContent) LastActivity(user string) (last time.Time) {
+	if len(p.commits) > 0 {
+		last = p.commits[len(p.commits)-1].Commit.Committer.Date
+	}
+	for _, c := range p.comments {
+		if !strings.EqualFold(c.User.Login, user) && c.UpdatedAt.After(last) {
+			last = c.UpdatedAt
+		}
+	}
+	return last
 }
 
 // HasDocsChanges checks for docs changes.
@@ -59,30 +136,41 @@ func (p *PullRequestContent) IsOnlyDocsChanges() bool {
 	return true
 }
 
-// This can be used to check skipping clang format and
-// CPP check
-func (p *PullRequestContent) hasCppFiles() bool {
+// IsCppFile checks if the file is C or C++ source or header
+func IsCppFile(name string) bool {
+	return hasAny(strings.HasSuffix, name, ".cpp", ".cxx", ".cc", "c++", ".c", ".tpp", ".txx", ".h", ".hpp", ".hxx")
+}
+
+// IsPythonFile checks if the file is Python source
+func IsPythonFile(name string) bool {
+	return hasAny(strings.HasSuffix, name, ".py")
+}
+
+// HasCppFiles checks if the pull request changes C or C++ files, eg. to
+// skip clang-format
+func (p *PullRequestContent) HasCppFiles() bool {
 	if len(p.files) == 0 {
 		return false
 	}
 
 	// if there are any changed files not in docs/man/experimental dirs
 	for _, f := range p.files {
-		if hasAny(strings.HasSuffix, f.FileName, ".cpp", ".cxx", ".cc", "c++", ".c", ".tpp", ".txx", ".h", ".hpp", ".hxx") {
+		if IsCppFile(f.FileName) {
 			return true
 		}
 	}
 	return false
 }
 
-func (p *PullRequestContent) containsPythonFiles() bool {
+// ContainsPythonFiles checks if the pull request changes Python files
+func (p *PullRequestContent) ContainsPythonFiles() bool {
 	if len(p.files) == 0 {
 		return false
 	}
 
 	// if there are any changed files not in docs/man/experimental dirs
 	for _, f := range p.files {
-		if hasAny(strings.HasSuffix, f.FileName, ".py") {
+		if IsPythonFile(f.FileName) {
 			return true
 		}
 	}
@@ -114,28 +202,23 @@ func (p *PullRequestContent) AlreadyCommented(commentType, user string) bool {
 func (g *GitHub) GetContent(repo octokat.Repo, id int, isPR bool) (*PullRequestContent, error) {
 	var (
 		files    []*octokat.PullRequestFile
-		commits  []octokat.Commit
+		commits  []Commit
 		comments []octokat.Comment
 		err      error
 	)
-	n := strconv.Itoa(id)
-
-	options := &octokat.Options{
-		QueryParams: map[string]string{"per_page": "100"},
-	}
 
 	if isPR {
-		if commits, err = g.Client().Commits(repo, n, options); err != nil {
-			return nil, errors.Wrap(err, "commits")
+		if commits, err = g.PullRequestCommits(repo, id); err != nil {
+			return nil, err
 		}
 
-		if files, err = g.Client().PullRequestFiles(repo, n, options); err != nil {
-			return nil, errors.Wrap(err, "files")
+		if files, err = g.PullRequestFiles(repo, id); err != nil {
+			return nil, err
 		}
 	}
 
-	if comments, err = g.Client().Comments(repo, n, options); err != nil {
-		return nil, errors.Wrap(err, "comments")
+	if comments, err = g.Comments(repo, id); err != nil {
+		return nil, err
 	}
 
 	return &PullRequestContent{
@@ -146,6 +229,109 @@ func (g *GitHub) GetContent(repo octokat.Repo, id int, isPR bool) (*PullRequestC
 	}, nil
 }
 
+// PullRequestCommits returns all the commits of a pull request
+func (g GitHub) PullRequestCommits(repo octokat.Repo, number int) ([]Commit, error) {
+	var commits []Commit
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/commits?per_page=100", APIURL, repo.UserName, repo.Name, number)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var c []Commit
+		if err := json.Unmarshal(page, &c); err != nil {
+			return err
+		}
+		commits = append(commits, c...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "commits")
+	}
+
+	return commits, nil
+}
+
+// PullRequestFiles returns all the files changed by a pull request
+func (g GitHub) PullRequestFiles(repo octokat.Repo, number int) ([]*octokat.PullRequestFile, error) {
+	var files []*octokat.PullRequestFile
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/files?per_page=100", APIURL, repo.UserName, repo.Name, number)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var f []*octokat.PullRequestFile
+		if err := json.Unmarshal(page, &f); err != nil {
+			return err
+		}
+		files = append(files, f...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "files")
+	}
+
+	return files, nil
+}
+
+// Comments returns all the comments of an issue/pull request
+func (g GitHub) Comments(repo octokat.Repo, number int) ([]octokat.Comment, error) {
+	var comments []octokat.Comment
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments?per_page=100", APIURL, repo.UserName, repo.Name, number)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var c []octokat.Comment
+		if err := json.Unmarshal(page, &c); err != nil {
+			return err
+		}
+		comments = append(comments, c...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "comments")
+	}
+
+	return comments, nil
+}
+
+// IssueComment is a comment of an issue/pull request
+type IssueComment struct {
+	octokat.Comment
+	// the api url of the issue/pull request the comment is on
+	IssueURL string `json:"issue_url"`
+}
+
+// IssueComment returns a comment of an issue/pull request by its id
+func (g GitHub) IssueComment(repo octokat.Repo, id int) (*IssueComment, error) {
+	var comment IssueComment
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/comments/%d", APIURL, repo.UserName, repo.Name, id)
+	if _, err := g.do("GET", url, nil, &comment); err != nil {
+		return nil, errors.Wrapf(err, "getting comment %d", id)
+	}
+	return &comment, nil
+}
+
+// ListedPullRequest is a pull request of a listing, along with the
+// fields octokat does not parse
+type ListedPullRequest struct {
+	octokat.PullRequest
+	Draft     bool       `json:"draft"`
+	Labels    []Label    `json:"labels"`
+	Milestone *Milestone `json:"milestone"`
+}
+
+// PullRequests returns all the pull requests of a repo in the given
+// state ("open", "closed" or "all")
+func (g GitHub) PullRequests(repo octokat.Repo, state string) ([]*ListedPullRequest, error) {
+	var prs []*ListedPullRequest
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls?state=%s&per_page=100", APIURL, repo.UserName, repo.Name, state)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var p []*ListedPullRequest
+		if err := json.Unmarshal(page, &p); err != nil {
+			return err
+		}
+		prs = append(prs, p...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "pull requests")
+	}
+
+	return prs, nil
+}
+
 func hasAny(fn func(string, string) bool, s string, cases ...string) bool {
 	for _, c := range cases {
 		if fn(s, c) {
@@ -0,0 +1,106 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// APIURL is the base url of the GitHub API
+const APIURL = "https://api.github.com"
+
+var nextLinkRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Error is returned for unsuccessful responses from the GitHub API.
+// The message is the one reported by GitHub, eg. "Not Found".
+type Error struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (g GitHub) httpClient() *http.Client {
+	return &http.Client{Transport: g.transport()}
+}
+
+// do sends an authenticated request to the GitHub API and decodes the
+// response into v if it is not nil
+func (g GitHub) do(method, url string, body, v interface{}) (*http.Response, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Authorization", "token "+g.AuthToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(b, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return resp, errors.Wrapf(apiErr, "%s %s", method, url)
+	}
+
+	if v != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return resp, fmt.Errorf("parsing the response from %s failed: %v", url, err)
+		}
+	}
+
+	return resp, nil
+}
+
+// getPages requests url and every following page linked from the Link
+// header of the responses, passing each page to fn to be decoded. The
+// requests are retried following the client's retry policy.
+func (g GitHub) getPages(url string, fn func(page json.RawMessage) error) error {
+	for url != "" {
+		var (
+			page json.RawMessage
+			resp *http.Response
+		)
+		err := g.retry(func() (err error) {
+			resp, err = g.do("GET", url, nil, &page)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := fn(page); err != nil {
+			return fmt.Errorf("parsing the response from %s failed: %v", url, err)
+		}
+
+		url = ""
+		if m := nextLinkRegexp.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			url = m[1]
+		}
+	}
+
+	return nil
+}
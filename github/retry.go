@@ -0,0 +1,98 @@
+package github
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// The classes of errors a RetryPolicy can retry
+const (
+	// GitHub often answers 404 for pull requests right after their hook
+	RetryNotFound    = "not_found"
+	RetryServerError = "server_error"
+	RetryRateLimited = "rate_limited"
+	RetryNetwork     = "network"
+)
+
+// RetryPolicy retries the reads of the GitHub API which failed with one of
+// the retryable classes of errors. The first retry waits BaseDelay, which
+// doubles for each of the next ones up to MaxDelay.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Retryable []string
+}
+
+// DefaultRetryPolicy is used by clients without a policy
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  5,
+	BaseDelay: time.Second,
+	MaxDelay:  30 * time.Second,
+	Retryable: []string{RetryNotFound, RetryServerError, RetryNetwork},
+}
+
+// errorClass returns the retryable class of err, or "" if it is not one
+func errorClass(err error) string {
+	switch cause := errors.Cause(err).(type) {
+	case *Error:
+		switch {
+		case cause.StatusCode == 404:
+			return RetryNotFound
+		case cause.StatusCode == 429, cause.StatusCode == 403 && strings.Contains(cause.Message, "rate limit"):
+			return RetryRateLimited
+		case cause.StatusCode >= 500:
+			return RetryServerError
+		}
+	case *url.Error, net.Error:
+		return RetryNetwork
+	default:
+		// octokat only keeps the message of the response
+		if cause.Error() == "Not Found" {
+			return RetryNotFound
+		}
+	}
+	return ""
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	class := errorClass(err)
+	if class == "" {
+		return false
+	}
+	for _, c := range p.Retryable {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls fn until it succeeds, fails with an error which is not
+// retryable, or the attempts of the client's policy are used up
+func (g GitHub) retry(fn func() error) error {
+	p := DefaultRetryPolicy
+	if g.Retry != nil {
+		p = *g.Retry
+	}
+
+	delay := p.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !p.retryable(err) {
+			return err
+		}
+
+		logrus.Warnf("GitHub request failed (attempt %d/%d), retrying in %s: %v", attempt, p.Attempts, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
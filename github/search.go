@@ -0,0 +1,41 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// SearchPullRequests returns the numbers of the issues and pull requests
+// matching the query of the search API, eg. "is:pr is:open repo:o/r".
+// Searches whose results GitHub reports as incomplete fail, since the
+// search timed out before finding all of them.
+func (g GitHub) SearchPullRequests(query string) ([]int, error) {
+	var numbers []int
+	u := fmt.Sprintf("%s/search/issues?q=%s&per_page=100", APIURL, url.QueryEscape(query))
+	err := g.getPages(u, func(page json.RawMessage) error {
+		var result struct {
+			Incomplete bool `json:"incomplete_results"`
+			Items      []struct {
+				Number int `json:"number"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(page, &result); err != nil {
+			return err
+		}
+		if result.Incomplete {
+			return fmt.Errorf("the results are incomplete")
+		}
+		for _, item := range result.Items {
+			numbers = append(numbers, item.Number)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "search %q", query)
+	}
+
+	return numbers, nil
+}
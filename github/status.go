@@ -1,6 +1,206 @@
 package github
 
-import "github.com/crosbymichael/octokat"
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// how long the latest statuses of a sha are trusted without reading
+// them again, long enough to cover the updates of one delivery
+const statusCacheTTL = 15 * time.Second
+
+// StatusCache keeps the latest status of each context of the recently
+// updated shas, so several context updates on a sha share a single read.
+// Usually the state store, shared by the instances so they see the
+// statuses the others wrote.
+type StatusCache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// statusLock serializes the writes of one context of a sha
+type statusLock struct {
+	sync.Mutex
+	// how many goroutines hold or wait for the lock, it is dropped once
+	// none does
+	users int
+}
+
+var (
+	statusLocksMu sync.Mutex
+	statusLocks   = map[string]*statusLock{}
+)
+
+// lockStatus waits for the status of the context of a sha to be free and
+// returns the function releasing it
+func lockStatus(key string) func() {
+	statusLocksMu.Lock()
+	l, ok := statusLocks[key]
+	if !ok {
+		l = &statusLock{}
+		statusLocks[key] = l
+	}
+	l.users++
+	statusLocksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		statusLocksMu.Lock()
+		defer statusLocksMu.Unlock()
+		l.users--
+		if l.users == 0 {
+			delete(statusLocks, key)
+		}
+	}
+}
+
+// cachedStatus is the part of a status SetStatus compares
+type cachedStatus struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+func statusCacheKey(repo octokat.Repo, sha string) string {
+	return "status-cache/" + repo.String() + "/" + sha
+}
+
+// Statuses returns all the statuses set on a sha, most recent first
+func (g GitHub) Statuses(repo octokat.Repo, sha string) ([]octokat.Status, error) {
+	var statuses []octokat.Status
+	url := fmt.Sprintf("%s/repos/%s/%s/commits/%s/statuses?per_page=100", APIURL, repo.UserName, repo.Name, sha)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var s []octokat.Status
+		if err := json.Unmarshal(page, &s); err != nil {
+			return err
+		}
+		statuses = append(statuses, s...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "statuses")
+	}
+
+	return statuses, nil
+}
+
+// CombinedStatuses returns the latest status of each context set on a sha
+func (g GitHub) CombinedStatuses(repo octokat.Repo, sha string) ([]octokat.Status, error) {
+	var statuses []octokat.Status
+	url := fmt.Sprintf("%s/repos/%s/%s/commits/%s/status?per_page=100", APIURL, repo.UserName, repo.Name, sha)
+	err := g.getPages(url, func(page json.RawMessage) error {
+		var combined struct {
+			Statuses []octokat.Status `json:"statuses"`
+		}
+		if err := json.Unmarshal(page, &combined); err != nil {
+			return err
+		}
+		statuses = append(statuses, combined.Statuses...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "combined status")
+	}
+
+	return statuses, nil
+}
+
+// SetStatus sets a status on a sha unless the latest status of its
+// context already has the same state, description and url. It reports
+// whether the status was written. Without a StatusCache every status is
+// written.
+func (g GitHub) SetStatus(repo octokat.Repo, sha string, status *octokat.StatusOptions) (bool, error) {
+	// the faked writes of read only clients would hide the real ones
+	// from the cache
+	if g.ReadOnly || g.StatusCache == nil {
+		if _, err := g.Client().SetStatus(repo, sha, status); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	key := statusCacheKey(repo, sha) + "/" + status.Context
+	defer lockStatus(key)()
+
+	want := cachedStatus{State: status.State, Description: status.Description, URL: status.URL}
+	if current, ok := g.cachedStatus(repo, sha, status.Context); ok && current == want {
+		return false, nil
+	}
+
+	if _, err := g.Client().SetStatus(repo, sha, status); err != nil {
+		return false, err
+	}
+
+	if b, err := json.Marshal(want); err == nil {
+		g.StatusCache.Set(key, b, statusCacheTTL)
+	}
+	return true, nil
+}
+
+// cachedStatus returns the latest status of the context of a sha, reading
+// all the statuses of the sha into the cache unless they are cached
+func (g GitHub) cachedStatus(repo octokat.Repo, sha, context string) (cachedStatus, bool) {
+	var status cachedStatus
+	prefix := statusCacheKey(repo, sha)
+	if b, err := g.StatusCache.Get(prefix + "/" + context); err == nil {
+		return status, json.Unmarshal(b, &status) == nil
+	}
+	// read already, the context has no status
+	if _, err := g.StatusCache.Get(prefix); err == nil {
+		return status, false
+	}
+
+	statuses, err := g.CombinedStatuses(repo, sha)
+	if err != nil {
+		// we can still write the status
+		return status, false
+	}
+	found := false
+	for _, s := range statuses {
+		cached := cachedStatus{State: s.State, Description: s.Description, URL: s.TargetURL}
+		if s.Context == context {
+			status, found = cached, true
+		}
+		if b, err := json.Marshal(cached); err == nil {
+			g.StatusCache.Set(prefix+"/"+s.Context, b, statusCacheTTL)
+		}
+	}
+	g.StatusCache.Set(prefix, []byte(time.Now().UTC().Format(time.RFC3339)), statusCacheTTL)
+	return status, found
+}
+
+// HasStatus checks if a status for context was set on one of the commits
+// of the pull request. The statuses of each commit are only requested
+// once, so they can be checked for several contexts.
+func (g GitHub) HasStatus(pr *PullRequest, sha, context string) (bool, error) {
+	if pr.Content.statuses == nil {
+		pr.Content.statuses = map[string][]octokat.Status{}
+	}
+
+	statuses, ok := pr.Content.statuses[sha]
+	if !ok {
+		var err error
+		if statuses, err = g.Statuses(pr.Repo, sha); err != nil {
+			return false, err
+		}
+		pr.Content.statuses[sha] = statuses
+	}
+
+	for _, status := range statuses {
+		if status.Context == context {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
 
 func (g GitHub) successStatus(repo octokat.Repo, sha, context, description string) error {
 	_, err := g.Client().SetStatus(repo, sha, &octokat.StatusOptions{
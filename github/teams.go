@@ -0,0 +1,24 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// IsTeamMember checks if a user is an active member of the team of org
+func (g GitHub) IsTeamMember(org, team, user string) (bool, error) {
+	var membership struct {
+		State string `json:"state"`
+	}
+	u := fmt.Sprintf("%s/orgs/%s/teams/%s/memberships/%s", APIURL, org, team, url.PathEscape(user))
+	if _, err := g.do("GET", u, nil, &membership); err != nil {
+		if apiErr, ok := errors.Cause(err).(*Error); ok && apiErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "membership of %s in %s/%s", user, org, team)
+	}
+	return membership.State == "active", nil
+}
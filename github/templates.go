@@ -0,0 +1,217 @@
+package github
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"leeroy/messages"
+
+	"github.com/crosbymichael/octokat"
+)
+
+// Names of the comment templates
+const (
+	DCOTemplate           = "dco"
+	UnauthorizedTemplate  = "unauthorized"
+	ConflictsTemplate     = "conflicts"
+	AutoMergeDropTemplate = "automerge-drop"
+	CommandDeniedTemplate = "command-denied"
+	CommandFailedTemplate = "command-failed"
+	CIFailureTemplate     = "ci-failure"
+	CIFixedTemplate       = "ci-fixed"
+	CIBisectTemplate      = "ci-bisect"
+	FormatTemplate        = "format"
+	LicenseTemplate       = "license"
+)
+
+const templateExtension = ".tmpl"
+
+// defaultTemplates are the comments used unless a template overrides them
+var defaultTemplates = map[string]string{
+	DCOTemplate: `Please sign your commits following these rules:
+https://developercertificate.org/
+The following commits are missing a Signed-off-by trailer:
+{{range .Unsigned}}- {{.Sha}} {{subject .Commit.Message}}
+{{end}}
+The easiest way to do this is to amend the last commit:
+~~~console
+$ git clone -b {{printf "%q" .PR.Head.Ref}} {{.PR.Head.Repo.CloneURL}} somewhere
+$ cd somewhere
+{{if gt .PR.Commits 1}}$ git rebase -i HEAD~{{.PR.Commits}}
+editor opens
+change each 'pick' to 'edit'
+save the file and quit
+{{end}}$ git commit --amend -s --no-edit
+{{if gt .PR.Commits 1}}$ git rebase --continue # and repeat the amend for each commit
+{{end}}$ git push -f
+~~~
+
+Amending updates the existing PR. You **DO NOT** need to open a new one.
+`,
+	UnauthorizedTemplate: `Thanks for your pull request! As it comes from a fork, it needs an approval from a member of @{{.Team}} before it is built. Pushing new commits needs a new approval.`,
+	ConflictsTemplate: `Looks like we would not be able to merge this PR because of merge conflicts with {{.PR.Base.Ref}}. Please rebase your branch on it, or merge it into your branch, fix the conflicts and push:
+~~~console
+$ git fetch upstream
+$ git rebase upstream/{{.PR.Base.Ref}}
+~~~`,
+	AutoMergeDropTemplate: "Not merging automatically: {{.Reason}}. Add the `{{.Label}}` label again once this is fixed.",
+	CommandDeniedTemplate: "@{{.User}} only {{if .Role}}{{.Role}}s{{else}}users with write access{{end}} can use `/{{.Command}}`.",
+	CommandFailedTemplate: "@{{.User}} `/{{.Command}}` failed: {{.Error}}",
+	CIFailureTemplate: `[{{.Job}} #{{.Number}}]({{.URL}}) {{.State}} on {{.Branch}} at {{.Sha}}: {{.Description}}
+{{if .Commits}}
+Commits since the last green build ({{.LastGreen}}):
+{{range .Commits}}- {{.Sha}} {{subject .Commit.Message}}
+{{end}}{{end}}{{if .Console}}
+~~~
+{{.Console}}
+~~~
+{{end}}`,
+	CIFixedTemplate: `{{.Context}} is green again on {{.Branch}} at {{.Sha}}: [{{.Job}} #{{.Number}}]({{.URL}})`,
+	CIBisectTemplate: `Bisected {{.Context}} on {{.Branch}} in {{.Builds}} builds, {{.Commit.Sha}} is the first failing commit:
+> {{subject .Commit.Commit.Message}}
+
+It passed on its parent {{.Good.Sha}}.`,
+	FormatTemplate: `Some of the files changed do not follow the formatting of {{.Formatters}}. Please fix the formatting of your changes, eg. by applying this patch with ` + "`git apply`" + `:
+~~~diff
+{{.Patch}}~~~
+{{if .Truncated}}
+The patch was truncated, run the formatters locally to see all the changes.
+{{end}}`,
+	LicenseTemplate: `These files are missing the license header, their first lines should match ` + "`{{.Header}}`" + `:
+{{range .Files}}- {{.}}
+{{end}}`,
+}
+
+var templateFuncs = template.FuncMap{
+	// subject returns the first line of a commit message
+	"subject": func(message string) string {
+		return strings.SplitN(message, "\n", 2)[0]
+	},
+}
+
+// Templates renders the comments leeroy makes. The built-in comments are
+// overridden by the files of Dir named after the templates, eg.
+// "dco.tmpl", those by the files in the "<language>" directories below it
+// for the repos in that language, and those by the files in the
+// "<owner>/<repo>" directories for a single repo.
+type Templates struct {
+	Dir string
+	// selects the languages of the repos, English if nil
+	Messages *messages.Catalog
+}
+
+// path returns the file overriding the named template for the repo, or
+// "" to use the built-in one
+func (t Templates) path(repo octokat.Repo, name string) (string, error) {
+	if t.Dir == "" {
+		return "", nil
+	}
+
+	paths := []string{filepath.Join(t.Dir, repo.UserName, repo.Name, name+templateExtension)}
+	if language := t.Messages.Language(fullName(repo)); language != "" {
+		paths = append(paths, filepath.Join(t.Dir, language, name+templateExtension))
+	}
+	paths = append(paths, filepath.Join(t.Dir, name+templateExtension))
+
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// load parses the named template for the repo. The files are read each
+// time, so they can be changed without restarting leeroy.
+func (t Templates) load(repo octokat.Repo, name string) (*template.Template, error) {
+	text, ok := defaultTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown comment template %q", name)
+	}
+
+	path, err := t.path(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// Render renders the named comment for the repo
+func (t Templates) Render(repo octokat.Repo, name string, data interface{}) (string, error) {
+	tmpl, err := t.load(repo, name)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Validate parses all the template files of Dir, so mistakes are found
+// before leeroy has to comment
+func (t Templates) Validate() (errs []error) {
+	if t.Dir == "" {
+		return nil
+	}
+
+	err := filepath.Walk(t.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != templateExtension {
+			return nil
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), templateExtension)
+		if _, ok := defaultTemplates[name]; !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown comment template %q", path, name))
+			return nil
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := template.New(name).Funcs(templateFuncs).Parse(string(b)); err != nil {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// renderComment renders the named comment, making sure it still contains
+// the commentType leeroy finds its previous comments by when the template
+// was changed
+func (g GitHub) renderComment(repo octokat.Repo, name, commentType string, data interface{}) (string, error) {
+	comment, err := g.Templates.Render(repo, name, data)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(comment, commentType) {
+		comment += fmt.Sprintf("\n\n<!-- %s -->", commentType)
+	}
+	return comment, nil
+}
@@ -0,0 +1,234 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// ErrNoTokens is returned when every token of the pool was retired
+var ErrNoTokens = errors.New("all the GitHub tokens were revoked")
+
+// the rate limit assumed for tokens which were not used yet
+const defaultRateLimit = 5000
+
+// TokenPool rotates the requests between several tokens, sending each
+// request with the token with the most requests left before its rate
+// limit. Tokens GitHub rejects as bad credentials are retired.
+type TokenPool struct {
+	mu     sync.Mutex
+	tokens []*poolToken
+}
+
+type poolToken struct {
+	value     string
+	remaining int
+	reset     time.Time
+	retired   bool
+}
+
+// TokenHealth is the state of a token of the pool, the token itself is
+// reduced to its last characters
+type TokenHealth struct {
+	Token     string    `json:"token"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Retired   bool      `json:"retired"`
+}
+
+// NewTokenPool returns a pool of the tokens
+func NewTokenPool(tokens []string) *TokenPool {
+	p := &TokenPool{}
+	for _, t := range tokens {
+		p.tokens = append(p.tokens, &poolToken{value: t, remaining: defaultRateLimit})
+	}
+	return p
+}
+
+// Add adds a token to the pool, eg. after it was rotated
+func (p *TokenPool) Add(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.tokens {
+		if t.value == token {
+			return
+		}
+	}
+	p.tokens = append(p.tokens, &poolToken{value: token, remaining: defaultRateLimit})
+}
+
+// Tokens returns the tokens of the pool which were not retired
+func (p *TokenPool) Tokens() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var tokens []string
+	for _, t := range p.tokens {
+		if !t.retired {
+			tokens = append(tokens, t.value)
+		}
+	}
+	return tokens
+}
+
+// next returns the token to send the next request with: the one with the
+// most requests left, or the one whose limit resets first once all of
+// them are exhausted
+func (p *TokenPool) next() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best *poolToken
+	for _, t := range p.tokens {
+		if t.retired {
+			continue
+		}
+		if !t.reset.IsZero() && now.After(t.reset) {
+			t.remaining, t.reset = defaultRateLimit, time.Time{}
+		}
+		switch {
+		case best == nil:
+			best = t
+		case t.remaining > best.remaining:
+			best = t
+		case t.remaining == 0 && best.remaining == 0 && t.reset.Before(best.reset):
+			best = t
+		}
+	}
+	if best == nil {
+		return "", ErrNoTokens
+	}
+	return best.value, nil
+}
+
+// update records the rate limit of the token reported by the response,
+// and retires the token if GitHub did not accept it
+func (p *TokenPool) update(token string, resp *http.Response) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.tokens {
+		if t.value != token {
+			continue
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			if !t.retired {
+				logrus.Errorf("Retiring the GitHub token ending in %s, it was revoked or expired", MaskToken(token))
+			}
+			t.retired = true
+			return
+		}
+		if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+			t.remaining = remaining
+		}
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			t.reset = time.Unix(reset, 0)
+		}
+		if t.remaining == 0 {
+			logrus.Warnf("The GitHub token ending in %s is rate limited until %s", MaskToken(token), t.reset.Format(time.RFC3339))
+		}
+		return
+	}
+}
+
+// Health returns the state of every token of the pool
+func (p *TokenPool) Health() []TokenHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make([]TokenHealth, 0, len(p.tokens))
+	for _, t := range p.tokens {
+		health = append(health, TokenHealth{
+			Token:     MaskToken(t.value),
+			Remaining: t.remaining,
+			Reset:     t.reset,
+			Retired:   t.retired,
+		})
+	}
+	return health
+}
+
+// MaskToken returns the last characters of a token, enough to tell them
+// apart in the logs
+func MaskToken(token string) string {
+	if len(token) <= 4 {
+		return token
+	}
+	return "..." + token[len(token)-4:]
+}
+
+// TokenInfo is what GitHub reports about the token of the client
+type TokenInfo struct {
+	// the OAuth scopes of classic tokens, fine-grained tokens have none
+	Scopes []string
+	// zero for tokens which do not expire
+	Expires time.Time
+}
+
+// the layouts of the GitHub-Authentication-Token-Expiration header
+var expirationLayouts = []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"}
+
+// TokenInfo returns the scopes and expiration of the token of the client
+func (g GitHub) TokenInfo() (TokenInfo, error) {
+	var info TokenInfo
+	resp, err := g.do("GET", APIURL+"/user", nil, nil)
+	if err != nil {
+		return info, err
+	}
+
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			info.Scopes = append(info.Scopes, scope)
+		}
+	}
+	if expiration := resp.Header.Get("GitHub-Authentication-Token-Expiration"); expiration != "" {
+		for _, layout := range expirationLayouts {
+			if t, err := time.Parse(layout, expiration); err == nil {
+				info.Expires = t
+				break
+			}
+		}
+		if info.Expires.IsZero() {
+			return info, fmt.Errorf("parsing the token expiration %q failed", expiration)
+		}
+	}
+	return info, nil
+}
+
+// poolTransport sends the requests with the tokens of the pool
+type poolTransport struct {
+	pool *TokenPool
+	base http.RoundTripper
+}
+
+func (t poolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.pool.next()
+	if err != nil {
+		return nil, err
+	}
+
+	// requests must not be modified by transports
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "token "+token)
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	t.pool.update(token, resp)
+	return resp, nil
+}
@@ -0,0 +1,34 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// TreeEntry is a file, directory ("tree") or submodule ("commit") of a
+// tree
+type TreeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+}
+
+// Tree returns all the entries of the tree of a commit
+func (g GitHub) Tree(repo octokat.Repo, ref string) ([]TreeEntry, error) {
+	var tree struct {
+		Tree      []TreeEntry `json:"tree"`
+		Truncated bool        `json:"truncated"`
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", APIURL, repo.UserName, repo.Name, url.PathEscape(ref))
+	if _, err := g.do("GET", u, nil, &tree); err != nil {
+		return nil, errors.Wrapf(err, "tree of %s", ref)
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("tree of %s: too many entries", ref)
+	}
+	return tree.Tree, nil
+}
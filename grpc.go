@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+
+	"leeroy/api"
+	"leeroy/events"
+)
+
+// adminBackend serves the gRPC Admin service through the REST handlers,
+// so the calls get the same auth, ACLs, holds and audit trail
+type adminBackend struct{}
+
+// rest runs handler with a request made from the gRPC call r and returns
+// the error of its response
+func (adminBackend) rest(r *http.Request, handler http.HandlerFunc, method, target string, body interface{}) (*httptest.ResponseRecorder, error) {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return nil, api.Errorf(api.Internal, "encoding the request failed: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(b)).WithContext(r.Context())
+	req.RemoteAddr = r.RemoteAddr
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if code := api.HTTPCode(rec.Code); code != api.OK {
+		var resp errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == "" {
+			resp.Error = http.StatusText(rec.Code)
+		}
+		return nil, api.Error{Code: code, Message: resp.Error}
+	}
+	return rec, nil
+}
+
+func (a adminBackend) Trigger(r *http.Request, req api.TriggerRequest) error {
+	_, err := a.rest(r, customBuildHandler, "POST", "/build/custom", requestBuild{
+		Repo:    req.Repo,
+		Context: req.Context,
+		Number:  req.Number,
+		Sha:     req.Sha,
+		Branch:  req.Branch,
+		Profile: req.Profile,
+	})
+	return err
+}
+
+func (a adminBackend) Cancel(r *http.Request, req api.CancelRequest) error {
+	_, err := a.rest(r, cancelBuildHandler, "POST", "/build/cancel", requestBuild{
+		Repo:    req.Repo,
+		Context: req.Context,
+		Number:  req.Number,
+		Sha:     req.Sha,
+	})
+	return err
+}
+
+func (a adminBackend) Status(r *http.Request, req api.StatusRequest) (resp api.StatusResponse, err error) {
+	q := url.Values{"repo": {req.Repo}, "pr": {strconv.Itoa(req.Number)}}
+	rec, err := a.rest(r, buildStatusHandler, "GET", "/build/status?"+q.Encode(), nil)
+	if err != nil {
+		return resp, err
+	}
+
+	var records []buildRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &records); err != nil {
+		return resp, api.Errorf(api.Internal, "decoding the build records failed: %v", err)
+	}
+	for _, record := range records {
+		resp.Builds = append(resp.Builds, api.BuildRecord{
+			Repo:        record.Repo,
+			PR:          record.PR,
+			Sha:         record.Sha,
+			Context:     record.Context,
+			Job:         record.Job,
+			State:       record.State,
+			Description: record.Description,
+			URL:         record.URL,
+			Scheduled:   record.Scheduled,
+			Updated:     record.Updated,
+		})
+	}
+	return resp, nil
+}
+
+// Events streams like eventsHandler, the keep-alives are left to HTTP/2
+func (adminBackend) Events(r *http.Request, req api.EventsRequest, send func(api.Event) error) error {
+	if !isAuthorized(r) {
+		return api.Errorf(api.Unauthenticated, "%s", http.StatusText(401))
+	}
+
+	watched, stop := events.Watch(streamBuffer)
+	defer stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case e := <-watched:
+			if (len(req.Repos) > 0 && !containsString(req.Repos, e.Repo)) ||
+				(len(req.Types) > 0 && !containsString(req.Types, string(e.Type))) {
+				continue
+			}
+			if err := send(api.Event{
+				Type:        string(e.Type),
+				Time:        e.Time,
+				Repo:        e.Repo,
+				PR:          e.PR,
+				Sha:         e.Sha,
+				Context:     e.Context,
+				Job:         e.Job,
+				State:       e.State,
+				Description: e.Description,
+				URL:         e.URL,
+			}); err != nil {
+				return fmt.Errorf("sending the event failed: %v", err)
+			}
+		}
+	}
+}
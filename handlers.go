@@ -4,16 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"time"
-	"strconv"
+	"leeroy/azure"
+	"leeroy/events"
 	"leeroy/github"
 	"leeroy/jenkins"
+	"leeroy/webhook"
+	"net/http"
+	"strconv"
 
-    log "github.com/Sirupsen/logrus"
-    "github.com/Sirupsen/logrus"
+	"github.com/Sirupsen/logrus"
+	log "github.com/Sirupsen/logrus"
 	"github.com/crosbymichael/octokat"
-    "github.com/pkg/errors"
 )
 
 func pingHandler(w http.ResponseWriter, r *http.Request) {
@@ -23,8 +24,7 @@ func pingHandler(w http.ResponseWriter, r *http.Request) {
 
 func jenkinsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		fmt.Errorf("%q is not a valid method", r.Method)
-		w.WriteHeader(405)
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
 		return
 	}
 
@@ -32,12 +32,19 @@ func jenkinsHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var j jenkins.JenkinsResponse
 	if err := decoder.Decode(&j); err != nil {
-		log.Errorf("decoding the jenkins request as json failed: %v", err)
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the jenkins request as json failed: %v", err))
 		return
 	}
 
 	log.Infof("Received Jenkins notification for %s %d (%s): %s", j.Name, j.Build.Number, j.Build.Url, j.Build.Phase)
 
+	// the shadow builds of the canary config are not reported
+	if j.Build.Parameters.Canary != "" {
+		log.Infof("Ignoring the notification of canary build %s %d", j.Name, j.Build.Number)
+		w.WriteHeader(204)
+		return
+	}
+
 	// if the phase is not started or completed
 	// we don't care
 	if j.Build.Phase != "STARTED" && j.Build.Phase != "COMPLETED" {
@@ -46,12 +53,12 @@ func jenkinsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// get the status for github
 	// and create a status description
-	desc := fmt.Sprintf("Jenkins build %s %d", j.Name, j.Build.Number)
+	// the description is formatted once the repo and its language are known
+	desc := "Jenkins build %s %d"
 	var state string
 	if j.Build.Phase == "STARTED" {
 		state = "pending"
 		desc += " is running"
-		j.Build.Url += "console"
 	} else {
 
 		switch j.Build.Status {
@@ -68,69 +75,283 @@ func jenkinsHandler(w http.ResponseWriter, r *http.Request) {
 			state = "error"
 			desc += " has encountered an error"
 		default:
-			log.Errorf("Did not understand %q build status. Aborting.", j.Build.Status)
+			writeError(w, 400, errInvalidRequest, fmt.Errorf("Did not understand %q build status. Aborting.", j.Build.Status))
 			return
 		}
 	}
 	// get the build
-        build, err := config.getBuildByJob(j.Name)
+	build, err := config.getBuildByJob(j.Name)
 	if err != nil {
-		log.Error(err)
+		writeFailure(w, err)
 		return
 	}
 
-	// update the github status
-	if err := config.updateGithubStatus(j.Build.Parameters.GitBaseRepo, build.Context, j.Build.Parameters.GitSha, state, desc, j.Build.Url); err != nil {
-		log.Error(err)
+	// jobs with a token can only report their own builds
+	if !build.verifyNotification(j.Name, r.URL.Query().Get("token")) {
+		writeError(w, 401, errUnauthorized, fmt.Errorf("Rejected Jenkins notification for %s with an invalid token", j.Name))
+		return
+	}
+	if build.jobToken(j.Name) != "" && j.Build.Parameters.GitBaseRepo != build.Repo {
+		writeError(w, 403, errForbidden, fmt.Errorf("Rejected Jenkins notification for %s about another repo %s", j.Name, j.Build.Parameters.GitBaseRepo))
+		return
 	}
 
-	if state == "success" {
-		for _, DownstreamBuild := range build.DownstreamBuilds {
-			BuildDownstream, err := config.getBuildByContextAndRepo(DownstreamBuild, j.Build.Parameters.GitBaseRepo)
-		if err != nil {
-				log.Error(err)
-				w.WriteHeader(500)
-				return
-			}
-			pr_number, _ := strconv.Atoi(j.Build.Parameters.PR)
-			if err := config.scheduleJenkinsDownstreamBuild(BuildDownstream.Repo, j.Build.Parameters.GitHeadRepo, pr_number, BuildDownstream, j.Build.Parameters.GitSha); err != nil {
-				log.Error(err)
-				w.WriteHeader(500)
-			}
+	// failures caused by the infrastructure are errors, and retried
+	infra, retried := false, false
+	if state == "failure" && config.classifyFailure(build, j.Name, j.Build.Number) == infraFailure {
+		infra = true
+		state = "error"
+		desc = "Jenkins build %s %d failed because of the infrastructure"
+		if retried = config.retryInfraFailure(build, j.Name, j.Build.Number, j.Build.Parameters.GitBaseRepo, j.Build.Parameters.GitSha); retried {
+			state = "pending"
+			desc += ", retrying"
+		}
+	}
+
+	pr, _ := strconv.Atoi(j.Build.Parameters.PR)
+	j.Build.Url = build.statusURL(config.Jenkins.Baseurl, j.Name, j.Build.Number, j.Build.Url, state == "pending")
+	if err := config.reportBuild(build, buildResult{
+		Repo:           j.Build.Parameters.GitBaseRepo,
+		HeadRepo:       j.Build.Parameters.GitHeadRepo,
+		PR:             pr,
+		Branch:         branchName(j.Build.Parameters.GitBranch),
+		Bisect:         j.Build.Parameters.Bisect != "",
+		Sha:            j.Build.Parameters.GitSha,
+		Number:         j.Build.Number,
+		State:          state,
+		Description:    msg(j.Build.Parameters.GitBaseRepo, desc, j.Name, j.Build.Number),
+		URL:            j.Build.Url,
+		Completed:      j.Build.Phase == "COMPLETED" && !retried,
+		Infrastructure: infra,
+	}); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	// the stages only exist once the pipeline ran
+	if build.ReportStages && j.Build.Phase == "COMPLETED" {
+		if err := config.reportStages(build, j.Name, j.Build.Number, j.Build.Parameters.GitBaseRepo, j.Build.Parameters.GitSha, j.Build.Url); err != nil {
+			log.Error(err)
 		}
 	}
 
 	return
 }
 
+func azureHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth, service hooks send basic auth
+	// configured on the subscription
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+
+	// decode the body
+	decoder := json.NewDecoder(r.Body)
+	var n azure.Notification
+	if err := decoder.Decode(&n); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the azure request as json failed: %v", err))
+		return
+	}
+
+	run := n.Resource.Run
+	log.Infof("Received Azure notification for pipeline %d run %d (%s): %s %s", n.Resource.Pipeline.ID, run.ID, n.EventType, run.State, run.Result)
+
+	// get the build
+	build, err := config.getBuildByAzurePipeline(n.Resource.Pipeline.ID)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	// the notification does not carry the template
+	// parameters, so get them from the run
+	details, err := config.Azure.GetRun(n.Resource.Pipeline.ID, run.ID)
+	if err != nil {
+		writeError(w, 500, errInternal, fmt.Errorf("getting azure run %d failed: %v", run.ID, err))
+		return
+	}
+
+	// the description is formatted once the repo and its language are known
+	desc := "Azure pipeline %s %s"
+	var state string
+	completed := run.State == "completed"
+	if !completed {
+		state = "pending"
+		desc += " is running"
+	} else {
+		switch run.Result {
+		case "succeeded":
+			state = "success"
+			desc += " has succeeded"
+		case "failed":
+			state = "failure"
+			desc += " has failed"
+		case "canceled":
+			state = "error"
+			desc += " was canceled"
+		default:
+			writeError(w, 400, errInvalidRequest, fmt.Errorf("Did not understand %q run result. Aborting.", run.Result))
+			return
+		}
+	}
+
+	params := details.TemplateParameters
+	pr, _ := strconv.Atoi(params["PR"])
+	if err := config.reportBuild(build, buildResult{
+		Repo:        params["GIT_BASE_REPO"],
+		HeadRepo:    params["GIT_HEAD_REPO"],
+		PR:          pr,
+		Sha:         params["GIT_SHA1"],
+		State:       state,
+		Description: msg(params["GIT_BASE_REPO"], desc, n.Resource.Pipeline.Name, run.Name),
+		URL:         run.Links.Web.Href,
+		Completed:   completed,
+	}); err != nil {
+		writeFailure(w, err)
+	}
+
+	return
+}
+
+func webhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, 500, errInternal, fmt.Errorf("Error reading webhook handler body: %v", err))
+		return
+	}
+
+	// results must be signed with the shared secret
+	if !config.Webhook.Verify(body, r.Header.Get(webhook.SignatureHeader)) {
+		writeError(w, 401, errUnauthorized, fmt.Errorf("Invalid signature on webhook result from %s", r.RemoteAddr))
+		return
+	}
+
+	var res webhook.Result
+	if err := json.Unmarshal(body, &res); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the webhook result as json failed: %v", err))
+		return
+	}
+
+	log.Infof("Received webhook result for %s %s (%s): %s", res.Repo, res.Sha, res.Context, res.State)
+
+	// get the build
+	build, err := config.getBuildByContextAndRepo(res.Context, res.Repo)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	switch res.State {
+	case "pending", "success", "failure", "error":
+	default:
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Did not understand %q webhook result state. Aborting.", res.State))
+		return
+	}
+
+	if err := config.reportBuild(build, buildResult{
+		Repo:        res.Repo,
+		HeadRepo:    res.HeadRepo,
+		PR:          res.PR,
+		Sha:         res.Sha,
+		State:       res.State,
+		Description: res.Description,
+		URL:         res.TargetURL,
+		Completed:   res.State != "pending",
+	}); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	w.WriteHeader(204)
+	return
+}
+
 func githubHandler(w http.ResponseWriter, r *http.Request) {
 	event := r.Header.Get("X-GitHub-Event")
 
 	switch event {
 	case "":
-		log.Error("Got GitHub notification without a type")
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Got GitHub notification without a type"))
 		return
 	case "ping":
 		w.WriteHeader(200)
 		return
-	case "pull_request":
-		log.Debugf("Got a pull request hook")
+	case "pull_request", "pull_request_review", "check_run", "check_suite", "issue_comment", "membership", "push":
+		log.Debugf("Got a %s hook", event)
 	default:
-		fmt.Errorf("Got unknown GitHub notification event type: %s", event)
+		// a permanent skip, redelivering it would not change anything
+		log.Warnf("Ignoring unknown GitHub notification event type: %s", event)
+		w.WriteHeader(204)
 		return
 	}
 
-	// parse the pull request
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Errorf("Error reading github handler body: %v", err)
-		w.WriteHeader(500)
+		writeError(w, 500, errInternal, fmt.Errorf("Error reading github handler body: %v", err))
+		return
+	}
+	// checked before the delivery is remembered, so a forged
+	// delivery cannot make leeroy ignore the genuine one
+	guid := r.Header.Get("X-GitHub-Delivery")
+	if secret := config.GHWebhook.Secret; secret != "" && !github.VerifySignature(secret, r.Header.Get("X-Hub-Signature-256"), body) {
+		writeError(w, 401, errUnauthorized, fmt.Errorf("Rejected GitHub %s delivery %s with an invalid signature", event, guid))
+		return
+	}
+
+	// skip deliveries another instance already handled, unless
+	// handling them failed so they can be redelivered: the
+	// transient failures respond with a 5xx status, the
+	// permanent ones and the skipped hooks with a 2xx or 4xx
+	if !isNewDelivery(guid) {
+		log.Infof("Ignoring already handled GitHub delivery %s", guid)
 		return
 	}
+	sw := &statusWriter{ResponseWriter: w, status: 200}
+	defer func() {
+		// a panic is answered with a 500 once it was recovered
+		if p := recover(); p != nil {
+			forgetDelivery(guid)
+			panic(p)
+		}
+		if sw.status >= 500 {
+			forgetDelivery(guid)
+		}
+	}()
+	w = sw
+
+	log.Debugf("Handling GitHub %s delivery %s", event, guid)
+	switch event {
+	case "pull_request":
+		pullRequestHook(w, body, guid)
+	case "check_run", "check_suite":
+		checkHook(w, event, body, guid)
+	case "pull_request_review":
+		reviewHook(w, body, guid)
+	case "issue_comment":
+		commentHook(w, body, guid)
+	case "membership":
+		membershipHook(w, body)
+	case "push":
+		pushHook(w, body)
+	}
+}
+
+func pullRequestHook(w http.ResponseWriter, body []byte, delivery string) {
+	// parse the pull request
 	prHook, err := octokat.ParsePullRequestHook(body)
 	if err != nil {
-		log.Errorf("Error parsing hook: %v", err)
-		w.WriteHeader(500)
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing hook: %v", err))
 		return
 	}
 
@@ -139,61 +360,148 @@ func githubHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Infof("Received GitHub pull request notification for %s %d (%s): %s", baseRepo, pr.Number, pr.URL, prHook.Action)
 
+	// overlapping deliveries, commands and sweeps take turns
+	// to cancel and schedule the builds of the pull request
+	defer lockPR(baseRepo, pr.Number)()
+
+	// a delayed delivery must not replace the builds of a newer head
+	if isStaleHead(baseRepo, pr.Number, pr.Head.Sha, pr.UpdatedAt) {
+		log.Warnf("Ignoring delayed %s hook for %s #%d about the previous head %s", prHook.Action, baseRepo, pr.Number, pr.Head.Sha)
+		return
+	}
+
+	var extras pullRequestHookExtras
+	if err := json.Unmarshal(body, &extras); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing hook: %v", err))
+		return
+	}
+	extras.Delivery = delivery
+
+	// a pr being retargeted to another base branch is
+	// reported as edited with the previous base in changes
+	retargeted := false
+	if prHook.Action == "edited" && extras.Changes.Base != nil {
+		retargeted = true
+		log.Infof("%s #%d was retargeted from %s to %s", baseRepo, pr.Number, extras.Changes.Base.Ref.From, pr.Base.Ref)
+	}
+
+	// labelling a pull request for auto merge queues it
+	if a := config.autoMerge(baseRepo); a != nil {
+		labelled := prHook.Action == "labeled" && extras.Label != nil && extras.Label.Name == a.label()
+		reopened := (prHook.Action == "opened" || prHook.Action == "reopened") && extras.hasLabel(a.label())
+		if labelled || reopened {
+			enqueueAutoMerge(baseRepo, pr.Number)
+		}
+	}
+
+	// labels and milestones run or cancel the builds they gate
+	if prHook.Action == "labeled" || prHook.Action == "unlabeled" || prHook.Action == "milestoned" {
+		gateHook(w, prHook, baseRepo, extras)
+		return
+	}
+
+	// editing the title or description only reruns the built-in checks
+	edited := prHook.Action == "edited" && !retargeted
+
 	// ignore everything we don't care about
-	if prHook.Action != "opened" && prHook.Action != "reopened" && prHook.Action != "synchronize" {
+	if prHook.Action != "opened" && prHook.Action != "reopened" && prHook.Action != "synchronize" && !retargeted && !edited {
 		log.Debugf("Ignoring PR hook action %q", prHook.Action)
 		return
 	}
 
-        g := github.GitHub{
-                AuthToken: config.GHToken,
-                User:      config.GHUser,
-        }
-
-	attempt, totalAttempts := 1, 5
-        delay := time.Second
-retry:
-        pullRequest, err := g.LoadPullRequest(prHook)
-        if err != nil {
-               logrus.Errorf("Error loading the pull request (attempt %d/%d): %v", attempt, totalAttempts, err)
-               if attempt <= totalAttempts && errors.Cause(err).Error() == "Not Found" {
-                       time.Sleep(delay)
-                       attempt++
-                       delay *= 2
-                       goto retry
-               }
-               w.WriteHeader(500)
-               return
-        }
-
-        mergeable, err := g.IsMergeable(pullRequest)
-        if err != nil {
-             logrus.Errorf("Error checking if PR is mergeable: %v", err)
-	                w.WriteHeader(500)
-			                return
-					        }
-
-        // PR is not mergeable, so don't start the build
-        if !mergeable {
-               logrus.Errorf("Unmergeable PR for %s #%d. Aborting build", baseRepo, pr.Number)
-               w.WriteHeader(200)
-               return
-        }
-
-        // get the builds
-	builds, err := config.getBuilds(baseRepo, false)
+	events.Publish(events.Event{
+		Type:        events.PRReceived,
+		Repo:        baseRepo,
+		PR:          pr.Number,
+		Sha:         pr.Head.Sha,
+		Description: prHook.Action,
+		URL:         pr.HtmlURL,
+		Delivery:    delivery,
+	})
+
+	g := config.githubClient()
+
+	// the reads of the pull request are retried, GitHub
+	// may not serve it yet right after sending the hook
+	pullRequest, err := g.LoadPullRequest(prHook)
+	if err != nil {
+		writeError(w, 502, errGitHub, fmt.Errorf("Error loading the pull request: %v", err))
+		return
+	}
+
+	config.runChecks(baseRepo, pullRequest)
+	if edited {
+		return
+	}
+
+	mergeable, err := g.IsMergeable(pullRequest)
+	if err != nil {
+		writeError(w, 502, errGitHub, fmt.Errorf("Error checking if PR is mergeable: %v", err))
+		return
+	}
+
+	// PR is not mergeable, so don't start the build
+	if !mergeable {
+		logrus.Errorf("Unmergeable PR for %s #%d. Aborting build", baseRepo, pr.Number)
+		w.WriteHeader(200)
+		return
+	}
+
+	// get the builds
+	builds, err := config.pullRequestBuilds(baseRepo, pullRequest, extras)
 	if err != nil {
-		log.Error(err)
-		w.WriteHeader(500)
+		writeFailure(w, err)
 		return
 	}
+	if canary != nil {
+		go compareCanary(baseRepo, pullRequest, extras)
+	}
+
+	// the running builds are against the previous base
+	if retargeted {
+		for _, build := range builds {
+			if err := config.cancelBuild(build, pr.Number, pr.Head.Sha); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	// large pull requests or pull requests from forks may
+	// need a maintainer before they are built
+	hold, err := config.holdReason(baseRepo, pullRequest, extras)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	config.reportForkApproval(baseRepo, pullRequest, hold)
 
 	// schedule the jenkins builds
 	for _, build := range builds {
+		if retargeted {
+			// the existing statuses are all from the previous base
+			build = config.forceRebuild(build)
+		}
+		if !extras.labelled(build) {
+			log.Debugf("Skipping %s for %s #%d without label %q", build.Context, baseRepo, pr.Number, build.Label)
+			continue
+		}
+		if !extras.triaged(build) {
+			// expensive builds wait for a maintainer to triage the pr
+			if err := config.updateGithubStatus(baseRepo, build.Context, pr.Head.Sha, "pending", msg(baseRepo, "Waiting for triage (milestone or label) before building"), ""); err != nil {
+				writeFailure(w, err)
+			}
+			continue
+		}
+		if hold.held() && !build.Downstream {
+			if err := config.updateGithubStatus(baseRepo, build.Context, pr.Head.Sha, "pending", hold.Reason, ""); err != nil {
+				writeFailure(w, err)
+			}
+			continue
+		}
 		if !build.Downstream {
-			if err := config.scheduleJenkinsBuild(baseRepo, pr.Number, build); err != nil {
-				log.Error(err)
-				w.WriteHeader(500)
+			build.Delivery = delivery
+			if err := config.scheduleBuild(baseRepo, pullRequest, build); err != nil {
+				writeFailure(w, err)
 			}
 		}
 	}
@@ -205,23 +513,26 @@ type requestBuild struct {
 	Number  int    `json:"number"`
 	Repo    string `json:"repo"`
 	Context string `json:"context"`
+	// builds a specific commit, of the pull request if there is a number
+	Sha    string `json:"sha,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	// schedules the build with the parameters of a profile
+	Profile string `json:"profile,omitempty"`
+	// schedules the downstream builds once the build succeeds, like for
+	// the builds triggered by hooks
+	WithDownstream bool `json:"with_downstream,omitempty"`
 }
 
 func customBuildHandler(w http.ResponseWriter, r *http.Request) {
-	// setup auth
-	user, pass, ok := r.BasicAuth()
+	// setup auth, the api_keys can also trigger the builds they allow
+	name, key, ok := principal(r)
 	if !ok {
-		w.WriteHeader(401)
-		return
-	}
-	if user != config.User && pass != config.Pass {
-		w.WriteHeader(401)
+		writeError(w, 401, errUnauthorized, nil)
 		return
 	}
 
 	if r.Method != "POST" {
-		fmt.Errorf("%q is not a valid method", r.Method)
-		w.WriteHeader(405)
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
 		return
 	}
 
@@ -229,78 +540,355 @@ func customBuildHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var b requestBuild
 	if err := decoder.Decode(&b); err != nil {
-		log.Errorf("decoding the retry request as json failed: %v", err)
-		w.WriteHeader(500)
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the retry request as json failed: %v", err))
 		return
 	}
 
-	// get the build
+	// get the build, the keys are checked against its context as the
+	// default context is used when none is given
 	build, err := config.getBuildByContextAndRepo(b.Context, b.Repo)
 	if err != nil {
-		log.Error(err)
-		w.WriteHeader(500)
+		writeFailure(w, err)
+		return
+	}
+
+	allowed := key == nil || key.allows(b.Repo, build.Context)
+	// the downstream builds need to be allowed as well
+	if allowed && key != nil && b.WithDownstream {
+		allowed = config.allowsDownstream(*key, b.Repo, build.Context)
+	}
+	recordAudit(auditEntry{
+		Principal: name,
+		Remote:    r.RemoteAddr,
+		Action:    "custom_build",
+		Repo:      b.Repo,
+		Context:   build.Context,
+		PR:        b.Number,
+		Sha:       b.Sha,
+		Branch:    b.Branch,
+		Allowed:   allowed,
+	})
+	if !allowed {
+		what := build.Context
+		if b.WithDownstream {
+			what += " with its downstream builds"
+		}
+		writeError(w, 403, errForbidden, fmt.Errorf("%s cannot build %s of %s", name, what, b.Repo))
+		return
+	}
+
+	if b.Number == 0 && b.Sha == "" && b.Branch == "" {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("a custom build of %s needs a number, sha or branch", b.Repo))
+		return
+	}
+	if b.Profile != "" {
+		if build, err = config.withProfile(build, b.Profile); err != nil {
+			writeError(w, 400, errInvalidRequest, err)
+			return
+		}
+	}
+
+	// resolve the commit to build, the sha may be abbreviated
+	sha := ""
+	if b.Sha != "" || b.Number == 0 {
+		ref := b.Sha
+		if ref == "" {
+			ref = b.Branch
+		}
+		if sha, err = config.commitSha(b.Repo, ref); err != nil {
+			writeFailure(w, err)
+			return
+		}
+	}
+
+	// a branch or commit outside of any pull request
+	if b.Number == 0 {
+		if err := config.scheduleRefBuild(b.Repo, build, sha, b.Branch, nil); err != nil {
+			writeFailure(w, err)
+			return
+		}
+		if !b.WithDownstream {
+			skipDownstream(b.Repo, sha, build.Context)
+		}
+		w.WriteHeader(204)
+		return
+	}
+
+	defer lockPR(b.Repo, b.Number)()
+
+	// get the pull request
+	pr, err := config.loadPullRequest(b.Repo, b.Number)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	extras, err := config.pullRequestExtras(pr)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	// the pull requests waiting for a maintainer are not built, only the
+	// stale ones are resumed like for a /retest
+	h, err := config.holdReason(b.Repo, pr, extras)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if h.held() && !h.Stale {
+		writeError(w, 409, errHeld, fmt.Errorf("%s #%d is held: %s", b.Repo, b.Number, h.Reason))
+		return
+	}
+	if !extras.labelled(build) || !extras.triaged(build) {
+		writeError(w, 409, errHeld, fmt.Errorf("%s of %s #%d waits for its label or triage", build.Context, b.Repo, b.Number))
 		return
 	}
 
 	// schedule the jenkins build
-	if err := config.scheduleJenkinsBuild(b.Repo, b.Number, build); err != nil {
-		w.WriteHeader(500)
-		log.Error(err)
+	if sha != "" {
+		// eg. an older commit whose build was lost
+		if isFork(pr) {
+			build = build.sandboxed()
+		}
+		err = config.scheduleCommit(b.Repo, pr, build, sha, false)
+	} else {
+		sha = pr.Head.Sha
+		build.Manual = true
+		err = config.scheduleBuild(b.Repo, pr, build)
+	}
+	if err != nil {
+		writeFailure(w, err)
 		return
 	}
+	if !b.WithDownstream {
+		skipDownstream(b.Repo, sha, build.Context)
+	}
 
 	w.WriteHeader(204)
 	return
 }
 
-func cronBuildHandler(w http.ResponseWriter, r *http.Request) {
+type requestBulkBuild struct {
+	Repo    string `json:"repo"`
+	Context string `json:"context"`
+	Numbers []int  `json:"numbers"`
+	// without numbers, all the open pull requests are built, or only
+	// the ones targeting the base branch if it is set
+	All  bool   `json:"all"`
+	Base string `json:"base"`
+}
+
+type bulkBuildResult struct {
+	Number int    `json:"number"`
+	Error  string `json:"error,omitempty"`
+	// why the pull request was not built, eg. it waits for an approval
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// bulkBuildHandler schedules a build for several pull requests at once,
+// eg. to rerun a context after an infrastructure fix, and responds with
+// the result for each pull request
+func bulkBuildHandler(w http.ResponseWriter, r *http.Request) {
 	// setup auth
-	user, pass, ok := r.BasicAuth()
-	if !ok {
-		w.WriteHeader(401)
-		return
-	}
-	if user != config.User && pass != config.Pass {
-		w.WriteHeader(401)
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
 		return
 	}
 
 	if r.Method != "POST" {
-		fmt.Errorf("%q is not a valid method", r.Method)
-		w.WriteHeader(405)
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
 		return
 	}
 
 	// decode the body
 	decoder := json.NewDecoder(r.Body)
-	var b requestBuild
+	var b requestBulkBuild
 	if err := decoder.Decode(&b); err != nil {
-		log.Errorf("decoding the retry request as json failed: %v", err)
-		w.WriteHeader(500)
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the bulk build request as json failed: %v", err))
+		return
+	}
+	if len(b.Numbers) == 0 && !b.All && b.Base == "" {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("a bulk build of %s needs numbers, all or a base", b.Repo))
 		return
 	}
 
 	// get the build
 	build, err := config.getBuildByContextAndRepo(b.Context, b.Repo)
 	if err != nil {
-		log.Error(err)
-		w.WriteHeader(500)
+		writeFailure(w, err)
+		return
+	}
+	build.Manual = true
+
+	nums := b.Numbers
+	if len(nums) == 0 {
+		if nums, err = config.getOpenPRs(b.Repo, b.Base); err != nil {
+			writeFailure(w, err)
+			return
+		}
+	}
+
+	results := []bulkBuildResult{}
+	for _, number := range nums {
+		result := bulkBuildResult{Number: number}
+		unlock := lockPR(b.Repo, number)
+		pr, err := config.loadPullRequest(b.Repo, number)
+		var extras pullRequestHookExtras
+		if err == nil {
+			extras, err = config.pullRequestExtras(pr)
+		}
+		var h hold
+		if err == nil {
+			h, err = config.scheduleUnlessHeld(b.Repo, pr, extras, []Build{build}, false)
+		}
+		unlock()
+		switch {
+		case err != nil:
+			log.Error(err)
+			result.Error = err.Error()
+		case h.held():
+			result.Skipped = h.Reason
+		case !extras.labelled(build) || !extras.triaged(build):
+			result.Skipped = "waiting for its label or triage"
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func cancelBuildHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+
+	// decode the body
+	decoder := json.NewDecoder(r.Body)
+	var b requestBuild
+	if err := decoder.Decode(&b); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the cancel request as json failed: %v", err))
+		return
+	}
+
+	// get the builds, all of the repo without a context
+	var builds []Build
+	if b.Context == "" {
+		for _, build := range config.Builds {
+			if build.Repo == b.Repo {
+				builds = append(builds, build)
+			}
+		}
+	} else {
+		build, err := config.getBuildByContextAndRepo(b.Context, b.Repo)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		builds = append(builds, build)
+	}
+
+	defer lockPR(b.Repo, b.Number)()
+	for _, build := range builds {
+		if err := config.cancelBuild(build, b.Number, b.Sha); err != nil {
+			writeFailure(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(204)
+	return
+}
+
+// buildStatusHandler returns the build records of a pull request
+func buildStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	repo := r.URL.Query().Get("repo")
+	number, err := strconv.Atoi(r.URL.Query().Get("pr"))
+	if repo == "" || err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("repo and pr are required"))
 		return
 	}
 
-	// get PRs that have failed for the context
-	nums, err := config.getFailedPRs(b.Context, b.Repo)
+	records, err := getBuildRecords(repo + "/")
 	if err != nil {
-		log.Error(err)
-		w.WriteHeader(500)
+		writeFailure(w, err)
 		return
 	}
 
-	for _, prNum := range nums {
-		// schedule the jenkins build
-		if err := config.scheduleJenkinsBuild(b.Repo, prNum, build); err != nil {
-			log.Error(err)
+	pr := []buildRecord{}
+	for _, record := range records {
+		if record.PR == number {
+			pr = append(pr, record)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pr)
+}
+
+type requestCronBuild struct {
+	Repo    string `json:"repo"`
+	Context string `json:"context"`
+	prFilter
+}
+
+func cronBuildHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+
+	// decode the body
+	decoder := json.NewDecoder(r.Body)
+	var b requestCronBuild
+	if err := decoder.Decode(&b); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the retry request as json failed: %v", err))
+		return
+	}
+	if err := b.validate(); err != nil {
+		writeError(w, 400, errInvalidRequest, err)
+		return
+	}
+
+	// only report what the sweep would do
+	if r.URL.Query().Get("report") == "1" {
+		if _, err := config.getBuildByContextAndRepo(b.Context, b.Repo); err != nil {
+			writeFailure(w, err)
+			return
 		}
+		decisions, err := config.sweepDecisions(b.Context, b.Repo, b.prFilter)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(decisions)
+		return
+	}
+
+	if err := config.retryFailedPRs(b.Repo, b.Context, b.prFilter); err != nil {
+		writeFailure(w, err)
+		return
 	}
 
 	w.WriteHeader(204)
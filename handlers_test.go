@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"leeroy/github"
+)
+
+// deliver sends a GitHub delivery to githubHandler, signed with secret
+// unless it is empty
+func deliver(event, guid, body, secret string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/notification/github", strings.NewReader(body))
+	r.Header.Set("X-GitHub-Event", event)
+	r.Header.Set("X-GitHub-Delivery", guid)
+	if secret != "" {
+		r.Header.Set("X-Hub-Signature-256", github.Sign(secret, []byte(body)))
+	}
+	w := httptest.NewRecorder()
+	githubHandler(w, r)
+	return w
+}
+
+// a membership hook which is skipped without calling GitHub
+const removedMember = `{"action": "removed"}`
+
+func TestGitHubHandlerEvents(t *testing.T) {
+	setup(t, Config{})
+
+	for _, tt := range []struct {
+		event string
+		want  int
+	}{
+		{"", 400},
+		{"ping", 200},
+		{"gollum", 204},
+		{"membership", 200},
+	} {
+		if w := deliver(tt.event, "", removedMember, ""); w.Code != tt.want {
+			t.Errorf("got %d for a %q delivery, want %d", w.Code, tt.event, tt.want)
+		}
+	}
+
+	if w := deliver("membership", "", "{", ""); w.Code != 400 {
+		t.Errorf("got %d for an invalid payload, want 400", w.Code)
+	}
+}
+
+func TestGitHubHandlerRedeliveries(t *testing.T) {
+	setup(t, Config{})
+
+	// the permanent failures are not handled again
+	if w := deliver("push", "guid-1", "{", ""); w.Code != 400 {
+		t.Fatalf("got %d for an invalid payload, want 400", w.Code)
+	}
+	if w := deliver("push", "guid-1", "{", ""); w.Code != 200 {
+		t.Errorf("got %d for a redelivery, want it ignored with 200", w.Code)
+	}
+	if w := deliver("push", "guid-2", "{", ""); w.Code != 400 {
+		t.Errorf("got %d for another delivery, want it handled", w.Code)
+	}
+}
+
+func TestGitHubHandlerSignature(t *testing.T) {
+	setup(t, Config{GHWebhook: githubWebhook{Secret: "secret"}})
+
+	for _, tt := range []struct {
+		name   string
+		secret string
+		want   int
+	}{
+		{"unsigned", "", 401},
+		{"wrong secret", "other", 401},
+		{"signed", "secret", 200},
+	} {
+		if w := deliver("membership", "", removedMember, tt.secret); w.Code != tt.want {
+			t.Errorf("got %d for the %s delivery, want %d", w.Code, tt.name, tt.want)
+		}
+	}
+
+	// a forged delivery does not make the genuine one look handled
+	if w := deliver("push", "guid", "{", "other"); w.Code != 401 {
+		t.Fatalf("got %d for a forged delivery, want 401", w.Code)
+	}
+	if w := deliver("push", "guid", "{", "secret"); w.Code != 400 {
+		t.Errorf("got %d for the genuine delivery, want it handled", w.Code)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"zen": "Keep it logically awesome."}`)
+	signature := github.Sign("secret", body)
+
+	if !github.VerifySignature("secret", signature, body) {
+		t.Error("rejected a valid signature")
+	}
+	for _, s := range []string{"", strings.TrimPrefix(signature, "sha256="), github.Sign("other", body)} {
+		if github.VerifySignature("secret", s, body) {
+			t.Errorf("accepted the signature %q", s)
+		}
+	}
+	if github.VerifySignature("secret", signature, append(body, ' ')) {
+		t.Error("accepted the signature of another body")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// pullRequestHookExtras holds the fields of pull request hooks which
+// octokat does not parse
+type pullRequestHookExtras struct {
+	Label   *github.Label `json:"label"`
+	Changes struct {
+		Base *struct {
+			Ref struct {
+				From string `json:"from"`
+			} `json:"ref"`
+		} `json:"base"`
+	} `json:"changes"`
+	PullRequest struct {
+		Labels    []github.Label    `json:"labels"`
+		Milestone *github.Milestone `json:"milestone"`
+	} `json:"pull_request"`
+	// the X-GitHub-Delivery of the hook, passed along to the builds
+	Delivery string `json:"-"`
+}
+
+// listedExtras returns the extras of a pull request which was listed
+// rather than received in a hook
+func listedExtras(pr *github.ListedPullRequest) (extras pullRequestHookExtras) {
+	extras.PullRequest.Labels = pr.Labels
+	extras.PullRequest.Milestone = pr.Milestone
+	return extras
+}
+
+// pullRequestExtras returns the extras of a pull request which was
+// neither received in a hook nor listed, eg. for the comment commands
+func (c Config) pullRequestExtras(pr *github.PullRequest) (extras pullRequestHookExtras, err error) {
+	issue, err := c.githubClient().Issue(pr.Repo, pr.Number)
+	if err != nil {
+		return extras, githubError{errors.Wrapf(err, "getting the labels of %s/%s #%d failed", pr.Repo.UserName, pr.Repo.Name, pr.Number)}
+	}
+	extras.PullRequest.Labels = issue.Labels
+	extras.PullRequest.Milestone = issue.Milestone
+	return extras, nil
+}
+
+// hasLabel checks if the pull request has the label
+func (e pullRequestHookExtras) hasLabel(name string) bool {
+	for _, l := range e.PullRequest.Labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// labelled checks if the pull request has the label gating the build
+func (e pullRequestHookExtras) labelled(build Build) bool {
+	return build.Label == "" || e.hasLabel(build.Label)
+}
+
+// triaged checks if the pull request was triaged for builds which are
+// deferred until then, either with a milestone or with a label
+func (e pullRequestHookExtras) triaged(build Build) bool {
+	if !build.RequireMilestone && build.TriageLabel == "" {
+		return true
+	}
+	return (build.RequireMilestone && e.PullRequest.Milestone != nil) ||
+		(build.TriageLabel != "" && e.hasLabel(build.TriageLabel))
+}
+
+// gateHook schedules the builds whose label or triage gate was just
+// opened by a label or milestone, and cancels the builds gated by a
+// label which was removed
+func gateHook(w http.ResponseWriter, prHook *octokat.PullRequestHook, repo string, extras pullRequestHookExtras) {
+	label := ""
+	if extras.Label != nil {
+		label = extras.Label.Name
+	}
+
+	// the override label lets size/XL pull requests build
+	override := ""
+	if s := config.sizeCheck(repo); s != nil {
+		override = s.OverrideLabel
+	}
+	// and the commits override label the ones with an unclean history
+	commits := ""
+	if k := config.commitsCheck(repo); k != nil {
+		commits = k.OverrideLabel
+		if prHook.Action == "labeled" && commits != "" && commits == label {
+			if err := config.overrideCommits(repo, prHook.PullRequest.Head.Sha, label); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+	// the full build label runs the builds of all the subprojects
+	full := ""
+	if s := config.subprojectBuilds(repo); s != nil {
+		full = s.fullLabel()
+	}
+
+	var opened, closed []Build
+	for _, build := range config.Builds {
+		if build.Repo != repo || build.Custom {
+			continue
+		}
+
+		switch prHook.Action {
+		case "labeled":
+			// the milestone already triaged the pr
+			alreadyTriaged := build.RequireMilestone && extras.PullRequest.Milestone != nil
+			if (build.Label == label && extras.triaged(build)) ||
+				(build.TriageLabel == label && !alreadyTriaged && extras.labelled(build)) ||
+				(override != "" && override == label && extras.labelled(build) && extras.triaged(build)) ||
+				(commits != "" && commits == label && extras.labelled(build) && extras.triaged(build)) ||
+				(full != "" && full == label && extras.labelled(build) && extras.triaged(build)) {
+				opened = append(opened, build)
+			}
+		case "unlabeled":
+			if build.Label == label {
+				closed = append(closed, build)
+			}
+		case "milestoned":
+			// the triage label already triaged the pr
+			alreadyTriaged := build.TriageLabel != "" && extras.hasLabel(build.TriageLabel)
+			if build.RequireMilestone && !alreadyTriaged && extras.labelled(build) {
+				opened = append(opened, build)
+			}
+		}
+	}
+
+	number := prHook.PullRequest.Number
+	for _, build := range closed {
+		if err := config.cancelBuild(build, number, prHook.PullRequest.Head.Sha); err != nil {
+			writeFailure(w, err)
+		}
+	}
+
+	if len(opened) == 0 {
+		log.Debugf("No builds of %s are gated by the %s action", repo, prHook.Action)
+		return
+	}
+
+	pr, err := config.githubClient().LoadPullRequest(prHook)
+	if err != nil {
+		writeError(w, 502, errGitHub, fmt.Errorf("Error loading the pull request: %v", err))
+		return
+	}
+
+	hold, err := config.holdReason(repo, pr, extras)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if hold.held() {
+		log.Debugf("Not building %s #%d: %s", repo, number, hold.Reason)
+		return
+	}
+
+	for _, build := range opened {
+		if build.Downstream {
+			continue
+		}
+		build.Delivery = extras.Delivery
+		if err := config.scheduleBuild(repo, pr, config.forceRebuild(build)); err != nil {
+			writeFailure(w, err)
+		}
+	}
+}
+
+// checkHookPayload holds the fields shared by check_run and check_suite hooks
+type checkHookPayload struct {
+	Action   string `json:"action"`
+	CheckRun *struct {
+		Name         string             `json:"name"`
+		HeadSha      string             `json:"head_sha"`
+		PullRequests []checkPullRequest `json:"pull_requests"`
+	} `json:"check_run"`
+	CheckSuite *struct {
+		HeadSha      string             `json:"head_sha"`
+		PullRequests []checkPullRequest `json:"pull_requests"`
+	} `json:"check_suite"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+type checkPullRequest struct {
+	Number int `json:"number"`
+}
+
+// checkHook reschedules builds when the "Re-run" button of a check run
+// or check suite is used. A check run maps to the build whose context is
+// the check's name, a check suite to all the builds of the repo.
+func checkHook(w http.ResponseWriter, event string, body []byte, delivery string) {
+	var hook checkHookPayload
+	if err := json.Unmarshal(body, &hook); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing %s hook: %v", event, err))
+		return
+	}
+
+	if hook.Action != "rerequested" {
+		log.Debugf("Ignoring %s hook action %q", event, hook.Action)
+		return
+	}
+
+	repo := hook.Repository.FullName
+	var (
+		builds []Build
+		prs    []checkPullRequest
+		err    error
+	)
+	switch {
+	case hook.CheckRun != nil:
+		log.Infof("Check run %s was rerequested for %s %s", hook.CheckRun.Name, repo, hook.CheckRun.HeadSha)
+		build, err := config.getBuildByContextAndRepo(hook.CheckRun.Name, repo)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		builds = []Build{build}
+		prs = hook.CheckRun.PullRequests
+	case hook.CheckSuite != nil:
+		log.Infof("Check suite was rerequested for %s %s", repo, hook.CheckSuite.HeadSha)
+		if builds, err = config.getBuilds(repo, false); err != nil {
+			log.Error(err)
+			return
+		}
+		prs = hook.CheckSuite.PullRequests
+	}
+
+	for _, p := range prs {
+		unlock := lockPR(repo, p.Number)
+		pr, err := config.loadPullRequest(repo, p.Number)
+		if err != nil {
+			unlock()
+			writeFailure(w, err)
+			return
+		}
+		extras, err := config.pullRequestExtras(pr)
+		if err != nil {
+			unlock()
+			writeFailure(w, err)
+			return
+		}
+
+		var rerun []Build
+		for _, build := range builds {
+			// builds gated by a label are only
+			// rerun through their own check run
+			if build.Downstream || (build.Label != "" && hook.CheckRun == nil) {
+				continue
+			}
+			build.Delivery = delivery
+			rerun = append(rerun, config.manualRebuild(build))
+		}
+		// a re-run resumes stale pull requests like a /retest
+		if _, err := config.scheduleUnlessHeld(repo, pr, extras, rerun, true); err != nil {
+			writeFailure(w, err)
+		}
+		unlock()
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// the classes of the failed builds
+const (
+	infraFailure = "infrastructure"
+	codeFailure  = "code"
+)
+
+// bytes of the end of the console log matched against the patterns
+const failureConsoleSize = 64 * 1024
+
+// failurePattern classifies the failed builds whose console log matches
+// the regular expression, eg. agent disconnects as "infrastructure"
+// failures. The first matching pattern wins, so "code" patterns can keep
+// some failures out of broader infrastructure ones.
+type failurePattern struct {
+	Pattern string `json:"pattern"`
+	// "infrastructure" or "code"
+	Class string `json:"class"`
+}
+
+func (p failurePattern) validate() error {
+	if p.Class != infraFailure && p.Class != codeFailure {
+		return fmt.Errorf("unknown failure class %q", p.Class)
+	}
+	if _, err := regexp.Compile(p.Pattern); err != nil {
+		return fmt.Errorf("invalid failure pattern %q: %v", p.Pattern, err)
+	}
+	return nil
+}
+
+// classifyFailure returns the class of a failed jenkins build of job from
+// its console log, failures are blamed on the code unless a pattern says
+// otherwise
+func (c Config) classifyFailure(build Build, job string, number int) string {
+	if len(build.FailurePatterns) == 0 {
+		return codeFailure
+	}
+
+	console, err := c.jenkins().GetConsoleTail(job, number, failureConsoleSize)
+	if err != nil {
+		log.Warnf("Getting the console of %s %d to classify its failure failed: %v", job, number, err)
+		return codeFailure
+	}
+	for _, p := range build.FailurePatterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(console) {
+			log.Infof("Classified the failure of %s %d as %s by %q", job, number, p.Class, p.Pattern)
+			return p.Class
+		}
+	}
+	return codeFailure
+}
+
+func infraRetryKey(repo, sha, context string) string {
+	return "infra-retry/" + repo + "/" + sha + "/" + context
+}
+
+// retryInfraFailure runs the build of job again with the same parameters
+// unless it was already retried infra_retries times, and reports whether
+// it did
+func (c Config) retryInfraFailure(build Build, job string, number int, repo, sha string) bool {
+	key := infraRetryKey(repo, sha, build.Context)
+	retries := 0
+	if v, err := state.Get(key); err == nil {
+		retries, _ = strconv.Atoi(string(v))
+	}
+	if retries >= build.InfraRetries {
+		return false
+	}
+
+	b, err := c.jenkins().GetBuild(job, number)
+	if err != nil {
+		log.Errorf("Getting the parameters of %s %d to retry it failed: %v", job, number, err)
+		return false
+	}
+	// the build may have run on the fork job
+	retry := build
+	retry.Job = job
+	if err := c.sendBuild(retry, b.Actions.Parameters()); err != nil {
+		log.Errorf("Retrying %s %d failed: %v", job, number, err)
+		return false
+	}
+
+	if err := state.Set(key, []byte(strconv.Itoa(retries+1)), buildRecordTTL); err != nil {
+		log.Errorf("Saving the retries of %s %d failed: %v", job, number, err)
+	}
+	log.Infof("Retrying %s %d after an infrastructure failure (%d/%d)", job, number, retries+1, build.InfraRetries)
+	return true
+}
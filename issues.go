@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"leeroy/events"
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+)
+
+const (
+	defaultFailureLabel = "ci-failure"
+	// bytes of the end of the console log quoted in the issues
+	consoleExcerptSize = 4096
+	// the failure issue key holds this while the issue is being opened
+	failureIssueClaim    = "opening"
+	failureIssueClaimTTL = 5 * time.Minute
+)
+
+// FailureIssues opens an issue when a build of one of the branches of the
+// repo fails, eg. on main or the release branches. Later failures are
+// added to it, and it is closed once the build is green again.
+type FailureIssues struct {
+	Repo string `json:"github_repo"`
+	// branch names or path.Match patterns, eg. "release-*"
+	Branches []string `json:"branches"`
+	Label    string   `json:"label"`
+}
+
+func (f FailureIssues) label() string {
+	if f.Label != "" {
+		return f.Label
+	}
+	return defaultFailureLabel
+}
+
+// failureIssueData is passed to the ci-failure and ci-fixed templates
+type failureIssueData struct {
+	events.Event
+	// the last sha the build succeeded on, if known
+	LastGreen string
+	Commits   []github.Commit
+	Console   string
+}
+
+func init() {
+	registerPlugin("failure-issues", func(c Config) bool {
+		return len(c.FailureIssues) > 0
+	}, func(c Config) error {
+		events.Subscribe(events.BuildCompleted, func(e events.Event) {
+			c.reportBranchBuild(e)
+		})
+		return nil
+	})
+}
+
+// failureIssues returns the failure issues config of the repo, if any
+func (c Config) failureIssues(repo string) *FailureIssues {
+	for i := range c.FailureIssues {
+		if c.FailureIssues[i].Repo == repo {
+			return &c.FailureIssues[i]
+		}
+	}
+	return nil
+}
+
+func failureIssueKey(e events.Event) string {
+	return "failure-issue/" + e.Repo + "/" + e.Branch + "/" + e.Context
+}
+
+func lastGreenKey(e events.Event) string {
+	return "last-green/" + e.Repo + "/" + e.Branch + "/" + e.Context
+}
+
+// reportBranchBuild files or updates the issue of a failed build of a
+// branch, and closes it once the build succeeds
+func (c Config) reportBranchBuild(e events.Event) {
+	// the failures of the infrastructure are not breakages of the branch
+	if e.PR != 0 || e.Branch == "" || (e.State != "success" && e.Infrastructure) {
+		return
+	}
+	f := c.failureIssues(e.Repo)
+	if f == nil || !matchesAny(e.Branch, f.Branches) {
+		return
+	}
+
+	r := strings.SplitN(e.Repo, "/", 2)
+	if len(r) < 2 {
+		return
+	}
+	repo := octokat.Repo{UserName: r[0], Name: r[1]}
+	g := c.githubClient()
+
+	issue := 0
+	if b, err := state.Get(failureIssueKey(e)); err == nil {
+		issue, _ = strconv.Atoi(string(b))
+	}
+
+	if e.State == "success" {
+		if err := state.Set(lastGreenKey(e), []byte(e.Sha), 0); err != nil {
+			log.Errorf("Saving the last green build of %s %s (%s) failed: %v", e.Repo, e.Branch, e.Context, err)
+		}
+		if issue == 0 {
+			return
+		}
+
+		if comment, err := g.Templates.Render(repo, github.CIFixedTemplate, failureIssueData{Event: e}); err != nil {
+			log.Error(err)
+		} else if err := g.CommentIssue(repo, issue, comment); err != nil {
+			log.Error(err)
+		}
+		if err := g.CloseIssue(repo, issue); err != nil {
+			log.Error(err)
+			return
+		}
+		state.Delete(failureIssueKey(e))
+		log.Infof("Closed the failure issue #%d of %s %s (%s)", issue, e.Repo, e.Branch, e.Context)
+		return
+	}
+
+	data := failureIssueData{Event: e}
+	if b, err := state.Get(lastGreenKey(e)); err == nil {
+		data.LastGreen = string(b)
+		if data.Commits, err = g.CompareCommits(repo, data.LastGreen, e.Sha); err != nil {
+			log.Warnf("Getting the commits since the last green build of %s %s failed: %v", e.Repo, e.Branch, err)
+		}
+	}
+	if e.Number > 0 {
+		build, err := c.getBuildByContextAndRepo(e.Context, e.Repo)
+		if err == nil && (build.Backend == "" || build.Backend == "jenkins") {
+			if data.Console, err = c.jenkins().GetConsoleTail(e.Job, e.Number, consoleExcerptSize); err != nil {
+				log.Warnf("Getting the console of %s %d failed: %v", e.Job, e.Number, err)
+			}
+		}
+	}
+
+	body, err := g.Templates.Render(repo, github.CIFailureTemplate, data)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if issue != 0 {
+		if err := g.CommentIssue(repo, issue, body); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	// claimed first, so the failures reported at once by several builds
+	// or instances open a single issue
+	claimed, err := state.SetNX(failureIssueKey(e), []byte(failureIssueClaim), failureIssueClaimTTL)
+	if err != nil {
+		log.Errorf("Claiming the failure issue of %s %s (%s) failed: %v", e.Repo, e.Branch, e.Context, err)
+		return
+	}
+	if !claimed {
+		log.Infof("The failure issue of %s %s (%s) is already being opened", e.Repo, e.Branch, e.Context)
+		return
+	}
+
+	title := e.Context + " is failing on " + e.Branch
+	if issue, err = g.CreateIssue(repo, title, body, []string{f.label()}); err != nil {
+		log.Error(err)
+		state.Delete(failureIssueKey(e))
+		return
+	}
+	if err := state.Set(failureIssueKey(e), []byte(strconv.Itoa(issue)), 0); err != nil {
+		log.Errorf("Saving the failure issue of %s %s (%s) failed: %v", e.Repo, e.Branch, e.Context, err)
+	}
+	log.Infof("Opened the failure issue #%d of %s %s (%s)", issue, e.Repo, e.Branch, e.Context)
+}
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 type Client struct {
@@ -31,6 +35,63 @@ type JenkinsBuildParameters struct {
 	GitHeadRepo string `json:"GIT_HEAD_REPO"`
 	GitSha      string `json:"GIT_SHA1"`
 	PR          string `json:"PR"`
+	// set by the git plugin for the builds of branches, eg. "origin/main"
+	GitBranch string `json:"GIT_BRANCH"`
+	// set on the builds of the commits leeroy bisects
+	Bisect string `json:"LEEROY_BISECT"`
+	// set on the builds scheduled by the canary config
+	Canary string `json:"LEEROY_CANARY"`
+}
+
+// Actions are the actions of a build or queue item, which hold its
+// parameters
+type Actions []struct {
+	Parameters []struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	} `json:"parameters"`
+}
+
+// Parameter returns the value of a build parameter as a string
+func (actions Actions) Parameter(name string) string {
+	for _, a := range actions {
+		for _, p := range a.Parameters {
+			if p.Name == name {
+				return fmt.Sprint(p.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// Parameters returns all the build parameters as strings
+func (actions Actions) Parameters() map[string]string {
+	parameters := map[string]string{}
+	for _, a := range actions {
+		for _, p := range a.Parameters {
+			parameters[p.Name] = fmt.Sprint(p.Value)
+		}
+	}
+	return parameters
+}
+
+// JobBuild is a build as described by the build and job apis
+type JobBuild struct {
+	Number   int    `json:"number"`
+	Building bool   `json:"building"`
+	Url      string `json:"url"`
+	// SUCCESS, FAILURE, UNSTABLE or ABORTED once the build completed
+	Result string `json:"result"`
+	// start time and duration in milliseconds
+	Timestamp int64   `json:"timestamp"`
+	Duration  int64   `json:"duration"`
+	QueueId   int     `json:"queueId"`
+	Actions   Actions `json:"actions"`
+}
+
+// Parameter returns the value of a build parameter as a string
+func (b JobBuild) Parameter(name string) string {
+	return b.Actions.Parameter(name)
 }
 
 type Request struct {
@@ -107,3 +168,313 @@ func (c *Client) BuildWithParameters(job string, parameters string) error {
 
 	return nil
 }
+
+// GetJobInstances returns the numbers of the running builds of job which
+// were scheduled for the pr, only the ones of sha if it is set. The
+// builds are filtered on their parameters here, as many jenkins instances
+// forbid the xpath filters of the xml api.
+func (c *Client) GetJobInstances(job string, pr string, sha string) ([]int, error) {
+	builds, err := c.ListRunningBuilds(job)
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, b := range builds {
+		if b.Parameter("PR") == pr && (sha == "" || b.Parameter("GIT_SHA1") == sha) {
+			numbers = append(numbers, b.Number)
+		}
+	}
+
+	return numbers, nil
+}
+
+// ParameterDefinition is a parameter a job is built with
+type ParameterDefinition struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// nil when the parameter has no default
+	Default *struct {
+		Value interface{} `json:"value"`
+	} `json:"defaultParameterValue"`
+}
+
+// GetParameterDefinitions returns the parameters job is built with
+func (c *Client) GetParameterDefinitions(job string) ([]ParameterDefinition, error) {
+	var j struct {
+		Property []struct {
+			ParameterDefinitions []ParameterDefinition `json:"parameterDefinitions"`
+		} `json:"property"`
+	}
+	url := fmt.Sprintf("%s/job/%s/api/json?tree=property[parameterDefinitions[name,type,defaultParameterValue[value]]]", c.Baseurl, job)
+	if err := c.get(url, &j); err != nil {
+		return nil, err
+	}
+
+	var definitions []ParameterDefinition
+	for _, p := range j.Property {
+		definitions = append(definitions, p.ParameterDefinitions...)
+	}
+	return definitions, nil
+}
+
+// buildTree selects the fields of JobBuild in the json api
+const buildTree = "number,building,url,result,timestamp,duration,queueId,actions[parameters[name,value]]"
+
+// ListRunningBuilds returns the running builds among the most recent
+// builds of job
+func (c *Client) ListRunningBuilds(job string) ([]JobBuild, error) {
+	var j struct {
+		Builds []JobBuild `json:"builds"`
+	}
+	url := fmt.Sprintf("%s/job/%s/api/json?tree=builds[%s]{0,50}", c.Baseurl, job, buildTree)
+	if err := c.get(url, &j); err != nil {
+		return nil, err
+	}
+
+	var running []JobBuild
+	for _, b := range j.Builds {
+		if b.Building {
+			running = append(running, b)
+		}
+	}
+	return running, nil
+}
+
+// GetBuild returns a build of job
+func (c *Client) GetBuild(job string, number int) (*JobBuild, error) {
+	var b JobBuild
+	url := fmt.Sprintf("%s/job/%s/%d/api/json?tree=%s", c.Baseurl, job, number, buildTree)
+	if err := c.get(url, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// QueueItem is a build waiting in the queue, Executable is set once it
+// left the queue to run
+type QueueItem struct {
+	Id           int    `json:"id"`
+	Why          string `json:"why"`
+	Blocked      bool   `json:"blocked"`
+	Stuck        bool   `json:"stuck"`
+	Cancelled    bool   `json:"cancelled"`
+	InQueueSince int64  `json:"inQueueSince"`
+	Task         struct {
+		Name string `json:"name"`
+		Url  string `json:"url"`
+	} `json:"task"`
+	Executable *struct {
+		Number int    `json:"number"`
+		Url    string `json:"url"`
+	} `json:"executable"`
+	Actions Actions `json:"actions"`
+}
+
+// Parameter returns the value of a build parameter as a string
+func (q QueueItem) Parameter(name string) string {
+	return q.Actions.Parameter(name)
+}
+
+// GetQueuedInstances returns the ids of the queue items of job which were
+// scheduled for the pr, only the ones of sha if it is set
+func (c *Client) GetQueuedInstances(job string, pr string, sha string) ([]int, error) {
+	var queue struct {
+		Items []QueueItem `json:"items"`
+	}
+	url := fmt.Sprintf("%s/queue/api/json?tree=items[id,task[name,url],actions[parameters[name,value]]]", c.Baseurl)
+	if err := c.get(url, &queue); err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, q := range queue.Items {
+		if q.Task.Name == job && q.Parameter("PR") == pr && (sha == "" || q.Parameter("GIT_SHA1") == sha) {
+			ids = append(ids, q.Id)
+		}
+	}
+	return ids, nil
+}
+
+// CancelQueueItem removes an item from the build queue
+func (c *Client) CancelQueueItem(id int) error {
+	url := fmt.Sprintf("%s/queue/cancelItem?id=%d", c.Baseurl, id)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte{}))
+	if err != nil {
+		return err
+	}
+
+	// add the auth
+	req.SetBasicAuth(c.Username, c.Token)
+
+	// do the request without following the redirect to the queue
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// check the status code
+	if resp.StatusCode != 200 && resp.StatusCode != 204 && resp.StatusCode != 302 {
+		return fmt.Errorf("jenkins post to %s responded with status %d", url, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetQueueItem returns an item of the build queue, which jenkins keeps
+// for a few minutes after the build left the queue
+func (c *Client) GetQueueItem(id int) (*QueueItem, error) {
+	var q QueueItem
+	url := fmt.Sprintf("%s/queue/item/%d/api/json", c.Baseurl, id)
+	if err := c.get(url, &q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// GetConsoleTail returns up to the last size bytes of the console log of
+// a build of job
+func (c *Client) GetConsoleTail(job string, number int, size int64) (string, error) {
+	url := fmt.Sprintf("%s/job/%s/%d/logText/progressiveText", c.Baseurl, job, number)
+
+	// jenkins reports the length of the log when starting past its end
+	resp, err := c.do("GET", fmt.Sprintf("%s?start=%d", url, int64(1)<<62))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	length, err := strconv.ParseInt(resp.Header.Get("X-Text-Size"), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("jenkins get %s did not report the length of the log: %v", url, err)
+	}
+
+	start := length - size
+	if start < 0 {
+		start = 0
+	}
+	resp, err = c.do("GET", fmt.Sprintf("%s?start=%d", url, start))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading the response from %s failed: %v", url, err)
+	}
+	return string(b), nil
+}
+
+// do sends an authenticated request without a body, which must be
+// answered with 200
+func (c *Client) do(method, url string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// add the auth
+	req.SetBasicAuth(c.Username, c.Token)
+
+	// do the request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the status code
+	// it should be 200
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("jenkins %s %s responded with status %d", strings.ToLower(method), url, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// get requests url and decodes the json response into v
+func (c *Client) get(url string, v interface{}) error {
+	resp, err := c.do("GET", url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("parsing the response from %s failed: %v", url, err)
+	}
+	return nil
+}
+
+// StopBuild aborts a running build of job
+func (c *Client) StopBuild(job string, number int) error {
+	url := fmt.Sprintf("%s/job/%s/%d/stop", c.Baseurl, job, number)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte{}))
+	if err != nil {
+		return err
+	}
+
+	// add the auth
+	req.SetBasicAuth(c.Username, c.Token)
+
+	// do the request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// check the status code
+	// jenkins redirects to the build page once stopped
+	if resp.StatusCode != 200 && resp.StatusCode != 302 {
+		return fmt.Errorf("jenkins post to %s responded with status %d", url, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Stage is a stage of a pipeline build as described by the wfapi of the
+// Pipeline Stage View plugin
+type Stage struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	DurationMillis int64  `json:"durationMillis"`
+}
+
+// GetStages returns the stages of a pipeline build of job
+func (c *Client) GetStages(job string, number int) ([]Stage, error) {
+	var run struct {
+		Stages []Stage `json:"stages"`
+	}
+	url := fmt.Sprintf("%s/job/%s/%d/wfapi/describe", c.Baseurl, job, number)
+	if err := c.get(url, &run); err != nil {
+		return nil, err
+	}
+	return run.Stages, nil
+}
+
+// LabelLoad is the use of the executors of the agents with a label
+type LabelLoad struct {
+	IdleExecutors  int `json:"idleExecutors"`
+	BusyExecutors  int `json:"busyExecutors"`
+	TotalExecutors int `json:"totalExecutors"`
+}
+
+// GetLabelLoad returns the use of the executors of the agents with label
+func (c *Client) GetLabelLoad(label string) (*LabelLoad, error) {
+	var l LabelLoad
+	u := fmt.Sprintf("%s/label/%s/api/json?tree=idleExecutors,busyExecutors,totalExecutors", c.Baseurl, url.PathEscape(label))
+	if err := c.get(u, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"leeroy/api"
+	"leeroy/azure"
+	"leeroy/github"
 	"leeroy/jenkins"
+	"leeroy/messages"
+	"leeroy/slack"
+	"leeroy/store"
+	"leeroy/webhook"
 )
 
 const (
@@ -22,20 +32,88 @@ var (
 	keyFile    string
 	port       string
 	configFile string
+	recordDir  string
 	debug      bool
 	version    bool
 
 	config Config
+	// translations of the status descriptions, loaded at startup
+	catalog *messages.Catalog
+	// shared by the GitHub clients when several tokens are configured
+	tokenPool *github.TokenPool
 )
 
 type Config struct {
-	Jenkins      jenkins.Client `json:"jenkins"`
-	BuildCommits string         `json:"build_commits"`
-	GHToken      string         `json:"github_token"`
-    GHUser       string         `json:"github_user"`
-	Builds       []Build        `json:"builds"`
-	User         string         `json:"user"`
-	Pass         string         `json:"pass"`
+	Jenkins            jenkins.Client      `json:"jenkins"`
+	Azure              azure.Client        `json:"azure"`
+	Webhook            webhook.Client      `json:"webhook"`
+	Email              emailDigest         `json:"email"`
+	Notifiers          []notifierConfig    `json:"notifiers"`
+	OutboundWebhooks   []outboundWebhook   `json:"outbound_webhooks"`
+	Metrics            metricsConfig       `json:"metrics"`
+	Slack              slack.Client        `json:"slack"`
+	Allowlist          allowlistConfig     `json:"allowlist"`
+	State              store.Config        `json:"state"`
+	Secrets            secretsConfig       `json:"secrets"`
+	Cron               []cronSweep         `json:"cron"`
+	RecentSize         int                 `json:"recent_size"`
+	BuildCommits       string              `json:"build_commits"`
+	ContextPrefix      string              `json:"context_prefix"`
+	GHToken            string              `json:"github_token"`
+	GHTokens           []string            `json:"github_tokens"`
+	GHTokenWarning     duration            `json:"github_token_warning"`
+	GHScopes           []string            `json:"github_scopes"`
+	GHWebhook          githubWebhook       `json:"github_webhook"`
+	GHUser             string              `json:"github_user"`
+	GHRetry            *githubRetry        `json:"github_retry"`
+	MergeableWindow    duration            `json:"mergeable_window"`
+	ConflictChecks     duration            `json:"conflict_check_interval"`
+	CommentTemplates   string              `json:"comment_templates"`
+	Messages           messages.Config     `json:"messages"`
+	Builds             []Build             `json:"builds"`
+	Checks             []Checks            `json:"checks"`
+	AutoMerge          []AutoMerge         `json:"auto_merge"`
+	ForkApprovals      []ForkApproval      `json:"fork_approvals"`
+	FastLanes          []FastLane          `json:"fast_lanes"`
+	Roles              *Roles              `json:"roles"`
+	Permissions        map[string]string   `json:"permissions"`
+	StalePRs           []StalePolicy       `json:"stale_prs"`
+	QueueETA           bool                `json:"queue_eta"`
+	Canary             canaryConfig        `json:"canary"`
+	BuildArchive       buildArchive        `json:"build_archive"`
+	OwnerBuilds        []OwnerBuilds       `json:"owner_builds"`
+	Subprojects        []Subproject        `json:"subprojects"`
+	SubprojectBuilds   []SubprojectBuilds  `json:"subproject_builds"`
+	Profiles           []Profile           `json:"profiles"`
+	ReservedExecutors  int                 `json:"reserved_executors"`
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows"`
+	FailureIssues      []FailureIssues     `json:"failure_issues"`
+	OnboardedBuilds    string              `json:"onboarded_builds"`
+	BaseRefresh        []BaseRefresh       `json:"base_refresh"`
+	User               string              `json:"user"`
+	Pass               string              `json:"pass"`
+	APIKeys            []apiKey            `json:"api_keys"`
+	AuditLog           string              `json:"audit_log"`
+
+	// the canary config only reads from github
+	shadow bool
+}
+
+// githubRetry configures the retries of the reads of the GitHub API,
+// unset fields keep the defaults
+type githubRetry struct {
+	Attempts  int      `json:"attempts"`
+	BaseDelay duration `json:"base_delay"`
+	MaxDelay  duration `json:"max_delay"`
+	Retryable []string `json:"retryable"`
+}
+
+// cronSweep retries the failed builds of a context periodically
+type cronSweep struct {
+	Repo     string   `json:"repo"`
+	Context  string   `json:"context"`
+	Interval duration `json:"interval"`
+	prFilter
 }
 
 type Build struct {
@@ -45,6 +123,114 @@ type Build struct {
 	Custom           bool     `json:"custom"`
 	Downstream       bool     `json:"downstream"`
 	DownstreamBuilds []string `json:"downstream_builds"`
+	BuildCommits     string   `json:"build_commits"`
+	Backend          string   `json:"backend"`
+	AzurePipeline    int      `json:"azure_pipeline_id"`
+	WebhookURL       string   `json:"webhook_url"`
+	Label            string   `json:"label"`
+	RequireMilestone bool     `json:"require_milestone"`
+	TriageLabel      string   `json:"triage_label"`
+	ForkJob          string   `json:"fork_job"`
+	// template of the url reported in the statuses of the jenkins builds
+	StatusURL string `json:"status_url"`
+	// templates of the url while the build runs and once it finished,
+	// overriding status_url for that phase
+	RunningURL  string `json:"running_url"`
+	FinishedURL string `json:"finished_url"`
+	// reports the stages of jenkins pipelines as their own statuses
+	ReportStages bool `json:"report_stages"`
+	// optional builds are deferred while the agents with the label are busy
+	Optional   bool   `json:"optional"`
+	AgentLabel string `json:"agent_label"`
+	// classify the failures by the console log, see failurePattern
+	FailurePatterns []failurePattern `json:"failure_patterns"`
+	// how many times infrastructure failures are retried
+	InfraRetries int `json:"infra_retries"`
+	// compare the parameters with the ones the jenkins job defines
+	CheckParameters bool `json:"check_parameters"`
+	// downstream builds only run when the pull request changes files
+	// matching these, prefixes ending with a slash or path.Match patterns
+	Paths []string `json:"paths"`
+	// report a success status when the build is not needed, eg. by the
+	// owner_builds, rather than leaving its context alone
+	ReportNotNeeded bool `json:"report_not_needed"`
+	// the builds of these branches are tracked as GitHub deployments
+	Deployments []Deployment `json:"deployments"`
+	// a failed build of a commit is not scheduled again automatically,
+	// eg. by the cron sweeps or duplicate hooks, for this long
+	Cooldown duration `json:"cooldown"`
+	// profile whose parameters are added when scheduling, set per request
+	Profile string `json:"-"`
+	// requested by a user, eg. with /retest, bypassing the cooldown
+	Manual bool `json:"-"`
+	// the GitHub delivery of the hook scheduling the build, set per request
+	Delivery string `json:"-"`
+	// pass the delivery to the job as GITHUB_DELIVERY, which the job
+	// has to define
+	ForwardDelivery bool `json:"forward_delivery"`
+	// shared with the jenkins notification endpoint url of the jobs
+	NotificationToken     string `json:"notification_token"`
+	ForkNotificationToken string `json:"fork_notification_token"`
+}
+
+// sandboxed returns the build to run for pull requests from forks, which
+// use the fork_job instead of the normal job when it is set
+func (b Build) sandboxed() Build {
+	if b.ForkJob != "" {
+		b.Job = b.ForkJob
+	}
+	return b
+}
+
+// jobToken returns the notification token of one of the build's jobs
+func (b Build) jobToken(job string) string {
+	if b.ForkJob != "" && job == b.ForkJob {
+		return b.ForkNotificationToken
+	}
+	return b.NotificationToken
+}
+
+// verifyNotification checks the token sent along with a notification
+// from one of the build's jobs, jobs without a token are not checked
+func (b Build) verifyNotification(job, token string) bool {
+	expected := b.jobToken(job)
+	if expected == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+// statusURL returns the url to report in the statuses of a jenkins build,
+// the console by default while it runs. The running_url, finished_url and
+// status_url templates can use {url}, {jenkins}, {job} and {number}.
+func (b Build) statusURL(jenkinsURL, job string, number int, url string, running bool) string {
+	template := b.FinishedURL
+	if running {
+		template = b.RunningURL
+	}
+	if template == "" {
+		template = b.StatusURL
+	}
+	if template == "" {
+		if running {
+			return url + "console"
+		}
+		return url
+	}
+	return strings.NewReplacer(
+		"{url}", url,
+		"{jenkins}", strings.TrimSuffix(jenkinsURL, "/"),
+		"{job}", job,
+		"{number}", strconv.Itoa(number),
+	).Replace(template)
+}
+
+// jobs returns the jenkins jobs the build may run on
+func (b Build) jobs() []string {
+	if b.ForkJob != "" {
+		return []string{b.Job, b.ForkJob}
+	}
+	return []string{b.Job}
 }
 
 func init() {
@@ -56,10 +242,13 @@ func init() {
 	flag.StringVar(&keyFile, "key", "", "path to ssl key")
 	flag.StringVar(&port, "port", "80", "port to use")
 	flag.StringVar(&configFile, "config", "/etc/leeroy/config.json", "path to config file")
-	flag.Parse()
+	flag.StringVar(&recordDir, "record", "", "directory to save the received notifications to as replay fixtures")
 }
 
 func main() {
+	// parsed here rather than in init so the tests can use their own flags
+	flag.Parse()
+
 	// set log level
 	if debug {
 		log.SetLevel(log.DebugLevel)
@@ -70,21 +259,96 @@ func main() {
 		return
 	}
 
-	// read the config file
-	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		log.Errorf("config file does not exist: %s", configFile)
-		return
+	switch cmd := flag.Arg(0); cmd {
+	case "", "serve":
+		serve()
+	default:
+		if err := runCommand(cmd, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// readConfig reads and parses the config file
+func readConfig(path string) (c Config, err error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return c, fmt.Errorf("config file does not exist: %s", path)
 	}
-	c, err := ioutil.ReadFile(configFile)
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Errorf("could not read config file: %v", err)
+		return c, fmt.Errorf("could not read config file: %v", err)
+	}
+	if b, err = decryptConfig(path, b); err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("error parsing config file as json: %v", err)
+	}
+	if c.OnboardedBuilds != "" {
+		builds, err := readOnboardedBuilds(c.OnboardedBuilds)
+		if err != nil {
+			return c, err
+		}
+		c.Builds = append(c.Builds, builds...)
+	}
+	return c, nil
+}
+
+// serve runs the leeroy server
+func serve() {
+	var err error
+	if config, err = readConfig(configFile); err != nil {
+		log.Error(err)
+		return
+	}
+
+	// set up the shared state
+	if state, err = store.New(config.State); err != nil {
+		log.Errorf("setting up the state store failed: %v", err)
 		return
 	}
-	if err := json.Unmarshal(c, &config); err != nil {
-		log.Errorf("error parsing config file as json: %v", err)
+
+	// load the translations
+	if catalog, err = messages.Load(config.Messages); err != nil {
+		log.Errorf("loading the message catalog failed: %v", err)
+		return
+	}
+
+	// read the credentials from the secret manager
+	if err := loadSecrets(config); err != nil {
+		log.Errorf("loading the secrets failed: %v", err)
 		return
 	}
 
+	// rotate the requests between the tokens
+	tokenPool = config.tokenPool()
+
+	// set up the optional features
+	if err := setupPlugins(config); err != nil {
+		log.Error(err)
+		return
+	}
+
+	// schedule the periodic sweeps, they only run on the leader
+	// instance when several share the state store
+	for _, sweep := range config.Cron {
+		sweep := sweep
+		if sweep.Interval.Duration <= 0 {
+			log.Errorf("cron sweep for %s (%s) needs an interval", sweep.Repo, sweep.Context)
+			return
+		}
+		if err := sweep.validate(); err != nil {
+			log.Errorf("cron sweep for %s (%s): %v", sweep.Repo, sweep.Context, err)
+			return
+		}
+		registerTask("cron "+sweep.Repo+" "+sweep.Context, sweep.Interval.Duration, func(c Config) {
+			if err := c.retryFailedPRs(sweep.Repo, sweep.Context, sweep.prFilter); err != nil {
+				log.Error(err)
+			}
+		})
+	}
+	startTasks(config)
+
 	// create mux server
 	mux := http.NewServeMux()
 
@@ -92,24 +356,79 @@ func main() {
 	mux.HandleFunc("/ping", pingHandler)
 
 	// jenkins notification endpoint
-	mux.HandleFunc("/notification/jenkins", jenkinsHandler)
+	mux.HandleFunc("/notification/jenkins", allowIPs("jenkins", recordRecent("jenkins", jenkinsHandler)))
+
+	// azure pipelines service hooks endpoint
+	mux.HandleFunc("/notification/azure", recordRecent("azure", azureHandler))
+
+	// generic webhook backend results endpoint
+	mux.HandleFunc("/notification/webhook", recordRecent("webhook", webhookHandler))
 
 	// github webhooks endpoint
-	mux.HandleFunc("/notification/github", githubHandler)
+	mux.HandleFunc("/notification/github", allowIPs("github", recordRecent("github", githubHandler)))
 
 	// retry build endpoint
 	mux.HandleFunc("/build/retry", customBuildHandler)
 
+	// cancel build endpoint
+	mux.HandleFunc("/build/cancel", cancelBuildHandler)
+
+	// build status endpoint
+	mux.HandleFunc("/build/status", buildStatusHandler)
+
 	// custom build endpoint
 	mux.HandleFunc("/build/custom", customBuildHandler)
 
+	// bulk custom build endpoint
+	mux.HandleFunc("/build/bulk", bulkBuildHandler)
+
 	// cron endpoint to reschedule bulk jobs
 	mux.HandleFunc("/build/cron", cronBuildHandler)
 
+	// slack slash commands
+	mux.HandleFunc("/slack/command", slackCommandHandler)
+
+	// atom feeds of the build results of each repo
+	mux.HandleFunc("/feed/", feedHandler)
+
+	// register the webhook and builds of new repos
+	mux.HandleFunc("/admin/onboard", onboardHandler)
+	mux.HandleFunc("/admin/webhooks", webhooksHandler)
+
+	// decisions of the canary config
+	mux.HandleFunc("/admin/canary", canaryHandler)
+
+	// bisect the breakage of branches
+	mux.HandleFunc("/admin/bisect", bisectHandler)
+
+	// recent notifications for debugging
+	mux.HandleFunc("/admin/recent", recentHandler)
+
+	// export and import of the state store
+	mux.HandleFunc("/admin/state", stateHandler)
+
+	// rate limits of the GitHub tokens
+	mux.HandleFunc("/admin/tokens", tokensHandler)
+
+	// live stream of the events
+	mux.HandleFunc("/events", eventsHandler)
+
+	// build durations and success rates
+	mux.HandleFunc("/api/stats", statsHandler)
+
+	// whether a branch passed the required contexts
+	mux.HandleFunc("/api/release-readiness/", readinessHandler)
+
+	// why the builds of a pull request are blocked
+	mux.HandleFunc("/api/pr/", authorizationHandler)
+
+	// the admin API over gRPC, only reachable over TLS
+	mux.Handle(api.Prefix, api.Handler(adminBackend{}))
+
 	// set up the server
 	server := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: recoverPanics(mux),
 	}
 
 	log.Printf("Starting server on port %q", port)
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"leeroy/store"
+)
+
+// setup replaces the config and the state store for the test, restoring
+// them once it is done
+func setup(t *testing.T, c Config) {
+	oldConfig, oldState := config, state
+	config, state = c, store.NewMemory()
+	t.Cleanup(func() {
+		config, state = oldConfig, oldState
+	})
+}
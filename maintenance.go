@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// deferred builds waiting for a maintenance window to end
+const maintenanceKey = "deferred/maintenance"
+
+// MaintenanceWindow is a time during which no builds are scheduled, eg.
+// the nightly backup of the Jenkins controller. Builds scheduled during
+// the window wait until it is over.
+type MaintenanceWindow struct {
+	Name string `json:"name"`
+	// cron expression of the starts of the window, eg. "0 2 * * *"
+	Start    string   `json:"start"`
+	Duration duration `json:"duration"`
+	// IANA time zone of the expression, local time by default
+	TimeZone string `json:"time_zone"`
+}
+
+// end returns when the window ends if it is open at t, or the zero time
+func (w MaintenanceWindow) end(t time.Time) (time.Time, error) {
+	schedule, err := parseCron(w.Start)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := time.Local
+	if w.TimeZone != "" {
+		if loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	// look for a start within the duration before t
+	t = t.In(loc).Truncate(time.Minute)
+	for start := t; t.Sub(start) < w.Duration.Duration; start = start.Add(-time.Minute) {
+		if schedule.matches(start) {
+			return start.Add(w.Duration.Duration), nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// maintenance returns the open maintenance window and when it ends, if
+// any
+func (c Config) maintenance() (*MaintenanceWindow, time.Time) {
+	now := time.Now()
+	for i, w := range c.MaintenanceWindows {
+		end, err := w.end(now)
+		if err != nil {
+			log.Warnf("maintenance window %s: %v", w.Name, err)
+			continue
+		}
+		if !end.IsZero() {
+			return &c.MaintenanceWindows[i], end
+		}
+	}
+	return nil, time.Time{}
+}
+
+// cronSchedule holds the values of the minute, hour, day of month, month
+// and day of week fields of a cron expression
+type cronSchedule [5]map[int]bool
+
+// the bounds of the fields of cron expressions
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// parseCron parses a cron expression with five fields, each a list of
+// values, ranges ("1-5") or "*", optionally with steps ("*/15")
+func parseCron(expr string) (schedule cronSchedule, err error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("cron expression %q does not have 5 fields", expr)
+	}
+
+	for i, field := range fields {
+		schedule[i] = map[int]bool{}
+		for _, part := range strings.Split(field, ",") {
+			lo, hi := cronBounds[i][0], cronBounds[i][1]
+			step := 1
+			if j := strings.Index(part, "/"); j >= 0 {
+				if step, err = strconv.Atoi(part[j+1:]); err != nil || step < 1 {
+					return schedule, fmt.Errorf("invalid step in %q", field)
+				}
+				part = part[:j]
+			}
+
+			switch {
+			case part == "*":
+			case strings.Contains(part, "-"):
+				r := strings.SplitN(part, "-", 2)
+				if lo, err = strconv.Atoi(r[0]); err != nil {
+					return schedule, fmt.Errorf("invalid range in %q", field)
+				}
+				if hi, err = strconv.Atoi(r[1]); err != nil {
+					return schedule, fmt.Errorf("invalid range in %q", field)
+				}
+			default:
+				if lo, err = strconv.Atoi(part); err != nil {
+					return schedule, fmt.Errorf("invalid value in %q", field)
+				}
+				if step == 1 {
+					hi = lo
+				}
+			}
+			if lo < cronBounds[i][0] || hi > cronBounds[i][1] || lo > hi {
+				return schedule, fmt.Errorf("%q is out of range", field)
+			}
+
+			for v := lo; v <= hi; v += step {
+				schedule[i][v] = true
+			}
+		}
+	}
+	return schedule, nil
+}
+
+// matches checks if t matches every field of the schedule
+func (s cronSchedule) matches(t time.Time) bool {
+	return s[0][t.Minute()] && s[1][t.Hour()] && s[2][t.Day()] && s[3][int(t.Month())] && s[4][int(t.Weekday())]
+}
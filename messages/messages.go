@@ -0,0 +1,90 @@
+package messages
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Config selects the catalog and the languages of the repos
+type Config struct {
+	// directory of the catalog, a "<language>.json" file per language
+	Dir string `json:"dir"`
+	// language of the repos not listed in Repos, English if unset
+	Language string `json:"language"`
+	// languages of single repos, by "owner/name"
+	Repos map[string]string `json:"repos"`
+}
+
+// Catalog translates the status descriptions leeroy reports. The
+// translations of each language map the English messages, with their fmt
+// verbs, to the translated ones. Messages without a translation are
+// reported in English.
+type Catalog struct {
+	config       Config
+	translations map[string]map[string]string
+}
+
+// Load reads the catalog of every language in the config
+func Load(config Config) (*Catalog, error) {
+	c := &Catalog{
+		config:       config,
+		translations: map[string]map[string]string{},
+	}
+
+	languages := map[string]bool{}
+	if config.Language != "" {
+		languages[config.Language] = true
+	}
+	for _, language := range config.Repos {
+		languages[language] = true
+	}
+	if len(languages) > 0 && config.Dir == "" {
+		return nil, fmt.Errorf("the languages of the repos need a catalog dir")
+	}
+
+	for language := range languages {
+		path := filepath.Join(config.Dir, language+".json")
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading the %s catalog failed: %v", language, err)
+		}
+
+		var translations map[string]string
+		if err := json.Unmarshal(b, &translations); err != nil {
+			return nil, fmt.Errorf("parsing %s failed: %v", path, err)
+		}
+		for message, translation := range translations {
+			if strings.Count(message, "%") != strings.Count(translation, "%") {
+				return nil, fmt.Errorf("%s: the translation of %q does not have the same verbs", path, message)
+			}
+		}
+		c.translations[language] = translations
+	}
+
+	return c, nil
+}
+
+// Language returns the language of the repo, "" for English
+func (c *Catalog) Language(repo string) string {
+	if c == nil {
+		return ""
+	}
+	if language, ok := c.config.Repos[repo]; ok {
+		return language
+	}
+	return c.config.Language
+}
+
+// Sprintf formats the translation of the message for the repo like
+// fmt.Sprintf, a nil catalog formats the English message
+func (c *Catalog) Sprintf(repo, format string, args ...interface{}) string {
+	if c != nil {
+		if translation, ok := c.translations[c.Language(repo)][format]; ok {
+			format = translation
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"leeroy/events"
+	"leeroy/metrics"
+)
+
+// metricsConfig selects where the metrics are pushed to
+type metricsConfig struct {
+	Statsd *statsdConfig `json:"statsd"`
+}
+
+type statsdConfig struct {
+	// "host:port" of the agent
+	Address string `json:"address"`
+	Prefix  string `json:"prefix"`
+	// send the tags the DogStatsD way, eg. to the Datadog agent
+	DogStatsD bool `json:"dogstatsd"`
+}
+
+// emitter records the metrics, they are dropped unless configured
+var emitter metrics.Emitter = metrics.Nop{}
+
+func init() {
+	registerPlugin("metrics", func(c Config) bool {
+		return c.Metrics.Statsd != nil
+	}, setupMetrics)
+}
+
+// setupMetrics records the metrics of the events
+func setupMetrics(c Config) error {
+	s := c.Metrics.Statsd
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "leeroy"
+	}
+	statsd, err := metrics.NewStatsd(s.Address, prefix, s.DogStatsD)
+	if err != nil {
+		return err
+	}
+	emitter = statsd
+
+	events.SubscribeAll(recordMetrics)
+	return nil
+}
+
+// recordMetrics counts the events, along with how long the completed
+// builds took since they were scheduled
+func recordMetrics(e events.Event) {
+	tags := metrics.Tags{"repo": e.Repo}
+	switch e.Type {
+	case events.PRReceived:
+		emitter.Count("hooks.received", 1, tags)
+	case events.AuthDenied:
+		emitter.Count("auth.denied", 1, tags)
+	case events.HandlerPanic:
+		emitter.Count("http.panics", 1, nil)
+	case events.BuildScheduled:
+		tags["context"] = e.Context
+		emitter.Count("builds.scheduled", 1, tags)
+	case events.BuildCompleted:
+		tags["context"] = e.Context
+		// counted apart from the failures of the code
+		if e.Infrastructure {
+			emitter.Count("builds.infra_errors", 1, tags)
+			return
+		}
+		tags["state"] = e.State
+		emitter.Count("builds.completed", 1, tags)
+
+		if record, err := getBuildRecord(e.Repo, e.Sha, e.Context); err == nil && !record.Scheduled.IsZero() {
+			emitter.Timing("builds.duration", e.Time.Sub(record.Scheduled), tags)
+		}
+	}
+}
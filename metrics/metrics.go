@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Tags describe what a metric is about, eg. the repo and context of a
+// build. Backends without tags fold them into the metric name.
+type Tags map[string]string
+
+// Emitter records the metrics of leeroy, every backend gets the same
+// metric set
+type Emitter interface {
+	// Count adds value to the counter name
+	Count(name string, value int64, tags Tags)
+	// Timing records a duration of name
+	Timing(name string, d time.Duration, tags Tags)
+	// Gauge sets the current value of name
+	Gauge(name string, value float64, tags Tags)
+}
+
+// Nop drops all the metrics, for when none are configured
+type Nop struct{}
+
+// Count does nothing
+func (Nop) Count(name string, value int64, tags Tags) {}
+
+// Timing does nothing
+func (Nop) Timing(name string, d time.Duration, tags Tags) {}
+
+// Gauge does nothing
+func (Nop) Gauge(name string, value float64, tags Tags) {}
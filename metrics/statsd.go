@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Statsd pushes the metrics to a statsd agent over udp. With DogStatsD
+// the tags are sent as such, plain statsd appends their values to the
+// metric names.
+type Statsd struct {
+	prefix    string
+	dogstatsd bool
+	conn      net.Conn
+}
+
+// NewStatsd returns an emitter sending the metrics to the agent at addr,
+// eg. "localhost:8125", with their names prefixed by prefix
+func NewStatsd(addr, prefix string, dogstatsd bool) (*Statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to statsd at %s failed: %v", addr, err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &Statsd{prefix: prefix, dogstatsd: dogstatsd, conn: conn}, nil
+}
+
+// Count adds value to the counter name
+func (s *Statsd) Count(name string, value int64, tags Tags) {
+	s.send(name, fmt.Sprintf("%d|c", value), tags)
+}
+
+// Timing records a duration of name in milliseconds
+func (s *Statsd) Timing(name string, d time.Duration, tags Tags) {
+	s.send(name, fmt.Sprintf("%d|ms", d/time.Millisecond), tags)
+}
+
+// Gauge sends the value of name
+func (s *Statsd) Gauge(name string, value float64, tags Tags) {
+	s.send(name, fmt.Sprintf("%g|g", value), tags)
+}
+
+func (s *Statsd) send(name, value string, tags Tags) {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := ""
+	if s.dogstatsd {
+		line = s.prefix + name + ":" + value
+		if len(keys) > 0 {
+			pairs := make([]string, len(keys))
+			for i, k := range keys {
+				pairs[i] = k + ":" + tags[k]
+			}
+			line += "|#" + strings.Join(pairs, ",")
+		}
+	} else {
+		line = s.prefix + name
+		for _, k := range keys {
+			line += "." + sanitize(tags[k])
+		}
+		line += ":" + value
+	}
+
+	// metrics are best effort, an agent which is down must not fail builds
+	if _, err := s.conn.Write([]byte(line)); err != nil {
+		logrus.Debugf("sending metric %s to statsd failed: %v", name, err)
+	}
+}
+
+// sanitize makes a tag value usable as part of a metric name
+func sanitize(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', '/', ' ':
+			return '_'
+		}
+		return r
+	}, v)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"leeroy/events"
+	"leeroy/notify"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// notifierConfig sends finished builds to a chat platform, the routing
+// rules are shared by all the platforms
+type notifierConfig struct {
+	// "slack", "mattermost" or "teams"
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Channel string `json:"channel"`
+	// only notify for these repos/contexts, all of them when empty
+	Repos        []string `json:"repos"`
+	Contexts     []string `json:"contexts"`
+	FailuresOnly bool     `json:"failures_only"`
+}
+
+func init() {
+	registerPlugin("notifiers", func(c Config) bool {
+		return len(c.Notifiers) > 0
+	}, setupNotifiers)
+}
+
+func setupNotifiers(c Config) error {
+	for _, nc := range c.Notifiers {
+		n, err := notify.New(nc.Type, nc.URL, nc.Channel)
+		if err != nil {
+			return err
+		}
+
+		nc := nc
+		events.Subscribe(events.BuildCompleted, func(e events.Event) {
+			if !nc.matches(e) {
+				return
+			}
+			if err := n.Notify(buildMessage(e)); err != nil {
+				log.Errorf("Sending %s notification for %s #%d failed: %v", nc.Type, e.Repo, e.PR, err)
+			}
+		})
+
+		// the tokens are not about a repo, every notifier gets them
+		events.Subscribe(events.TokenWarning, func(e events.Event) {
+			m := notify.Message{Title: "GitHub token warning", Text: e.Description, State: "warning"}
+			if err := n.Notify(m); err != nil {
+				log.Errorf("Sending %s notification about the GitHub tokens failed: %v", nc.Type, err)
+			}
+		})
+		events.Subscribe(events.HandlerPanic, func(e events.Event) {
+			m := notify.Message{Title: "leeroy panicked", Text: e.Description, State: "error"}
+			if err := n.Notify(m); err != nil {
+				log.Errorf("Sending %s notification about a panic failed: %v", nc.Type, err)
+			}
+		})
+	}
+	return nil
+}
+
+// matches applies the routing rules to an event
+func (n notifierConfig) matches(e events.Event) bool {
+	if len(n.Repos) > 0 && !containsString(n.Repos, e.Repo) {
+		return false
+	}
+	if len(n.Contexts) > 0 && !containsString(n.Contexts, e.Context) {
+		return false
+	}
+	if n.FailuresOnly && e.State != "failure" && e.State != "error" {
+		return false
+	}
+	return true
+}
+
+func buildMessage(e events.Event) notify.Message {
+	title := fmt.Sprintf("%s %s for %s", e.Context, e.State, e.Repo)
+	if e.PR != 0 {
+		title = fmt.Sprintf("%s %s for %s #%d", e.Context, e.State, e.Repo, e.PR)
+	}
+	return notify.Message{
+		Title: title,
+		Text:  fmt.Sprintf("%s (%s)", e.Description, e.Sha),
+		URL:   e.URL,
+		State: e.State,
+	}
+}
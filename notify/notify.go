@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// how long a notification may take before it is given up
+const requestTimeout = 30 * time.Second
+
+// Message is a notification about a build
+type Message struct {
+	Title string
+	Text  string
+	URL   string
+	// state of the build: "success", "failure", "error" or "pending"
+	State string
+}
+
+// Notifier sends messages to a chat platform
+type Notifier interface {
+	Notify(m Message) error
+}
+
+// New returns the notifier for a chat platform: "slack", "mattermost"
+// or "teams", posting to the incoming webhook url
+func New(kind, url, channel string) (Notifier, error) {
+	switch kind {
+	case "slack", "mattermost":
+		// mattermost accepts slack's incoming webhook payloads
+		return &Slack{URL: url, Channel: channel}, nil
+	case "teams":
+		return &Teams{URL: url}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", kind)
+}
+
+// post sends v as json to url
+func post(url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("posting notification failed: %s %s", resp.Status, body)
+	}
+	return nil
+}
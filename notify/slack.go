@@ -0,0 +1,45 @@
+package notify
+
+// Slack posts messages to a Slack or Mattermost incoming webhook
+type Slack struct {
+	URL string
+	// overrides the channel of the webhook when set
+	Channel string
+}
+
+type slackAttachment struct {
+	Color     string `json:"color"`
+	Title     string `json:"title"`
+	TitleLink string `json:"title_link,omitempty"`
+	Text      string `json:"text"`
+	Fallback  string `json:"fallback"`
+}
+
+type slackPayload struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// Notify posts the message as an attachment colored by the build state
+func (s *Slack) Notify(m Message) error {
+	color := "warning"
+	switch m.State {
+	case "success":
+		color = "good"
+	case "failure", "error":
+		color = "danger"
+	}
+
+	return post(s.URL, slackPayload{
+		Channel:  s.Channel,
+		Username: "leeroy",
+		Attachments: []slackAttachment{{
+			Color:     color,
+			Title:     m.Title,
+			TitleLink: m.URL,
+			Text:      m.Text,
+			Fallback:  m.Title + ": " + m.Text,
+		}},
+	})
+}
@@ -0,0 +1,59 @@
+package notify
+
+// Teams posts messages as Adaptive Cards to a Microsoft Teams incoming
+// webhook or workflow
+type Teams struct {
+	URL string
+}
+
+type teamsPayload struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string                   `json:"$schema"`
+	Type    string                   `json:"type"`
+	Version string                   `json:"version"`
+	Body    []map[string]interface{} `json:"body"`
+	Actions []map[string]interface{} `json:"actions,omitempty"`
+}
+
+// Notify posts the message as a card with a link to the build
+func (t *Teams) Notify(m Message) error {
+	color := "Warning"
+	switch m.State {
+	case "success":
+		color = "Good"
+	case "failure", "error":
+		color = "Attention"
+	}
+
+	card := teamsCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body: []map[string]interface{}{
+			{"type": "TextBlock", "text": m.Title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+			{"type": "TextBlock", "text": m.Text, "wrap": true},
+		},
+	}
+	if m.URL != "" {
+		card.Actions = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": "View build", "url": m.URL},
+		}
+	}
+
+	return post(t.URL, teamsPayload{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     card,
+		}},
+	})
+}
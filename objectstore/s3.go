@@ -0,0 +1,170 @@
+package objectstore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"leeroy/sigv4"
+)
+
+const defaultRegion = "us-east-1"
+
+// S3 stores objects in a bucket of Amazon S3 or of a compatible storage,
+// eg. MinIO or Ceph
+type S3 struct {
+	// https://s3.<region>.amazonaws.com for Amazon S3
+	Endpoint string `json:"endpoint"`
+	// us-east-1 by default
+	Region string `json:"region"`
+	Bucket string `json:"bucket"`
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are used if they are
+	// empty
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	// address the bucket as <endpoint>/<bucket> rather than as
+	// <bucket>.<endpoint>, which most compatible storages need
+	PathStyle bool `json:"path_style"`
+}
+
+// Object is an object listed in a bucket
+type Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
+}
+
+func (s S3) region() string {
+	if s.Region != "" {
+		return s.Region
+	}
+	return defaultRegion
+}
+
+func (s S3) credentials() (string, string) {
+	id, secret := s.AccessKeyID, s.SecretAccessKey
+	if id == "" {
+		id = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secret == "" {
+		secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return id, secret
+}
+
+// objectURL returns the url of the key in the bucket
+func (s S3) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	u.Path += "/" + key
+	return u, nil
+}
+
+// Put stores body at key
+func (s S3) Put(key string, body []byte, contentType string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	_, err = s.do(req, body)
+	if err != nil {
+		return fmt.Errorf("storing %s in %s failed: %v", key, s.Bucket, err)
+	}
+	return nil
+}
+
+// Delete removes the object at key
+func (s S3) Delete(key string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if _, err := s.do(req, nil); err != nil {
+		return fmt.Errorf("deleting %s from %s failed: %v", key, s.Bucket, err)
+	}
+	return nil
+}
+
+// List returns the objects whose key starts with prefix
+func (s S3) List(prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		u, err := s.objectURL("")
+		if err != nil {
+			return nil, err
+		}
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		req, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		b, err := s.do(req, nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s in %s failed: %v", prefix, s.Bucket, err)
+		}
+
+		var page struct {
+			Contents              []Object `xml:"Contents"`
+			IsTruncated           bool     `xml:"IsTruncated"`
+			NextContinuationToken string   `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(b, &page); err != nil {
+			return nil, fmt.Errorf("decoding the objects of %s failed: %v", s.Bucket, err)
+		}
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// do signs and sends the request, and returns the body of the response
+func (s S3) do(req *http.Request, body []byte) ([]byte, error) {
+	id, secret := s.credentials()
+	sigv4.Sign(req, body, "s3", s.region(), id, secret, time.Now().UTC())
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s", resp.Status, b)
+	}
+	return b, nil
+}
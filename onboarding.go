@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// githubWebhook is the webhook the repos deliver their events to leeroy
+// with
+type githubWebhook struct {
+	// public url of the /notification/github endpoint
+	URL string `json:"url"`
+	// signs the deliveries, which are rejected without a valid signature
+	// once it is set
+	Secret string `json:"secret"`
+	// create or repair the webhooks of the repos found missing or
+	// different on startup and by the daily check
+	Repair bool `json:"repair"`
+}
+
+// hookEvents are the events the webhooks leeroy registers deliver
+var hookEvents = []string{"pull_request", "pull_request_review", "check_run", "check_suite", "issue_comment", "push"}
+
+type requestOnboard struct {
+	Repo   string  `json:"repo"`
+	Builds []Build `json:"builds"`
+	// do not schedule the builds of the default branch to verify them
+	SkipVerify bool `json:"skip_verify"`
+}
+
+type onboardResult struct {
+	// "ok", "created" or "repaired"
+	Hook   string         `json:"hook"`
+	Builds []onboardBuild `json:"builds"`
+	// builds were added, the instances only use them once restarted
+	Restart bool `json:"restart_required,omitempty"`
+}
+
+type onboardBuild struct {
+	Context string `json:"context"`
+	Added   bool   `json:"added"`
+	// the sha the verification build was scheduled for
+	Verified string `json:"verified,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// onboardMu serializes the writes of the onboarded builds file
+var onboardMu sync.Mutex
+
+// repoHook returns the webhook of the repo delivering to leeroy, if any
+func (c Config) repoHook(g github.GitHub, repo octokat.Repo) (*github.Hook, error) {
+	hooks, err := g.Hooks(repo)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		if hooks[i].Config.URL == c.GHWebhook.URL {
+			return &hooks[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// leeroyHook returns the webhook leeroy needs
+func (c Config) leeroyHook() github.Hook {
+	return github.Hook{
+		Name:   "web",
+		Active: true,
+		Events: hookEvents,
+		Config: github.HookConfig{
+			URL:         c.GHWebhook.URL,
+			ContentType: "json",
+			Secret:      c.GHWebhook.Secret,
+		},
+	}
+}
+
+// readOnboardedBuilds returns the builds added by onboarding repos
+func readOnboardedBuilds(path string) ([]Build, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read onboarded builds: %v", err)
+	}
+	var builds []Build
+	if err := json.Unmarshal(b, &builds); err != nil {
+		return nil, fmt.Errorf("error parsing %s as json: %v", path, err)
+	}
+	return builds, nil
+}
+
+// onboard registers the webhook of the repo, adds its builds and
+// schedules them on the head of the default branch to check they reach
+// jenkins and report back
+func (c Config) onboard(req requestOnboard) (onboardResult, error) {
+	var res onboardResult
+	r := strings.SplitN(req.Repo, "/", 2)
+	if len(r) < 2 {
+		return res, invalidRequestError(fmt.Sprintf("repo name could not be parsed: %s", req.Repo))
+	}
+	repo := octokat.Repo{UserName: r[0], Name: r[1]}
+	g := c.githubClient()
+
+	for i := range req.Builds {
+		req.Builds[i].Repo = req.Repo
+		if req.Builds[i].Context == "" || req.Builds[i].Job == "" {
+			return res, invalidRequestError("the builds need a context and a jenkins_job_name")
+		}
+	}
+
+	check := c.checkHook(g, req.Repo, true)
+	if check.Status == hookError {
+		return res, githubError{fmt.Errorf("setting up the webhook of %s failed: %s", req.Repo, check.Error)}
+	}
+	res.Hook = check.Status
+
+	onboardMu.Lock()
+	defer onboardMu.Unlock()
+
+	onboarded, err := readOnboardedBuilds(c.OnboardedBuilds)
+	if err != nil {
+		return res, err
+	}
+	var added []Build
+	for _, build := range req.Builds {
+		ob := onboardBuild{Context: build.Context}
+		if _, err := c.getBuildByContextAndRepo(build.Context, req.Repo); err != nil {
+			added = append(added, build)
+			ob.Added = true
+		}
+		res.Builds = append(res.Builds, ob)
+	}
+	if len(added) > 0 {
+		b, err := json.MarshalIndent(append(onboarded, added...), "", "    ")
+		if err != nil {
+			return res, err
+		}
+		if err := ioutil.WriteFile(c.OnboardedBuilds, b, 0644); err != nil {
+			return res, fmt.Errorf("saving the onboarded builds failed: %v", err)
+		}
+		// the config is shared by the handlers without a lock, so
+		// the builds are only read again on start
+		res.Restart = true
+		log.Infof("Onboarded %d build(s) of %s, restart to build them", len(added), req.Repo)
+	}
+
+	if req.SkipVerify {
+		return res, nil
+	}
+	sha, err := g.CommitSha(repo, "HEAD")
+	if err != nil {
+		return res, githubError{errors.Wrapf(err, "getting the head of %s failed", req.Repo)}
+	}
+	for i, build := range req.Builds {
+		if err := c.scheduleRefBuild(req.Repo, build, sha, "", map[string]string{"LEEROY_DRY_RUN": "1"}); err != nil {
+			res.Builds[i].Error = err.Error()
+			continue
+		}
+		res.Builds[i].Verified = sha
+	}
+	return res, nil
+}
+
+// onboardHandler registers the webhook and the builds of a repo
+func onboardHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+	if config.GHWebhook.URL == "" || config.OnboardedBuilds == "" {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("onboarding needs github_webhook.url and onboarded_builds in the config"))
+		return
+	}
+
+	var req requestOnboard
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("decoding the onboard request as json failed: %v", err))
+		return
+	}
+
+	res, err := config.onboard(req)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"leeroy/events"
+	"leeroy/webhook"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// outboundEvents are the events sent to the outbound webhooks which do
+// not choose their own
+var outboundEvents = []events.Type{events.BuildScheduled, events.BuildCompleted, events.AuthDenied}
+
+// outboundWebhook posts the events of leeroy to a url as signed json, so
+// other tools can react to the builds without polling GitHub or Jenkins
+type outboundWebhook struct {
+	URL string `json:"url"`
+	// signs the posts like the builds sent to the webhook backend
+	Secret string `json:"secret"`
+	// the event types to send, builds and denied authorizations by default
+	Events []events.Type `json:"events"`
+	// only send the events of these repos, all of them when empty
+	Repos []string `json:"repos"`
+}
+
+func init() {
+	registerPlugin("outbound-webhooks", func(c Config) bool {
+		return len(c.OutboundWebhooks) > 0
+	}, setupOutboundWebhooks)
+}
+
+func setupOutboundWebhooks(c Config) error {
+	for _, o := range c.OutboundWebhooks {
+		if o.URL == "" {
+			return fmt.Errorf("outbound webhooks need a url")
+		}
+
+		o := o
+		client := &webhook.Client{Secret: o.Secret}
+		types := o.Events
+		if len(types) == 0 {
+			types = outboundEvents
+		}
+		for _, t := range types {
+			events.Subscribe(t, func(e events.Event) {
+				if len(o.Repos) > 0 && !containsString(o.Repos, e.Repo) {
+					return
+				}
+				if err := client.Post(o.URL, string(e.Type), e); err != nil {
+					log.Errorf("Sending the %s event for %s #%d to %s failed: %v", e.Type, e.Repo, e.PR, o.URL, err)
+				}
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"leeroy/github"
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+)
+
+const (
+	outboxInterval = time.Minute
+	// statuses still not sent after this are dropped
+	outboxTTL = 7 * 24 * time.Hour
+)
+
+func init() {
+	registerTask("github-outbox", outboxInterval, flushOutbox)
+}
+
+// queuedStatus is a status which could not be set during a GitHub outage
+type queuedStatus struct {
+	Repo   string                 `json:"repo"`
+	Sha    string                 `json:"sha"`
+	Status *octokat.StatusOptions `json:"status"`
+	Queued time.Time              `json:"queued"`
+}
+
+// only the latest status of a context is kept, the previous ones would
+// be overwritten anyway
+func outboxKey(repo, sha, context string) string {
+	return fmt.Sprintf("github-outbox/%s/%s/%s", repo, sha, context)
+}
+
+// queueStatus keeps the status to set it once GitHub is back
+func queueStatus(repo, sha string, status *octokat.StatusOptions) error {
+	b, err := json.Marshal(queuedStatus{
+		Repo:   repo,
+		Sha:    sha,
+		Status: status,
+		Queued: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return state.Set(outboxKey(repo, sha, status.Context), b, outboxTTL)
+}
+
+// superseded checks if the context of the queued status was set on
+// GitHub after it was queued, eg. once the outage was over, so the
+// writes of the statuses need no state store round trip to drop the
+// queued ones
+func superseded(g github.GitHub, repo octokat.Repo, q queuedStatus) (bool, error) {
+	statuses, err := g.CombinedStatuses(repo, q.Sha)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range statuses {
+		if s.Context == q.Status.Context {
+			return s.UpdatedAt.After(q.Queued), nil
+		}
+	}
+	return false, nil
+}
+
+// isOutageError checks if the write failed because of GitHub rather than
+// because of the request, octokat only keeps the message of the errors
+func isOutageError(err error) bool {
+	return github.IsOutage(err) || github.Degraded()
+}
+
+// flushOutbox sets the statuses queued during an outage once GitHub is
+// healthy again
+func flushOutbox(c Config) {
+	keys, err := state.Keys("github-outbox/")
+	if err != nil {
+		log.Errorf("Listing the queued statuses failed: %v", err)
+		return
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	g := c.githubClient()
+	if _, down := github.Outage(); down {
+		// nothing else may be asking GitHub whether it is back
+		if err := g.Ping(); err != nil {
+			log.Debugf("GitHub is still down, %d statuses are queued: %v", len(keys), err)
+			return
+		}
+	}
+
+	sent := 0
+	for _, key := range keys {
+		b, err := state.Get(key)
+		if err != nil {
+			if err != store.ErrNotFound {
+				log.Error(err)
+			}
+			continue
+		}
+		var q queuedStatus
+		if err := json.Unmarshal(b, &q); err != nil {
+			log.Errorf("Decoding the queued status %s failed: %v", key, err)
+			state.Delete(key)
+			continue
+		}
+
+		r := strings.SplitN(q.Repo, "/", 2)
+		if len(r) < 2 {
+			state.Delete(key)
+			continue
+		}
+		repo := octokat.Repo{UserName: r[0], Name: r[1]}
+		newer, err := superseded(g, repo, q)
+		if err != nil {
+			log.Errorf("Getting the statuses of %s %s failed, %d statuses left: %v", q.Repo, q.Sha, len(keys)-sent, err)
+			return
+		}
+		if newer {
+			log.Debugf("Dropping the queued status of %s for %s %s, a newer one was set", q.Status.Context, q.Repo, q.Sha)
+			dropQueued(key, b)
+			continue
+		}
+		if _, err := g.SetStatus(repo, q.Sha, q.Status); err != nil {
+			log.Errorf("Setting the queued status of %s for %s %s failed, %d statuses left: %v", q.Status.Context, q.Repo, q.Sha, len(keys)-sent, err)
+			return
+		}
+		sent++
+		dropQueued(key, b)
+	}
+	log.Infof("Set %d statuses queued during the GitHub outage", sent)
+}
+
+// dropQueued removes the queued status b, unless a newer status was
+// queued meanwhile
+func dropQueued(key string, b []byte) {
+	if current, err := state.Get(key); err == nil && bytes.Equal(current, b) {
+		state.Delete(key)
+	}
+}
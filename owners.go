@@ -0,0 +1,98 @@
+package main
+
+import (
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// OwnerBuilds selects the builds of pull requests which only change
+// files owned by one CODEOWNERS owner, eg. only the docs builds for
+// changes owned by the docs team
+type OwnerBuilds struct {
+	Repo string `json:"github_repo"`
+	// as written in CODEOWNERS, "@org/team" or "@user"
+	Owner    string   `json:"owner"`
+	Contexts []string `json:"contexts"`
+}
+
+// ownedBy checks if every file changed by the pull request is owned by
+// owner
+func ownedBy(pr *github.PullRequest, owners github.CodeOwners, owner string) bool {
+	files := pr.Content.Files()
+	if len(files) == 0 {
+		return false
+	}
+
+	for _, f := range files {
+		found := false
+		for _, o := range owners.Owners(f.FileName) {
+			if o == owner {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// selectOwnerBuilds returns the builds to run for the pull request. When
+// all its files are owned by the owner of an owner_builds rule, only the
+// contexts of the rule run and the other builds are skipped as not
+// needed.
+func (c Config) selectOwnerBuilds(repo string, pr *github.PullRequest, builds []Build) []Build {
+	var rules []OwnerBuilds
+	for _, rule := range c.OwnerBuilds {
+		if rule.Repo == repo {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return builds
+	}
+
+	owners, err := c.githubClient().GetCodeOwners(pr.Repo, pr.Base.Ref)
+	if err != nil {
+		// better to run everything than to skip builds
+		log.Warnf("Reading CODEOWNERS of %s failed, running all the builds: %v", repo, err)
+		return builds
+	}
+
+	for _, rule := range rules {
+		if !ownedBy(pr, owners, rule.Owner) {
+			continue
+		}
+
+		log.Infof("%s #%d only changes files owned by %s", repo, pr.Number, rule.Owner)
+		var selected []Build
+		for _, build := range builds {
+			if containsString(rule.Contexts, build.Context) {
+				selected = append(selected, build)
+				continue
+			}
+			if build.Downstream {
+				continue
+			}
+			c.skipNotNeeded(repo, pr, build, msg(repo, "Not needed, only files owned by %s changed", rule.Owner))
+		}
+		return selected
+	}
+
+	return builds
+}
+
+// skipNotNeeded skips a build the pull request does not need. Only the
+// builds with report_not_needed get a success status, the others are
+// left alone so a required context is never satisfied without a build.
+func (c Config) skipNotNeeded(repo string, pr *github.PullRequest, build Build, desc string) {
+	if !build.ReportNotNeeded {
+		log.Infof("Not building %s for %s #%d: %s", build.Context, repo, pr.Number, desc)
+		return
+	}
+	if err := c.updateGithubStatus(repo, build.Context, pr.Head.Sha, "success", desc, ""); err != nil {
+		log.Error(err)
+	}
+}
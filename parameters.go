@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"leeroy/jenkins"
+)
+
+// how long the parameter definitions of the jobs are trusted
+const parameterCacheTTL = 10 * time.Minute
+
+type cachedDefinitions struct {
+	fetched     time.Time
+	definitions []jenkins.ParameterDefinition
+}
+
+// parameterCache holds the parameter definitions of the jobs recently
+// built, so they are not requested for every build
+var parameterCache = struct {
+	sync.Mutex
+	entries map[string]cachedDefinitions
+}{entries: map[string]cachedDefinitions{}}
+
+// parameterDefinitions returns the parameter definitions of job. They are
+// fetched outside of the lock, so a slow jenkins does not hold back the
+// builds of the other jobs; concurrent misses may fetch them twice.
+func (c Config) parameterDefinitions(job string) ([]jenkins.ParameterDefinition, error) {
+	parameterCache.Lock()
+	e, ok := parameterCache.entries[job]
+	parameterCache.Unlock()
+	if ok && time.Since(e.fetched) < parameterCacheTTL {
+		return e.definitions, nil
+	}
+
+	definitions, err := c.jenkins().GetParameterDefinitions(job)
+	if err != nil {
+		return nil, err
+	}
+
+	parameterCache.Lock()
+	parameterCache.entries[job] = cachedDefinitions{fetched: time.Now(), definitions: definitions}
+	parameterCache.Unlock()
+	return definitions, nil
+}
+
+// parameterMismatch returns the status description of the first mismatch
+// between the parameters leeroy sends and the ones job defines: a
+// parameter the job does not define, which jenkins would silently drop,
+// or one without a default the job needs. It returns "" when they match.
+func (c Config) parameterMismatch(repo, job string, parameters map[string]string) (string, error) {
+	definitions, err := c.parameterDefinitions(job)
+	if err != nil {
+		return "", err
+	}
+
+	defined := map[string]bool{}
+	for _, d := range definitions {
+		defined[d.Name] = true
+		if _, ok := parameters[d.Name]; !ok && d.Default == nil {
+			return msg(repo, "Jenkins job %s needs the %s parameter", job, d.Name), nil
+		}
+	}
+
+	// in order, so the same mismatch is reported every time
+	var names []string
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !defined[name] {
+			return msg(repo, "Jenkins job %s has no %s parameter", job, name), nil
+		}
+	}
+	return "", nil
+}
+
+// checkParameters fails the build with an error status when the job does
+// not match the parameters, eg. after one was renamed on jenkins
+func (c Config) checkParameters(build Build, parameters map[string]string) error {
+	repo, sha := parameters["GIT_BASE_REPO"], parameters["GIT_SHA1"]
+	desc, err := c.parameterMismatch(repo, build.Job, parameters)
+	if err != nil {
+		return backendError{fmt.Errorf("getting the parameters of jenkins job %s failed: %v", build.Job, err)}
+	}
+	if desc == "" {
+		return nil
+	}
+
+	if repo != "" && sha != "" {
+		if err := c.updateGithubStatus(repo, build.Context, sha, "error", desc, c.buildURL(build)); err != nil {
+			return err
+		}
+	}
+	return backendError{fmt.Errorf("not scheduling %s on %s: %s", build.Context, build.Job, desc)}
+}
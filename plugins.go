@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// plugin is an optional feature built on top of the events bus. Plugins
+// register themselves from an init function in their own file.
+type plugin struct {
+	name    string
+	enabled func(c Config) bool
+	setup   func(c Config) error
+}
+
+var plugins []plugin
+
+func registerPlugin(name string, enabled func(c Config) bool, setup func(c Config) error) {
+	plugins = append(plugins, plugin{
+		name:    name,
+		enabled: enabled,
+		setup:   setup,
+	})
+}
+
+// setupPlugins sets up all the plugins enabled by the config
+func setupPlugins(c Config) error {
+	for _, p := range plugins {
+		if !p.enabled(c) {
+			continue
+		}
+
+		if err := p.setup(c); err != nil {
+			return fmt.Errorf("setting up plugin %s failed: %v", p.name, err)
+		}
+		log.Infof("Enabled plugin %s", p.name)
+	}
+
+	return nil
+}
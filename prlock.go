@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// how long a shared lock is held at most, in case its holder dies
+	sharedLockTTL = time.Minute
+	// how long to wait for a shared lock before giving up
+	sharedLockWait = 30 * time.Second
+)
+
+// prLock serializes the cancelling and scheduling of the builds of a pull
+// request, so overlapping hooks, commands and sweeps cannot interleave
+type prLock struct {
+	sync.Mutex
+	// how many goroutines hold or wait for the lock, it is dropped once
+	// none does
+	users int
+}
+
+var (
+	prLocksMu sync.Mutex
+	prLocks   = map[string]*prLock{}
+)
+
+// lockPR waits for the builds of the pull request to be free and returns
+// the function releasing them, eg. defer lockPR(repo, number)(). The
+// lock is not reentrant and only serializes the goroutines of this
+// instance.
+func lockPR(repo string, number int) func() {
+	key := fmt.Sprintf("%s#%d", repo, number)
+
+	prLocksMu.Lock()
+	l, ok := prLocks[key]
+	if !ok {
+		l = &prLock{}
+		prLocks[key] = l
+	}
+	l.users++
+	prLocksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		prLocksMu.Lock()
+		defer prLocksMu.Unlock()
+		l.users--
+		if l.users == 0 {
+			delete(prLocks, key)
+		}
+	}
+}
+
+// lockShared waits for the lock name, shared by all the instances through
+// the state store, and returns the function releasing it. It is released
+// only if this holder still owns it, after sharedLockTTL it may have been
+// taken over.
+func lockShared(name string) (func(), error) {
+	key := "lock/" + name
+	token := []byte(fmt.Sprintf("%s-%d", instanceID, rand.Int63()))
+
+	deadline := time.Now().Add(sharedLockWait)
+	for {
+		ok, err := state.SetNX(key, token, sharedLockTTL)
+		if err != nil {
+			return nil, fmt.Errorf("taking the %s lock failed: %v", name, err)
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the %s lock is still held after %s", name, sharedLockWait)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return func() {
+		if _, err := state.CompareAndDelete(key, token); err != nil {
+			log.Warnf("releasing the %s lock failed: %v", name, err)
+		}
+	}, nil
+}
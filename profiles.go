@@ -0,0 +1,47 @@
+package main
+
+import "fmt"
+
+// Profile is a named set of extra parameters builds can be scheduled
+// with, eg. "asan" to build the instrumented configuration of the job
+type Profile struct {
+	Name       string            `json:"name"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// profile returns the profile called name, if any
+func (c Config) profile(name string) *Profile {
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// withProfile returns the build scheduled with the parameters of the
+// profile called name
+func (c Config) withProfile(build Build, name string) (Build, error) {
+	if c.profile(name) == nil {
+		return build, fmt.Errorf("unknown profile %q", name)
+	}
+	build.Profile = name
+	return build, nil
+}
+
+// profileParameters adds the parameters of the profile of the build to
+// parameters. They cannot override the parameters set by leeroy, and the
+// name of the profile is passed along as PROFILE.
+func (c Config) profileParameters(build Build, parameters map[string]string) {
+	p := c.profile(build.Profile)
+	if p == nil {
+		return
+	}
+
+	for k, v := range p.Parameters {
+		if _, ok := parameters[k]; !ok {
+			parameters[k] = v
+		}
+	}
+	parameters["PROFILE"] = p.Name
+}
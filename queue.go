@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	queueETAInterval = time.Minute
+	// the durations the estimates are based on
+	queueETAWindow = 7 * 24 * time.Hour
+	// the estimates are rounded up to this step, so the statuses are not
+	// updated every minute
+	queueETAStep = 5 * time.Minute
+	// pending builds scheduled before are taken as lost, not queued
+	queueLostAfter = 24 * time.Hour
+	// the pending builds are listed under this prefix
+	pendingIndexPrefix = "pending/"
+)
+
+func init() {
+	registerPlugin("queue-eta", func(c Config) bool {
+		return c.QueueETA
+	}, func(c Config) error {
+		registerTask("queue-eta", queueETAInterval, refreshQueueETAs)
+		return nil
+	})
+}
+
+// jobQueue is the builds of a job leeroy scheduled which did not complete
+type jobQueue struct {
+	// started, by when they started
+	running []buildRecord
+	// not started yet, by when they were scheduled
+	queued []buildRecord
+}
+
+// pendingIndexKey returns the key listing the build of the record while
+// it is pending
+func pendingIndexKey(record buildRecord) string {
+	return pendingIndexPrefix + buildRecordKey(record.Repo, record.Sha, record.Context)
+}
+
+// indexPending lists the build of the record while it is pending and not
+// deferred, so the queues are found without reading all the records
+func indexPending(record buildRecord) {
+	if !config.QueueETA {
+		return
+	}
+
+	key := pendingIndexKey(record)
+	if record.State == "pending" && !record.Deferred {
+		if err := state.Set(key, []byte(record.Scheduled.Format(time.RFC3339)), queueLostAfter); err != nil {
+			log.Warnf("indexing the pending build %s %s (%s) failed: %v", record.Repo, record.Sha, record.Context, err)
+		}
+		return
+	}
+	if err := state.Delete(key); err != nil {
+		log.Warnf("removing the pending build %s %s (%s) from the index failed: %v", record.Repo, record.Sha, record.Context, err)
+	}
+}
+
+// pendingQueues returns the pending builds of each job
+func pendingQueues() (map[string]*jobQueue, error) {
+	keys, err := state.Keys(pendingIndexPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	queues := map[string]*jobQueue{}
+	for _, key := range keys {
+		b, err := state.Get(strings.TrimPrefix(key, pendingIndexPrefix))
+		if err == store.ErrNotFound {
+			// expired since listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record buildRecord
+		if err := json.Unmarshal(b, &record); err != nil {
+			log.Warnf("decoding build record %s failed: %v", key, err)
+			continue
+		}
+
+		if record.State != "pending" || record.Deferred || record.Job == "" || time.Since(record.Scheduled) > queueLostAfter {
+			continue
+		}
+		q, ok := queues[record.Job]
+		if !ok {
+			q = &jobQueue{}
+			queues[record.Job] = q
+		}
+		if record.Started.IsZero() {
+			q.queued = append(q.queued, record)
+		} else {
+			q.running = append(q.running, record)
+		}
+	}
+	for _, q := range queues {
+		sort.Slice(q.queued, func(i, j int) bool { return q.queued[i].Scheduled.Before(q.queued[j].Scheduled) })
+		sort.Slice(q.running, func(i, j int) bool { return q.running[i].Started.Before(q.running[j].Started) })
+	}
+	return queues, nil
+}
+
+// typicalDuration returns the median duration of the recent builds of
+// the job, or 0 without any
+func typicalDuration(job string) time.Duration {
+	samples, err := getDurations(job, time.Now().Add(-queueETAWindow))
+	if err != nil {
+		log.Warnf("reading the durations of %s failed: %v", job, err)
+		return 0
+	}
+	var durations []time.Duration
+	for _, s := range samples {
+		durations = append(durations, s.Duration)
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return percentile(durations, 50)
+}
+
+// estimateStarts returns how long each queued build waits before it
+// starts, assuming the job runs as many builds at once as are running and
+// each takes the typical duration
+func (q jobQueue) estimateStarts(typical time.Duration) []time.Duration {
+	// when each of the executors is free again
+	free := []time.Duration{}
+	for _, record := range q.running {
+		left := typical - time.Since(record.Started)
+		if left < 0 {
+			left = 0
+		}
+		free = append(free, left)
+	}
+	if len(free) == 0 {
+		free = append(free, 0)
+	}
+
+	starts := make([]time.Duration, len(q.queued))
+	for i := range q.queued {
+		sort.Slice(free, func(a, b int) bool { return free[a] < free[b] })
+		starts[i] = free[0]
+		free[0] += typical
+	}
+	return starts
+}
+
+// queueDescription describes the position of a queued build and when it
+// is expected to start
+func queueDescription(repo string, ahead int, start time.Duration) string {
+	if start <= 0 {
+		return msg(repo, "Queued behind %d builds, starting soon", ahead)
+	}
+	steps := (start + queueETAStep - 1) / queueETAStep
+	return msg(repo, "Queued behind %d builds, est. start in ~%d min", ahead, int((steps * queueETAStep).Minutes()))
+}
+
+// refreshQueueETAs reports the position and estimated start of each
+// queued build in its pending status
+func refreshQueueETAs(c Config) {
+	queues, err := pendingQueues()
+	if err != nil {
+		log.Warnf("reading the pending builds failed: %v", err)
+		return
+	}
+
+	for job, q := range queues {
+		if len(q.queued) == 0 {
+			continue
+		}
+		typical := typicalDuration(job)
+		if typical == 0 {
+			// nothing to base the estimates on yet
+			continue
+		}
+
+		for i, start := range q.estimateStarts(typical) {
+			record := q.queued[i]
+			desc := queueDescription(record.Repo, i+len(q.running), start)
+			if desc == record.Description {
+				continue
+			}
+
+			// it may have started since the records were read
+			current, err := getBuildRecord(record.Repo, record.Sha, record.Context)
+			if err != nil || !current.Started.IsZero() || current.State != "pending" || current.Deferred {
+				continue
+			}
+			if err := c.updateGithubStatus(current.Repo, current.Context, current.Sha, "pending", desc, current.URL); err != nil {
+				log.Warnf("updating the queue position of %s %s (%s) failed: %v", current.Repo, current.Sha, current.Context, err)
+				continue
+			}
+			current.Description = desc
+			saveBuildRecord(current)
+		}
+	}
+}
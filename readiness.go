@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+// contextStatus is the latest status of a required context
+type contextStatus struct {
+	Context     string `json:"context"`
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+type readinessResponse struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	Sha    string `json:"sha"`
+	// whether all the required contexts succeeded
+	Ready    bool            `json:"ready"`
+	Contexts []contextStatus `json:"contexts"`
+}
+
+// releaseContexts returns the contexts a commit of the repo needs to be
+// released, the same ones auto merging requires
+func (c Config) releaseContexts(repo string) ([]string, error) {
+	if _, err := c.getBuilds(repo, false); err != nil {
+		return nil, err
+	}
+	if a := c.autoMerge(repo); a != nil {
+		return c.requiredContexts(*a), nil
+	}
+	return c.requiredContexts(AutoMerge{Repo: repo}), nil
+}
+
+// readinessHandler reports whether the latest commit of a branch passed
+// all the required contexts, eg.
+// /api/release-readiness/mantidproject/mantid/release-next. The required
+// contexts can be given with ?contexts=a,b instead.
+func readinessHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	// the branch can contain slashes, the repo cannot
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/release-readiness/"), "/", 3)
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("expected /api/release-readiness/{owner}/{repo}/{branch}"))
+		return
+	}
+	repoName, branch := parts[0]+"/"+parts[1], parts[2]
+
+	contexts, err := config.releaseContexts(repoName)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if v := r.URL.Query().Get("contexts"); v != "" {
+		contexts = strings.Split(v, ",")
+	}
+
+	g := config.githubClient()
+	repo := octokat.Repo{UserName: parts[0], Name: parts[1]}
+	sha, err := g.CommitSha(repo, branch)
+	if err != nil {
+		writeFailure(w, githubError{errors.Wrapf(err, "getting the latest commit of %s %s failed", repoName, branch)})
+		return
+	}
+	statuses, err := g.CombinedStatuses(repo, sha)
+	if err != nil {
+		writeFailure(w, githubError{errors.Wrapf(err, "getting the statuses of %s %s failed", repoName, sha)})
+		return
+	}
+
+	resp := readinessResponse{
+		Repo:     repoName,
+		Branch:   branch,
+		Sha:      sha,
+		Ready:    true,
+		Contexts: []contextStatus{},
+	}
+	for _, context := range contexts {
+		status := contextStatus{Context: context, State: "missing"}
+		for _, s := range statuses {
+			if s.Context == context {
+				status.State = s.State
+				status.Description = s.Description
+				status.URL = s.TargetURL
+				break
+			}
+		}
+		if status.State != "success" {
+			resp.Ready = false
+		}
+		resp.Contexts = append(resp.Contexts, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRecentSize is the number of payloads kept per endpoint when
+// recent_size is not configured
+const defaultRecentSize = 50
+
+// headers which are never kept
+var redactedHeaders = []string{"Authorization", "Cookie", "X-Hub-Signature", "X-Hub-Signature-256", "X-Leeroy-Signature"}
+
+// recentRequest is a received notification kept for debugging
+type recentRequest struct {
+	Time    time.Time         `json:"time"`
+	Remote  string            `json:"remote"`
+	Headers map[string]string `json:"headers"`
+	Body    interface{}       `json:"body"`
+}
+
+// recentRing keeps the last requests received on an endpoint
+type recentRing struct {
+	mu    sync.Mutex
+	items []recentRequest
+	next  int
+}
+
+func (r *recentRing) add(req recentRequest, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.items) < size {
+		r.items = append(r.items, req)
+		return
+	}
+	r.items[r.next%len(r.items)] = req
+	r.next = (r.next + 1) % len(r.items)
+}
+
+// list returns the requests, most recent first
+func (r *recentRing) list() []recentRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	items := make([]recentRequest, 0, len(r.items))
+	for i := len(r.items) - 1; i >= 0; i-- {
+		items = append(items, r.items[(r.next+i)%len(r.items)])
+	}
+	return items
+}
+
+var recent = struct {
+	sync.Mutex
+	rings map[string]*recentRing
+}{rings: map[string]*recentRing{}}
+
+// recordRecent wraps a notification handler to keep its last payloads
+func recordRecent(name string, h http.HandlerFunc) http.HandlerFunc {
+	recent.Lock()
+	ring, ok := recent.rings[name]
+	if !ok {
+		ring = &recentRing{}
+		recent.rings[name] = ring
+	}
+	recent.Unlock()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			size := config.RecentSize
+			if size <= 0 {
+				size = defaultRecentSize
+			}
+			req := recentRequest{
+				Time:    time.Now(),
+				Remote:  r.RemoteAddr,
+				Headers: redactHeaders(r.Header),
+				Body:    redactBody(body),
+			}
+			ring.add(req, size)
+
+			if recordDir != "" {
+				recordFixture(name, req)
+			}
+		}
+
+		h(w, r)
+	}
+}
+
+func redactHeaders(h http.Header) map[string]string {
+	headers := map[string]string{}
+	for k := range h {
+		headers[k] = h.Get(k)
+	}
+	for _, k := range redactedHeaders {
+		if _, ok := headers[k]; ok {
+			headers[k] = "REDACTED"
+		}
+	}
+	return headers
+}
+
+// redactBody decodes a json body and hides the values of any keys
+// looking like credentials. Other bodies are kept as a string.
+func redactBody(body []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	return redactValue(v)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			key := strings.ToLower(k)
+			if strings.Contains(key, "token") || strings.Contains(key, "secret") || strings.Contains(key, "password") {
+				t[k] = "REDACTED"
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+	}
+	return v
+}
+
+func recentHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	recent.Lock()
+	all := map[string][]recentRequest{}
+	for name, ring := range recent.rings {
+		all[name] = ring.list()
+	}
+	recent.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(all)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"leeroy/store"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// how long build records are kept in the state store
+	buildRecordTTL = 30 * 24 * time.Hour
+	// how long github deliveries are remembered to drop redeliveries
+	deliveryTTL = 24 * time.Hour
+)
+
+// retryBackoff is how long the retry sweep waits before retrying a build
+// again after each retry, the last delay is repeated
+var retryBackoff = []time.Duration{time.Hour, 4 * time.Hour, 12 * time.Hour, 24 * time.Hour}
+
+// state is shared between all the leeroy instances
+var state store.Store = store.NewMemory()
+
+// buildRecord is the last known state of a build of a sha for a context
+type buildRecord struct {
+	Repo        string    `json:"repo"`
+	PR          int       `json:"pr"`
+	Sha         string    `json:"sha"`
+	Context     string    `json:"context"`
+	Job         string    `json:"job"`
+	State       string    `json:"state"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	Scheduled   time.Time `json:"scheduled"`
+	Started     time.Time `json:"started,omitempty"`
+	Updated     time.Time `json:"updated"`
+	// a custom build which does not schedule its downstream builds
+	NoDownstream bool `json:"no_downstream,omitempty"`
+	// the GitHub delivery of the hook which scheduled the build
+	Delivery string `json:"delivery,omitempty"`
+	// held back by a maintenance window or busy agents, its status says
+	// what it waits for rather than its place in the queue
+	Deferred bool `json:"deferred,omitempty"`
+}
+
+func buildRecordKey(repo, sha, context string) string {
+	return fmt.Sprintf("build/%s/%s/%s", repo, sha, context)
+}
+
+func getBuildRecord(repo, sha, context string) (record buildRecord, err error) {
+	b, err := state.Get(buildRecordKey(repo, sha, context))
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal(b, &record)
+	return record, err
+}
+
+// getBuildRecords returns all the records whose key starts with prefix
+func getBuildRecords(prefix string) (records []buildRecord, err error) {
+	keys, err := state.Keys("build/" + prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		b, err := state.Get(key)
+		if err == store.ErrNotFound {
+			// expired since listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var record buildRecord
+		if err := json.Unmarshal(b, &record); err != nil {
+			log.Warnf("decoding build record %s failed: %v", key, err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// skipDownstream keeps the build of the commit from scheduling its
+// downstream builds once it succeeds, until the commit is built again
+func skipDownstream(repo, sha, context string) {
+	record, err := getBuildRecord(repo, sha, context)
+	if err != nil {
+		log.Warnf("getting build record for %s %s (%s) failed: %v", repo, sha, context, err)
+		return
+	}
+	record.NoDownstream = true
+	saveBuildRecord(record)
+}
+
+// saveBuildRecord stores the record, errors are only logged as the
+// records are not needed to report builds
+func saveBuildRecord(record buildRecord) {
+	record.Updated = time.Now()
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		log.Warnf("encoding build record failed: %v", err)
+		return
+	}
+
+	if err := state.Set(buildRecordKey(record.Repo, record.Sha, record.Context), b, buildRecordTTL); err != nil {
+		log.Warnf("saving build record for %s %s (%s) failed: %v", record.Repo, record.Sha, record.Context, err)
+	}
+	indexPending(record)
+}
+
+// durationSample is how long a finished build ran, from the notification
+// of its start to the one of its completion
+type durationSample struct {
+	Repo      string        `json:"repo"`
+	Job       string        `json:"job"`
+	Context   string        `json:"context"`
+	State     string        `json:"state"`
+	Completed time.Time     `json:"completed"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// saveDuration stores the sample for the stats, it is kept as long as the
+// build records
+func saveDuration(sample durationSample) {
+	b, err := json.Marshal(sample)
+	if err != nil {
+		log.Warnf("encoding duration sample failed: %v", err)
+		return
+	}
+
+	key := fmt.Sprintf("duration/%s/%d", sample.Job, sample.Completed.UnixNano())
+	if err := state.Set(key, b, buildRecordTTL); err != nil {
+		log.Warnf("saving the duration of %s for %s (%s) failed: %v", sample.Job, sample.Repo, sample.Context, err)
+	}
+}
+
+// getDurations returns the samples of the builds completed since, only the
+// ones of job if it is set
+func getDurations(job string, since time.Time) (samples []durationSample, err error) {
+	prefix := "duration/"
+	if job != "" {
+		prefix += job + "/"
+	}
+	keys, err := state.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		b, err := state.Get(key)
+		if err == store.ErrNotFound {
+			// expired since listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var sample durationSample
+		if err := json.Unmarshal(b, &sample); err != nil {
+			log.Warnf("decoding duration sample %s failed: %v", key, err)
+			continue
+		}
+		// the prefix of a folder job also matches the jobs in the folder
+		if job != "" && sample.Job != job {
+			continue
+		}
+		if sample.Completed.After(since) {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples, nil
+}
+
+// headRecord is the newest head of a pull request builds were scheduled
+// for, along with when the pull request was updated to it
+type headRecord struct {
+	Sha     string    `json:"sha"`
+	Updated time.Time `json:"updated"`
+}
+
+func headRecordKey(repo string, pr int) string {
+	return fmt.Sprintf("head/%s/%d", repo, pr)
+}
+
+func getHeadRecord(repo string, pr int) (record headRecord, err error) {
+	b, err := state.Get(headRecordKey(repo, pr))
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal(b, &record)
+	return record, err
+}
+
+// saveHead records the head of a pull request builds were scheduled for,
+// unless a newer one was recorded already
+func saveHead(repo string, pr int, sha string, updated time.Time) {
+	if record, err := getHeadRecord(repo, pr); err == nil && record.Updated.After(updated) {
+		return
+	}
+
+	b, err := json.Marshal(headRecord{Sha: sha, Updated: updated})
+	if err != nil {
+		log.Warnf("encoding head record failed: %v", err)
+		return
+	}
+	if err := state.Set(headRecordKey(repo, pr), b, buildRecordTTL); err != nil {
+		log.Warnf("saving head record for %s #%d failed: %v", repo, pr, err)
+	}
+}
+
+// isStaleHead checks if builds were already scheduled for a head of the
+// pull request which is newer than sha
+func isStaleHead(repo string, pr int, sha string, updated time.Time) bool {
+	record, err := getHeadRecord(repo, pr)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Warnf("getting the head record of %s #%d failed: %v", repo, pr, err)
+		}
+		return false
+	}
+	return record.Sha != sha && record.Updated.After(updated)
+}
+
+// retryRecord counts the retries of the build of a sha by the retry
+// sweep, a new push starts again from the first delay
+type retryRecord struct {
+	Retries int       `json:"retries"`
+	Next    time.Time `json:"next"`
+}
+
+func retryRecordKey(repo, sha, context string) string {
+	return fmt.Sprintf("retry/%s/%s/%s", repo, sha, context)
+}
+
+// getRetryRecord returns the retries of a build, none if they are not
+// known
+func getRetryRecord(repo, sha, context string) (record retryRecord) {
+	b, err := state.Get(retryRecordKey(repo, sha, context))
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Warnf("getting retries of %s %s (%s) failed: %v", repo, sha, context, err)
+		}
+		return record
+	}
+	if err := json.Unmarshal(b, &record); err != nil {
+		log.Warnf("decoding retries of %s %s (%s) failed: %v", repo, sha, context, err)
+	}
+	return record
+}
+
+// saveRetry records another retry of a build and when the sweep may
+// retry it next, the delay has up to 10% of jitter so the retries of the
+// builds failed by the same outage are spread out
+func saveRetry(repo, sha, context string) {
+	record := getRetryRecord(repo, sha, context)
+	delay := retryBackoff[len(retryBackoff)-1]
+	if record.Retries < len(retryBackoff) {
+		delay = retryBackoff[record.Retries]
+	}
+	delay += time.Duration(rand.Int63n(int64(delay / 10)))
+
+	record.Retries++
+	record.Next = time.Now().Add(delay)
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		log.Warnf("encoding retries failed: %v", err)
+		return
+	}
+	if err := state.Set(retryRecordKey(repo, sha, context), b, buildRecordTTL); err != nil {
+		log.Warnf("saving retries of %s %s (%s) failed: %v", repo, sha, context, err)
+	}
+}
+
+// isNewDelivery reports whether the github delivery was not seen yet
+func isNewDelivery(guid string) bool {
+	if guid == "" {
+		return true
+	}
+
+	isNew, err := state.SetNX("delivery/"+guid, []byte(time.Now().Format(time.RFC3339)), deliveryTTL)
+	if err != nil {
+		// better to build twice than not at all
+		log.Warnf("checking delivery %s failed: %v", guid, err)
+		return true
+	}
+	return isNew
+}
+
+// forgetDelivery allows a github delivery to be handled again
+func forgetDelivery(guid string) {
+	if guid == "" {
+		return
+	}
+	if err := state.Delete("delivery/" + guid); err != nil {
+		log.Warnf("forgetting delivery %s failed: %v", guid, err)
+	}
+}
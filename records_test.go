@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveRetryBackoff(t *testing.T) {
+	setup(t, Config{})
+
+	for i, want := range append(retryBackoff, retryBackoff[len(retryBackoff)-1]) {
+		before := time.Now()
+		saveRetry("mantidproject/mantid", "abc123", "linux")
+		record := getRetryRecord("mantidproject/mantid", "abc123", "linux")
+
+		if record.Retries != i+1 {
+			t.Fatalf("got %d retries, want %d", record.Retries, i+1)
+		}
+		// up to 10% of jitter
+		if delay := record.Next.Sub(before); delay < want || delay > want+want/10+time.Second {
+			t.Errorf("retry %d is due in %v, want %v plus up to 10%%", i+1, delay, want)
+		}
+	}
+
+	if record := getRetryRecord("mantidproject/mantid", "def456", "linux"); record.Retries != 0 {
+		t.Errorf("got %d retries for another sha, want none", record.Retries)
+	}
+}
+
+func TestGetDurations(t *testing.T) {
+	setup(t, Config{})
+
+	now := time.Now()
+	for _, sample := range []durationSample{
+		{Job: "folder", Completed: now, Duration: time.Minute},
+		{Job: "folder/job", Completed: now, Duration: time.Hour},
+		{Job: "folder", Completed: now.Add(-48 * time.Hour), Duration: time.Second},
+	} {
+		saveDuration(sample)
+	}
+
+	samples, err := getDurations("folder", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Duration != time.Minute {
+		t.Errorf("got %+v, want only the recent sample of the folder job", samples)
+	}
+
+	if samples, _ := getDurations("", now.Add(-24*time.Hour)); len(samples) != 2 {
+		t.Errorf("got %d samples of all the jobs, want 2", len(samples))
+	}
+}
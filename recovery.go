@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"leeroy/events"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// recoverPanics keeps a panicking handler, eg. on a malformed payload,
+// from dropping the connection: the panic is logged with its stack,
+// published for the notifiers, outbound webhooks and metrics, and the
+// request fails with a 500
+func recoverPanics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// the server aborts the response quietly
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			log.Errorf("Handler of %s %s panicked: %v\n%s", r.Method, r.URL.Path, p, stack())
+			events.Publish(events.Event{
+				Type:        events.HandlerPanic,
+				Description: fmt.Sprintf("%s %s: %v", r.Method, r.URL.Path, p),
+			})
+			writeError(w, 500, errInternal, fmt.Errorf("the request could not be handled"))
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// stack returns the stack trace of the current goroutine
+func stack() []byte {
+	buf := make([]byte, 64<<10)
+	return buf[:runtime.Stack(buf, false)]
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
+)
+
+const defaultRefreshLabel = "auto-refresh"
+
+// BaseRefresh marks the successful builds of the open pull requests of a
+// repo stale after a push to their base branch, so old results against a
+// base which moved on are not trusted when merging
+type BaseRefresh struct {
+	Repo string `json:"github_repo"`
+	// the base branches to watch, all of them if empty
+	Branches []string `json:"branches"`
+	// pull requests with the label are built again
+	Label string `json:"label"`
+}
+
+func (b BaseRefresh) label() string {
+	if b.Label == "" {
+		return defaultRefreshLabel
+	}
+	return b.Label
+}
+
+// baseRefresh returns the base refresh policy of the repo, if any
+func (c Config) baseRefresh(repo string) *BaseRefresh {
+	for i := range c.BaseRefresh {
+		if c.BaseRefresh[i].Repo == repo {
+			return &c.BaseRefresh[i]
+		}
+	}
+	return nil
+}
+
+// pushHookPayload holds the fields of push hooks leeroy uses
+type pushHookPayload struct {
+	Ref        string `json:"ref"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// pushHook marks the builds of the pull requests targeting a branch
+// stale after a push to it
+func pushHook(w http.ResponseWriter, body []byte) {
+	var hook pushHookPayload
+	if err := json.Unmarshal(body, &hook); err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing hook: %v", err))
+		return
+	}
+
+	repo := hook.Repository.FullName
+	p := config.baseRefresh(repo)
+	if p == nil || hook.Deleted || !strings.HasPrefix(hook.Ref, "refs/heads/") {
+		return
+	}
+	branch := strings.TrimPrefix(hook.Ref, "refs/heads/")
+	if len(p.Branches) > 0 && !containsString(p.Branches, branch) {
+		return
+	}
+
+	log.Infof("%s of %s was pushed to, refreshing the pull requests targeting it", branch, repo)
+	if err := config.refreshPRs(*p, branch); err != nil {
+		writeFailure(w, err)
+	}
+}
+
+// refreshPRs marks the successful builds of the open pull requests
+// targeting branch stale, and builds the labelled ones again
+func (c Config) refreshPRs(p BaseRefresh, branch string) error {
+	r := strings.SplitN(p.Repo, "/", 2)
+	if len(r) < 2 {
+		return fmt.Errorf("repo name could not be parsed: %s", p.Repo)
+	}
+	repo := octokat.Repo{
+		Name:     r[1],
+		UserName: r[0],
+	}
+
+	builds, err := c.getBuilds(p.Repo, false)
+	if err != nil {
+		return err
+	}
+
+	g := c.githubClient()
+	prs, err := g.PullRequests(repo, "open")
+	if err != nil {
+		return githubError{errors.Wrapf(err, "requesting open pull requests for %s failed", p.Repo)}
+	}
+
+	for _, listed := range prs {
+		if listed.Base.Ref != branch {
+			continue
+		}
+
+		statuses, err := g.CombinedStatuses(repo, listed.Head.Sha)
+		if err != nil {
+			return githubError{errors.Wrapf(err, "getting the statuses of %s #%d failed", p.Repo, listed.Number)}
+		}
+		for _, status := range statuses {
+			if status.State != "success" || !isBuildContext(builds, status.Context) {
+				continue
+			}
+			if err := c.updateGithubStatus(p.Repo, status.Context, listed.Head.Sha, "pending", msg(p.Repo, "Result predates a change to %s, rebuild to refresh it", branch), status.TargetURL); err != nil {
+				return err
+			}
+		}
+
+		extras := listedExtras(listed)
+		if !extras.hasLabel(p.label()) {
+			continue
+		}
+		pr, err := c.loadPullRequest(p.Repo, listed.Number)
+		if err != nil {
+			return err
+		}
+		log.Infof("Refreshing %s #%d after the change to %s", p.Repo, pr.Number, branch)
+		if _, err := c.rebuildUnlessHeld(p.Repo, pr, extras); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isBuildContext checks if the context is the one of one of the builds
+func isBuildContext(builds []Build, context string) bool {
+	for _, build := range builds {
+		if build.Context == context {
+			return true
+		}
+	}
+	return false
+}
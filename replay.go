@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"leeroy/github"
+	"leeroy/webhook"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// fixture is a notification saved with -record, it can be fed through
+// the handlers again with the replay command
+type fixture struct {
+	Endpoint string `json:"endpoint"`
+	recentRequest
+}
+
+var fixtureMu sync.Mutex
+
+// recordFixture saves an already redacted notification to recordDir
+func recordFixture(endpoint string, req recentRequest) {
+	b, err := json.MarshalIndent(fixture{Endpoint: endpoint, recentRequest: req}, "", "  ")
+	if err != nil {
+		log.Warnf("encoding fixture failed: %v", err)
+		return
+	}
+
+	fixtureMu.Lock()
+	defer fixtureMu.Unlock()
+	name := fmt.Sprintf("%s-%s.json", endpoint, req.Time.Format("20060102T150405.000000000"))
+	if err := ioutil.WriteFile(filepath.Join(recordDir, name), b, 0644); err != nil {
+		log.Warnf("saving fixture %s failed: %v", name, err)
+	}
+}
+
+// notificationHandler returns the handler of a /notification/ endpoint
+func notificationHandler(endpoint string) http.HandlerFunc {
+	switch endpoint {
+	case "jenkins":
+		return jenkinsHandler
+	case "azure":
+		return azureHandler
+	case "webhook":
+		return webhookHandler
+	case "github":
+		return githubHandler
+	}
+	return nil
+}
+
+// list endpoints of the backends, answered with an empty array
+var replayListResources = []string{"commits", "files", "comments", "statuses", "reviews", "labels", "pulls"}
+
+// replayTransport stands in for all the backends during a replay. It
+// prints the requests the handlers make and answers them with empty
+// successful responses.
+type replayTransport struct{}
+
+func (replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+	}
+	fmt.Printf("  -> %s %s %s\n", req.Method, req.URL, bytes.TrimSpace(body))
+
+	resp := "{}"
+	if containsString(replayListResources, path.Base(req.URL.Path)) {
+		resp = "[]"
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(resp)),
+		Request:    req,
+	}, nil
+}
+
+// replay feeds recorded fixtures through the notification handlers with
+// the config, printing the requests they make to the backends
+func replay(files []string) error {
+	var err error
+	if config, err = readConfig(configFile); err != nil {
+		return err
+	}
+	http.DefaultTransport = replayTransport{}
+	if err := setupPlugins(config); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var f fixture
+		if err := json.Unmarshal(b, &f); err != nil {
+			return fmt.Errorf("parsing fixture %s failed: %v", file, err)
+		}
+
+		handler := notificationHandler(f.Endpoint)
+		if handler == nil {
+			return fmt.Errorf("fixture %s has unknown endpoint %q", file, f.Endpoint)
+		}
+
+		var body []byte
+		if s, ok := f.Body.(string); ok {
+			body = []byte(s)
+		} else if body, err = json.Marshal(f.Body); err != nil {
+			return err
+		}
+
+		req := httptest.NewRequest("POST", "/notification/"+f.Endpoint, bytes.NewReader(body))
+		for k, v := range f.Headers {
+			req.Header.Set(k, v)
+		}
+		// the credentials were redacted when recording
+		req.SetBasicAuth(config.User, config.Pass)
+		req.Header.Set(webhook.SignatureHeader, config.Webhook.Sign(body))
+		req.Header.Set("X-Hub-Signature-256", github.Sign(config.GHWebhook.Secret, body))
+
+		fmt.Printf("%s (%s):\n", file, f.Endpoint)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		fmt.Printf("  <- %d %s\n", rec.Code, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+
+	// let the event subscribers finish
+	time.Sleep(100 * time.Millisecond)
+	fmt.Fprintln(os.Stderr, "replayed", len(files), "fixture(s)")
+	return nil
+}
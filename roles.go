@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/crosbymichael/octokat"
+)
+
+// roles, each one can do what the ones after it can
+const (
+	roleAdmin      = "admin"
+	roleMaintainer = "maintainer"
+	roleTriager    = "triager"
+)
+
+var roleRanks = map[string]int{
+	roleAdmin:      3,
+	roleMaintainer: 2,
+	roleTriager:    1,
+}
+
+// approving the builds of pull requests from forks, see ForkApproval
+const permApproveFork = "approve-fork"
+
+// the role needed for the actions without a permission
+var defaultPermissions = map[string]string{
+	"test":          roleTriager,
+	"retest":        roleTriager,
+	"cancel":        roleMaintainer,
+	"update-branch": roleMaintainer,
+	permApproveFork: roleMaintainer,
+}
+
+// Roles maps the roles to GitHub teams, "org/team-slug"
+type Roles struct {
+	Admins      []string `json:"admins"`
+	Maintainers []string `json:"maintainers"`
+	Triagers    []string `json:"triagers"`
+}
+
+// teams returns the teams having the role, including the ones of the
+// roles above it
+func (r Roles) teams(role string) []string {
+	var teams []string
+	switch role {
+	case roleTriager:
+		teams = append(teams, r.Triagers...)
+		fallthrough
+	case roleMaintainer:
+		teams = append(teams, r.Maintainers...)
+		fallthrough
+	case roleAdmin:
+		teams = append(teams, r.Admins...)
+	}
+	return teams
+}
+
+// permission returns the role needed for the action, a comment command
+// or "approve-fork"
+func (c Config) permission(action string) string {
+	if role, ok := c.Permissions[action]; ok {
+		return role
+	}
+	if role, ok := defaultPermissions[action]; ok {
+		return role
+	}
+	return roleMaintainer
+}
+
+// allowed checks if the user may do the action on the repo. Without
+// roles, every user with write access to the repo may.
+func (c Config) allowed(repoName, user, action string) (bool, error) {
+	g := c.githubClient()
+	if c.Roles == nil {
+		r := strings.SplitN(repoName, "/", 2)
+		if len(r) < 2 {
+			return false, fmt.Errorf("repo name could not be parsed: %s", repoName)
+		}
+		return g.CanWrite(octokat.Repo{Name: r[1], UserName: r[0]}, user)
+	}
+
+	for _, team := range c.Roles.teams(c.permission(action)) {
+		t := strings.SplitN(team, "/", 2)
+		if len(t) < 2 {
+			return false, fmt.Errorf("team could not be parsed: %s", team)
+		}
+		member, err := g.IsTeamMember(t[0], t[1], user)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRolesTeams(t *testing.T) {
+	r := Roles{
+		Admins:      []string{"mantidproject/admins"},
+		Maintainers: []string{"mantidproject/maintainers"},
+		Triagers:    []string{"mantidproject/triagers"},
+	}
+	for role, want := range map[string][]string{
+		roleAdmin:      {"mantidproject/admins"},
+		roleMaintainer: {"mantidproject/maintainers", "mantidproject/admins"},
+		roleTriager:    {"mantidproject/triagers", "mantidproject/maintainers", "mantidproject/admins"},
+		"unknown":      nil,
+	} {
+		if got := r.teams(role); !reflect.DeepEqual(got, want) {
+			t.Errorf("teams(%q) = %v, want %v", role, got, want)
+		}
+	}
+}
+
+func TestPermission(t *testing.T) {
+	c := Config{Permissions: map[string]string{"retest": roleMaintainer}}
+	for action, want := range map[string]string{
+		"retest":        roleMaintainer,
+		"test":          roleTriager,
+		"update-branch": roleMaintainer,
+		permApproveFork: roleMaintainer,
+		"unknown":       roleMaintainer,
+	} {
+		if got := c.permission(action); got != want {
+			t.Errorf("permission(%q) = %q, want %q", action, got, want)
+		}
+	}
+}
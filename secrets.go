@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"leeroy/jenkins"
+	"leeroy/secrets"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how often the credentials are read again by default
+const defaultSecretsRefresh = 15 * time.Minute
+
+// secretsConfig selects the secret manager the credentials are read
+// from, they take precedence over the ones of the config file
+type secretsConfig struct {
+	Vault *secrets.Vault `json:"vault"`
+	AWS   *secrets.AWS   `json:"aws"`
+	GCP   *secrets.GCP   `json:"gcp"`
+	// how often the credentials are read again, to pick up rotations
+	Refresh duration `json:"refresh"`
+}
+
+// credentials holds the latest credentials read from the secret manager
+var credentials struct {
+	sync.RWMutex
+	values map[string]string
+}
+
+// secretSource returns the configured secret manager, if any
+func (c Config) secretSource() secrets.Source {
+	switch {
+	case c.Secrets.Vault != nil:
+		return *c.Secrets.Vault
+	case c.Secrets.AWS != nil:
+		return *c.Secrets.AWS
+	case c.Secrets.GCP != nil:
+		return *c.Secrets.GCP
+	}
+	return nil
+}
+
+// loadSecrets reads the credentials from the secret manager and keeps
+// reading them on every instance, so rotated credentials are used without
+// a restart
+func loadSecrets(c Config) error {
+	source := c.secretSource()
+	if source == nil {
+		return nil
+	}
+	if err := refreshSecrets(source); err != nil {
+		return err
+	}
+
+	refresh := c.Secrets.Refresh.Duration
+	if refresh <= 0 {
+		refresh = defaultSecretsRefresh
+	}
+	go func() {
+		for range time.Tick(refresh) {
+			if err := refreshSecrets(source); err != nil {
+				log.Error(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// refreshSecrets replaces the credentials with the ones of the source
+func refreshSecrets(source secrets.Source) error {
+	values, err := source.Fetch()
+	if err != nil {
+		return err
+	}
+
+	credentials.Lock()
+	previous := credentials.values
+	credentials.values = values
+	credentials.Unlock()
+
+	if previous == nil {
+		return nil
+	}
+	for name, value := range values {
+		if previous[name] != value {
+			log.Infof("The %s secret was rotated", name)
+		}
+	}
+	// the previous token is retired once GitHub revokes it
+	if token := values["github_token"]; token != previous["github_token"] && token != "" && tokenPool != nil {
+		tokenPool.Add(token)
+	}
+	return nil
+}
+
+// secret returns the credential from the secret manager, or def when it
+// has none
+func secret(name, def string) string {
+	credentials.RLock()
+	defer credentials.RUnlock()
+	if v, ok := credentials.values[name]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// githubToken returns the current GitHub token
+func (c Config) githubToken() string {
+	return secret("github_token", c.GHToken)
+}
+
+// jenkins returns the jenkins client with the current credentials
+func (c Config) jenkins() *jenkins.Client {
+	j := c.Jenkins
+	j.Username = secret("jenkins_username", j.Username)
+	j.Token = secret("jenkins_token", j.Token)
+	return &j
+}
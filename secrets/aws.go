@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"leeroy/sigv4"
+)
+
+// AWS reads the credentials from a secret of AWS Secrets Manager, whose
+// string is a JSON object of the credentials
+type AWS struct {
+	Region string `json:"region"`
+	// name or ARN of the secret
+	SecretID string `json:"secret_id"`
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN are
+	// used if they are empty
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+	// https://secretsmanager.<region>.amazonaws.com by default
+	Endpoint string `json:"endpoint"`
+}
+
+func (a AWS) credentials() (string, string, string) {
+	id, secret, token := a.AccessKeyID, a.SecretAccessKey, a.SessionToken
+	if id == "" {
+		id = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secret == "" {
+		secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if token == "" && a.AccessKeyID == "" {
+		token = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	return id, secret, token
+}
+
+// Fetch reads the current version of the secret
+func (a AWS) Fetch() (map[string]string, error) {
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", a.Region)
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": a.SecretID})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	id, secret, token := a.credentials()
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	sigv4.Sign(req, body, "secretsmanager", a.Region, id, secret, time.Now().UTC())
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading the secret %s from aws failed: %v", a.SecretID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("reading the secret %s from aws failed: %s %s", a.SecretID, resp.Status, b)
+	}
+
+	var value struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&value); err != nil {
+		return nil, fmt.Errorf("parsing the secret %s from aws failed: %v", a.SecretID, err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal([]byte(value.SecretString), &values); err != nil {
+		return nil, fmt.Errorf("parsing the secret %s from aws failed, it is not a JSON object of strings: %v", a.SecretID, err)
+	}
+	return values, nil
+}
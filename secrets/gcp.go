@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	gcpAPIURL = "https://secretmanager.googleapis.com/v1"
+	// the token of the service account of the instance, on GCP
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCP reads the credentials from a secret of Google Cloud Secret
+// Manager, whose payload is a JSON object of the credentials
+type GCP struct {
+	Project string `json:"project"`
+	Secret  string `json:"secret"`
+	// "latest" by default
+	Version string `json:"version"`
+	// GOOGLE_OAUTH_ACCESS_TOKEN is used if it is empty, and the token of
+	// the service account of the instance if both are
+	AccessToken string `json:"access_token"`
+}
+
+// Fetch reads the version of the secret
+func (g GCP) Fetch() (map[string]string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	token, err := g.token(client)
+	if err != nil {
+		return nil, fmt.Errorf("getting a token for the secret %s from gcp failed: %v", g.Secret, err)
+	}
+
+	version := g.Version
+	if version == "" {
+		version = "latest"
+	}
+	url := fmt.Sprintf("%s/projects/%s/secrets/%s/versions/%s:access", gcpAPIURL, g.Project, g.Secret, version)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading the secret %s from gcp failed: %v", g.Secret, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("reading the secret %s from gcp failed: %s %s", g.Secret, resp.Status, b)
+	}
+
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("parsing the secret %s from gcp failed: %v", g.Secret, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the secret %s from gcp failed: %v", g.Secret, err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parsing the secret %s from gcp failed, it is not a JSON object of strings: %v", g.Secret, err)
+	}
+	return values, nil
+}
+
+// token returns the access token to read the secret with
+func (g GCP) token(client *http.Client) (string, error) {
+	if g.AccessToken != "" {
+		return g.AccessToken, nil
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	req, err := http.NewRequest("GET", gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the metadata server answered %s", resp.Status)
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+	return t.AccessToken, nil
+}
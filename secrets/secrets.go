@@ -0,0 +1,7 @@
+package secrets
+
+// Source fetches the credentials of leeroy from a secret manager, by the
+// names they are stored under, eg. "github_token"
+type Source interface {
+	Fetch() (map[string]string, error)
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultVaultMount = "secret"
+
+// Vault reads the credentials from a secret of the KV version 2 secrets
+// engine of HashiCorp Vault
+type Vault struct {
+	Address string `json:"address"`
+	// VAULT_TOKEN is used if it is empty
+	Token string `json:"token"`
+	// mount point of the secrets engine, "secret" by default
+	Mount string `json:"mount"`
+	Path  string `json:"path"`
+}
+
+// Fetch reads the latest version of the secret
+func (v Vault) Fetch() (map[string]string, error) {
+	token := v.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	mount := v.Mount
+	if mount == "" {
+		mount = defaultVaultMount
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(v.Address, "/"), mount, strings.TrimPrefix(v.Path, "/"))
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading the secret %s from vault failed: %v", v.Path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("reading the secret %s from vault failed: %s %s", v.Path, resp.Status, body)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("parsing the secret %s from vault failed: %v", v.Path, err)
+	}
+	return secret.Data.Data, nil
+}
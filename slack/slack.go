@@ -0,0 +1,83 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// TimestampHeader and SignatureHeader sign the requests from Slack
+	TimestampHeader = "X-Slack-Request-Timestamp"
+	SignatureHeader = "X-Slack-Signature"
+
+	// requests older than this are rejected to prevent replays
+	maxRequestAge = 5 * time.Minute
+
+	// how long posting a reply may take before it is given up
+	replyTimeout = 30 * time.Second
+)
+
+type Client struct {
+	SigningSecret string `json:"signing_secret"`
+	// Slack user ids mapped to GitHub logins, only mapped users can run
+	// commands
+	Users map[string]string `json:"users"`
+}
+
+// Response is the reply to a slash command
+type Response struct {
+	// "ephemeral" (only shown to the user) or "in_channel"
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// Verify checks the signature of a request from Slack with its body
+func (c *Client) Verify(header http.Header, body []byte) error {
+	if c.SigningSecret == "" {
+		return fmt.Errorf("no signing secret configured")
+	}
+
+	ts := header.Get(TimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", ts)
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return fmt.Errorf("request timestamp is %s off", age)
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.SigningSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get(SignatureHeader))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// Reply posts a delayed response to the response_url of a command
+func (c *Client) Reply(responseURL string, resp Response) error {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: replyTimeout}
+	r, err := client.Post(responseURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return fmt.Errorf("replying to slack responded with status %d", r.StatusCode)
+	}
+	return nil
+}
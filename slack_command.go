@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"leeroy/slack"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const slackUsage = "Usage: `/leeroy retest <repo> <pr> [context]`, eg. `/leeroy retest mantid 39123 system-tests`"
+
+// slackCommandHandler runs the slash commands sent by Slack. The Slack
+// user must be mapped to a GitHub login allowed to /retest the repo.
+func slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, 500, errInternal, fmt.Errorf("Error reading slack command body: %v", err))
+		return
+	}
+	if err := config.Slack.Verify(r.Header, body); err != nil {
+		writeError(w, 401, errUnauthorized, fmt.Errorf("Rejected slack command: %v", err))
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("Error parsing slack command: %v", err))
+		return
+	}
+
+	reply := func(text string) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(slack.Response{ResponseType: "ephemeral", Text: text})
+	}
+
+	login, ok := config.Slack.Users[form.Get("user_id")]
+	if !ok {
+		reply("Your Slack user is not mapped to a GitHub login, ask a leeroy admin to add it.")
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	if len(args) < 3 || args[0] != "retest" {
+		reply(slackUsage)
+		return
+	}
+
+	repo, err := config.findRepo(args[1])
+	if err != nil {
+		reply(err.Error())
+		return
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(args[2], "#"))
+	if err != nil {
+		reply(slackUsage)
+		return
+	}
+	context := ""
+	if len(args) > 3 {
+		context = args[3]
+	}
+
+	// slack only waits 3 seconds for the reply, the builds are
+	// scheduled in the background and reported to the response url
+	responseURL := form.Get("response_url")
+	go func() {
+		text := fmt.Sprintf("%s retested %s #%d", login, repo, number)
+		if err := slackRetest(login, repo, number, context); err != nil {
+			log.Errorf("Retest from slack of %s #%d failed: %v", repo, number, err)
+			text = fmt.Sprintf("Retesting %s #%d failed: %v", repo, number, err)
+		}
+		if err := config.Slack.Reply(responseURL, slack.Response{ResponseType: "in_channel", Text: text}); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	reply(fmt.Sprintf("Retesting %s #%d...", repo, number))
+}
+
+// findRepo returns the configured repo matching "owner/name" or just
+// "name" if it is not ambiguous
+func (c Config) findRepo(name string) (string, error) {
+	var found []string
+	for _, build := range c.Builds {
+		if containsString(found, build.Repo) {
+			continue
+		}
+		if build.Repo == name || strings.HasSuffix(build.Repo, "/"+name) {
+			found = append(found, build.Repo)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no repo %s is configured", name)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%s is ambiguous: %s", name, strings.Join(found, ", "))
+}
+
+// slackRetest schedules the build of context, or all the builds, of the
+// pull request for login, unless they are held like for /retest
+func slackRetest(login, repoName string, number int, context string) error {
+	allowed, err := config.allowed(repoName, login, "retest")
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%s is not allowed to retest %s", login, repoName)
+	}
+
+	var builds []Build
+	if context != "" {
+		build, err := config.getBuildByContextAndRepo(context, repoName)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, build)
+	} else if builds, err = config.getBuilds(repoName, false); err != nil {
+		return err
+	}
+
+	defer lockPR(repoName, number)()
+	pr, err := config.loadPullRequest(repoName, number)
+	if err != nil {
+		return err
+	}
+	extras, err := config.pullRequestExtras(pr)
+	if err != nil {
+		return err
+	}
+
+	var scheduled []Build
+	for _, build := range builds {
+		if build.Downstream && context == "" {
+			continue
+		}
+		scheduled = append(scheduled, config.manualRebuild(build))
+	}
+
+	h, err := config.scheduleUnlessHeld(repoName, pr, extras, scheduled, true)
+	if err != nil {
+		return err
+	}
+	if h.held() {
+		return fmt.Errorf("not building %s #%d: %s", repoName, number, h.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// stageStates maps the statuses of pipeline stages to GitHub states,
+// stages which did not run are not reported
+var stageStates = map[string]string{
+	"SUCCESS":              "success",
+	"FAILED":               "failure",
+	"UNSTABLE":             "failure",
+	"ABORTED":              "error",
+	"IN_PROGRESS":          "pending",
+	"PAUSED_PENDING_INPUT": "pending",
+}
+
+// stageContext returns the context of the status of a stage of a build
+func stageContext(build Build, stage string) string {
+	return build.Context + "/" + stage
+}
+
+// reportStages reports each stage of a jenkins pipeline build as its own
+// status, so the phase which failed shows on the pull request
+func (c Config) reportStages(build Build, job string, number int, repo, sha, url string) error {
+	stages, err := c.jenkins().GetStages(job, number)
+	if err != nil {
+		return backendError{fmt.Errorf("getting the stages of jenkins build %s %d failed: %v", job, number, err)}
+	}
+
+	for _, stage := range stages {
+		state, ok := stageStates[stage.Status]
+		if !ok {
+			continue
+		}
+
+		desc := msg(repo, "%s is running", stage.Name)
+		if state != "pending" {
+			took := time.Duration(stage.DurationMillis) * time.Millisecond
+			desc = msg(repo, "%s: %s after %s", stage.Name, stage.Status, took.Round(time.Second))
+		}
+		if err := c.updateGithubStatus(repo, stageContext(build, stage.Name), sha, state, desc, url); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
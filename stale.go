@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+
+	"leeroy/github"
+)
+
+// StalePolicy stops building pull requests automatically once nothing was
+// pushed to them for a while, eg. old pull requests woken up by
+// retargeting them to another base branch. Their builds are held until
+// someone comments /retest.
+type StalePolicy struct {
+	Repo string `json:"github_repo"`
+	// days since the last push or comment
+	Days int `json:"days"`
+}
+
+// stalePolicy returns the stale pull request policy of the repo, if any
+func (c Config) stalePolicy(repo string) *StalePolicy {
+	for i := range c.StalePRs {
+		if c.StalePRs[i].Repo == repo {
+			return &c.StalePRs[i]
+		}
+	}
+	return nil
+}
+
+// isStale reports whether the pull request was inactive for longer than
+// the stale policy of the repo allows, going by its comments and pushes.
+// Its updated_at is not used as the retargeting which woke it up bumps it.
+func (c Config) isStale(repo string, pr *github.PullRequest) bool {
+	p := c.stalePolicy(repo)
+	if p == nil || p.Days <= 0 || pr.Content == nil {
+		return false
+	}
+
+	// a push is activity even when its commits are old
+	if pr.Hook != nil && (pr.Hook.IsOpened() || pr.Hook.IsSynchronize()) {
+		return false
+	}
+
+	last := pr.Content.LastActivity(c.GHUser)
+	// or when the builds of the head were last scheduled, at the push
+	// the latest
+	if record, err := getHeadRecord(repo, pr.Number); err == nil && record.Sha == pr.Head.Sha && record.Updated.After(last) {
+		last = record.Updated
+	}
+	return !last.IsZero() && time.Since(last) > time.Duration(p.Days)*24*time.Hour
+}
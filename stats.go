@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"leeroy/metrics"
+)
+
+// the window of the stats unless the request gives one
+const defaultStatsWindow = 7 * 24 * time.Hour
+
+// buildStats sums up the builds of a job or context over the window
+type buildStats struct {
+	Name        string  `json:"name"`
+	Builds      int     `json:"builds"`
+	SuccessRate float64 `json:"success_rate"`
+	P50         float64 `json:"p50_seconds"`
+	P95         float64 `json:"p95_seconds"`
+}
+
+type statsResponse struct {
+	Window   string       `json:"window"`
+	Jobs     []buildStats `json:"jobs"`
+	Contexts []buildStats `json:"contexts"`
+}
+
+// recordDuration keeps how long a finished build ran for the stats, and
+// pushes it to the metrics
+func recordDuration(record buildRecord, d time.Duration) {
+	saveDuration(durationSample{
+		Repo:      record.Repo,
+		Job:       record.Job,
+		Context:   record.Context,
+		State:     record.State,
+		Completed: time.Now(),
+		Duration:  d,
+	})
+
+	emitter.Timing("builds.run_duration", d, metrics.Tags{
+		"repo":    record.Repo,
+		"job":     record.Job,
+		"context": record.Context,
+		"state":   record.State,
+	})
+}
+
+// summarize returns the stats of the samples grouped by key, sorted by
+// name
+func summarize(samples []durationSample, key func(durationSample) string) []buildStats {
+	groups := map[string][]durationSample{}
+	for _, s := range samples {
+		groups[key(s)] = append(groups[key(s)], s)
+	}
+
+	stats := []buildStats{}
+	for name, group := range groups {
+		var durations []time.Duration
+		succeeded := 0
+		for _, s := range group {
+			durations = append(durations, s.Duration)
+			if s.State == "success" {
+				succeeded++
+			}
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+		stats = append(stats, buildStats{
+			Name:        name,
+			Builds:      len(group),
+			SuccessRate: float64(succeeded) / float64(len(group)),
+			P50:         percentile(durations, 50).Seconds(),
+			P95:         percentile(durations, 95).Seconds(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// statsHandler serves the durations and success rates of the builds per
+// job and per context, eg. /api/stats?window=24h&repo=mantidproject/mantid
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	window := defaultStatsWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		var err error
+		if window, err = time.ParseDuration(v); err != nil || window <= 0 {
+			writeError(w, 400, errInvalidRequest, fmt.Errorf("invalid window %q", v))
+			return
+		}
+	}
+	if window > buildRecordTTL {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("the window can be %s at most, the durations are not kept longer", buildRecordTTL))
+		return
+	}
+
+	samples, err := getDurations("", time.Now().Add(-window))
+	if err != nil {
+		writeError(w, 500, errInternal, fmt.Errorf("reading the build durations failed: %v", err))
+		return
+	}
+	if repo := r.URL.Query().Get("repo"); repo != "" {
+		var filtered []durationSample
+		for _, s := range samples {
+			if s.Repo == repo {
+				filtered = append(filtered, s)
+			}
+		}
+		samples = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statsResponse{
+		Window:   window.String(),
+		Jobs:     summarize(samples, func(s durationSample) string { return s.Job }),
+		Contexts: summarize(samples, func(s durationSample) string { return s.Context }),
+	})
+}
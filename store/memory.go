@@ -0,0 +1,184 @@
+package store
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e entry) expired() bool {
+	return !e.expires.IsZero() && time.Now().After(e.expires)
+}
+
+// Memory is a Store local to the process, state is lost on restart
+type Memory struct {
+	mu     sync.Mutex
+	values map[string]entry
+	lists  map[string][][]byte
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		values: map[string]entry{},
+		lists:  map[string][][]byte{},
+	}
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.values[key]
+	if !ok || e.expired() {
+		return nil, ErrNotFound
+	}
+	return e.value, nil
+}
+
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(key, value, ttl)
+	return nil
+}
+
+func (m *Memory) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.values[key]; ok && !e.expired() {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+func (m *Memory) CompareAndSwap(key string, old, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.values[key]; !ok || e.expired() || !bytes.Equal(e.value, old) {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+func (m *Memory) CompareAndDelete(key string, old []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.values[key]; !ok || e.expired() || !bytes.Equal(e.value, old) {
+		return false, nil
+	}
+	delete(m.values, key)
+	return true, nil
+}
+
+func (m *Memory) set(key string, value []byte, ttl time.Duration) {
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	m.values[key] = e
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.values, key)
+	delete(m.lists, key)
+	return nil
+}
+
+func (m *Memory) Keys(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for k, e := range m.values {
+		if e.expired() {
+			delete(m.values, k)
+			continue
+		}
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range m.lists {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *Memory) Dump(prefix string) ([]Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []Item
+	for k, e := range m.values {
+		if e.expired() || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		items = append(items, Item{Key: k, Value: e.value, Expires: e.expires})
+	}
+	for k, l := range m.lists {
+		if strings.HasPrefix(k, prefix) {
+			items = append(items, Item{Key: k, List: l})
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) Restore(items []Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, item := range items {
+		ttl, ok := item.ttl()
+		if !ok {
+			continue
+		}
+		if item.List != nil {
+			m.lists[item.Key] = item.List
+			continue
+		}
+		m.set(item.Key, item.Value, ttl)
+	}
+	return nil
+}
+
+func (m *Memory) Push(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lists[key] = append(m.lists[key], value)
+	return nil
+}
+
+func (m *Memory) Pop(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := m.lists[key]
+	if len(l) == 0 {
+		return nil, ErrNotFound
+	}
+	if len(l) == 1 {
+		delete(m.lists, key)
+	} else {
+		m.lists[key] = l[1:]
+	}
+	return l[0], nil
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMemoryGetSet(t *testing.T) {
+	m := NewMemory()
+	if _, err := m.Get("a"); err != ErrNotFound {
+		t.Fatalf("got %v for a missing key, want ErrNotFound", err)
+	}
+
+	if err := m.Set("a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Get("a"); err != nil || string(v) != "1" {
+		t.Errorf("got %q, %v, want 1", v, err)
+	}
+
+	if err := m.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get("a"); err != ErrNotFound {
+		t.Errorf("got %v for a deleted key, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	m := NewMemory()
+	m.Set("a", []byte("1"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := m.Get("a"); err != ErrNotFound {
+		t.Errorf("got %v for an expired key, want ErrNotFound", err)
+	}
+	if keys, _ := m.Keys(""); len(keys) != 0 {
+		t.Errorf("got keys %v, want the expired key left out", keys)
+	}
+	if ok, _ := m.SetNX("a", []byte("2"), 0); !ok {
+		t.Error("SetNX did not set an expired key")
+	}
+}
+
+func TestMemorySetNX(t *testing.T) {
+	m := NewMemory()
+	if ok, err := m.SetNX("a", []byte("1"), 0); !ok || err != nil {
+		t.Fatalf("got %t, %v, want the key to be set", ok, err)
+	}
+	if ok, err := m.SetNX("a", []byte("2"), 0); ok || err != nil {
+		t.Fatalf("got %t, %v, want the existing key to be kept", ok, err)
+	}
+	if v, _ := m.Get("a"); string(v) != "1" {
+		t.Errorf("got %q, want 1", v)
+	}
+}
+
+func TestMemoryCompareAndSwap(t *testing.T) {
+	m := NewMemory()
+	if ok, _ := m.CompareAndSwap("a", []byte("1"), []byte("2"), 0); ok {
+		t.Error("swapped a missing key")
+	}
+
+	m.Set("a", []byte("1"), 0)
+	if ok, _ := m.CompareAndSwap("a", []byte("x"), []byte("2"), 0); ok {
+		t.Error("swapped a key holding another value")
+	}
+	if ok, _ := m.CompareAndSwap("a", []byte("1"), []byte("2"), 0); !ok {
+		t.Error("did not swap a key holding the old value")
+	}
+	if v, _ := m.Get("a"); string(v) != "2" {
+		t.Errorf("got %q, want 2", v)
+	}
+
+	m.Set("b", []byte("1"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if ok, _ := m.CompareAndSwap("b", []byte("1"), []byte("2"), 0); ok {
+		t.Error("swapped an expired key")
+	}
+}
+
+func TestMemoryCompareAndDelete(t *testing.T) {
+	m := NewMemory()
+	m.Set("a", []byte("1"), 0)
+
+	if ok, _ := m.CompareAndDelete("a", []byte("x")); ok {
+		t.Error("deleted a key holding another value")
+	}
+	if ok, _ := m.CompareAndDelete("a", []byte("1")); !ok {
+		t.Error("did not delete a key holding the old value")
+	}
+	if _, err := m.Get("a"); err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryPushPop(t *testing.T) {
+	m := NewMemory()
+	for _, v := range []string{"1", "2", "3"} {
+		if err := m.Push("q", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"1", "2", "3"} {
+		v, err := m.Pop("q")
+		if err != nil || string(v) != want {
+			t.Errorf("got %q, %v, want %s", v, err, want)
+		}
+	}
+	if _, err := m.Pop("q"); err != ErrNotFound {
+		t.Errorf("got %v for an empty list, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryKeys(t *testing.T) {
+	m := NewMemory()
+	m.Set("build/a", nil, 0)
+	m.Set("build/b", nil, 0)
+	m.Set("head/a", nil, 0)
+	m.Push("build/q", nil)
+
+	keys, err := m.Keys("build/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	want := []string{"build/a", "build/b", "build/q"}
+	if len(keys) != len(want) {
+		t.Fatalf("got %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("got %v, want %v", keys, want)
+		}
+	}
+}
+
+func TestMemoryDumpRestore(t *testing.T) {
+	m := NewMemory()
+	m.Set("a", []byte("1"), time.Hour)
+	m.Set("b", []byte("2"), 0)
+	m.Push("q", []byte("x"))
+
+	items, err := m.Dump("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items = append(items, Item{Key: "expired", Value: []byte("3"), Expires: time.Now().Add(-time.Minute)})
+
+	restored := NewMemory()
+	if err := restored.Restore(items); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"a": "1", "b": "2"} {
+		if v, err := restored.Get(key); err != nil || string(v) != want {
+			t.Errorf("got %q, %v for %s, want %s", v, err, key, want)
+		}
+	}
+	if v, err := restored.Pop("q"); err != nil || string(v) != "x" {
+		t.Errorf("got %q, %v for the list, want x", v, err)
+	}
+	if _, err := restored.Get("expired"); err != ErrNotFound {
+		t.Errorf("got %v for an expired item, want it skipped", err)
+	}
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// Redis is a Store shared by all the instances using the same server
+type Redis struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedis connects to the redis server at c.Address. All keys are
+// namespaced with c.Prefix.
+func NewRedis(c Config) (*Redis, error) {
+	r := &Redis{
+		prefix: c.Prefix,
+		pool: &redis.Pool{
+			MaxIdle:     10,
+			IdleTimeout: 4 * time.Minute,
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", c.Address,
+					redis.DialPassword(c.Password),
+					redis.DialDatabase(c.DB),
+				)
+			},
+		},
+	}
+
+	// check the connection
+	conn := r.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		return nil, fmt.Errorf("connecting to redis at %s failed: %v", c.Address, err)
+	}
+
+	return r, nil
+}
+
+func (r *Redis) do(cmd string, args ...interface{}) (interface{}, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	return conn.Do(cmd, args...)
+}
+
+func (r *Redis) Get(key string) ([]byte, error) {
+	v, err := redis.Bytes(r.do("GET", r.prefix+key))
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{r.prefix + key, value}
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	_, err := r.do("SET", args...)
+	return err
+}
+
+func (r *Redis) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []interface{}{r.prefix + key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	_, err := redis.String(r.do("SET", args...))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// the compare and set scripts, so no other instance writes in between
+const (
+	compareAndSwapScript = `if redis.call("GET", KEYS[1]) ~= ARGV[1] then return 0 end
+if tonumber(ARGV[3]) > 0 then redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3]) else redis.call("SET", KEYS[1], ARGV[2]) end
+return 1`
+	compareAndDeleteScript = `if redis.call("GET", KEYS[1]) ~= ARGV[1] then return 0 end
+return redis.call("DEL", KEYS[1])`
+)
+
+func (r *Redis) CompareAndSwap(key string, old, value []byte, ttl time.Duration) (bool, error) {
+	swapped, err := redis.Int(r.do("EVAL", compareAndSwapScript, 1, r.prefix+key, old, value, int64(ttl/time.Millisecond)))
+	return swapped == 1, err
+}
+
+func (r *Redis) CompareAndDelete(key string, old []byte) (bool, error) {
+	deleted, err := redis.Int(r.do("EVAL", compareAndDeleteScript, 1, r.prefix+key, old))
+	return deleted == 1, err
+}
+
+func (r *Redis) Delete(key string) error {
+	_, err := r.do("DEL", r.prefix+key)
+	return err
+}
+
+func (r *Redis) Keys(prefix string) ([]string, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	var (
+		keys   []string
+		cursor = 0
+		match  = globEscaper.Replace(r.prefix+prefix) + "*"
+	)
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", match, "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
+		if cursor, err = redis.Int(values[0], nil); err != nil {
+			return nil, err
+		}
+		page, err := redis.Strings(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range page {
+			keys = append(keys, strings.TrimPrefix(k, r.prefix))
+		}
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+func (r *Redis) Dump(prefix string) ([]Item, error) {
+	keys, err := r.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	var items []Item
+	for _, key := range keys {
+		item := Item{Key: key}
+		kind, err := redis.String(conn.Do("TYPE", r.prefix+key))
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "string":
+			item.Value, err = redis.Bytes(conn.Do("GET", r.prefix+key))
+		case "list":
+			item.List, err = redis.ByteSlices(conn.Do("LRANGE", r.prefix+key, 0, -1))
+		default:
+			// expired since listing, or not written by leeroy
+			continue
+		}
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// -1 without expiry, -2 once expired
+		ms, err := redis.Int64(conn.Do("PTTL", r.prefix+key))
+		if err != nil {
+			return nil, err
+		}
+		if ms == -2 {
+			continue
+		}
+		if ms >= 0 {
+			item.Expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (r *Redis) Restore(items []Item) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	for _, item := range items {
+		ttl, ok := item.ttl()
+		if !ok {
+			continue
+		}
+		key := r.prefix + item.Key
+		if item.List == nil {
+			args := []interface{}{key, item.Value}
+			if ttl > 0 {
+				args = append(args, "PX", int64(ttl/time.Millisecond))
+			}
+			if _, err := conn.Do("SET", args...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := conn.Do("DEL", key); err != nil {
+			return err
+		}
+		args := []interface{}{key}
+		for _, v := range item.List {
+			args = append(args, v)
+		}
+		if _, err := conn.Do("RPUSH", args...); err != nil {
+			return err
+		}
+		if ttl > 0 {
+			if _, err := conn.Do("PEXPIRE", key, int64(ttl/time.Millisecond)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Redis) Push(key string, value []byte) error {
+	_, err := r.do("RPUSH", r.prefix+key, value)
+	return err
+}
+
+func (r *Redis) Pop(key string) ([]byte, error) {
+	v, err := redis.Bytes(r.do("LPOP", r.prefix+key))
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
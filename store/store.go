@@ -0,0 +1,82 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist
+var ErrNotFound = errors.New("key not found")
+
+// Store holds the state shared between leeroy instances: build records,
+// the delivery dedupe cache and queues
+type Store interface {
+	// Get returns the value of key or ErrNotFound
+	Get(key string) ([]byte, error)
+	// Set sets key to value, a zero ttl never expires
+	Set(key string, value []byte, ttl time.Duration) error
+	// SetNX sets key to value only if it does not exist yet and
+	// reports whether it was set
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	// CompareAndSwap sets key to value only if it holds old and reports
+	// whether it was set
+	CompareAndSwap(key string, old, value []byte, ttl time.Duration) (bool, error)
+	// CompareAndDelete removes key only if it holds old and reports
+	// whether it was removed
+	CompareAndDelete(key string, old []byte) (bool, error)
+	// Delete removes key
+	Delete(key string) error
+	// Keys returns all the keys starting with prefix
+	Keys(prefix string) ([]string, error)
+	// Push appends value to the list at key
+	Push(key string, value []byte) error
+	// Pop removes and returns the first value of the list at key,
+	// or ErrNotFound if the list is empty
+	Pop(key string) ([]byte, error)
+	// Dump returns the values and lists whose key starts with prefix
+	Dump(prefix string) ([]Item, error)
+	// Restore sets the items, replacing the existing keys. The items
+	// which already expired are skipped.
+	Restore(items []Item) error
+}
+
+// Item is a value or list of a store along with when it expires, eg. to
+// move the state of leeroy to another store
+type Item struct {
+	Key   string   `json:"key"`
+	Value []byte   `json:"value,omitempty"`
+	List  [][]byte `json:"list,omitempty"`
+	// zero if the key never expires
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// ttl returns how long the item has left, or false if it already expired
+func (i Item) ttl() (time.Duration, bool) {
+	if i.Expires.IsZero() {
+		return 0, true
+	}
+	left := time.Until(i.Expires)
+	return left, left > 0
+}
+
+// Config selects and configures the store backend
+type Config struct {
+	Backend  string `json:"backend"`
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	Prefix   string `json:"prefix"`
+}
+
+// New returns the store configured by c, the in-memory store by default
+func New(c Config) (Store, error) {
+	switch c.Backend {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		return NewRedis(c)
+	}
+
+	return nil, fmt.Errorf("unknown state backend %q", c.Backend)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"leeroy/events"
+)
+
+const (
+	// events buffered for each client of the stream
+	streamBuffer = 100
+	// how often a comment is sent to keep idle streams open through proxies
+	streamKeepAlive = 30 * time.Second
+)
+
+// eventsHandler streams the events published by this instance as
+// server-sent events, optionally only those of a repo, pull request or
+// some types, eg. /events?repo=mantidproject/mantid&pr=39123
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	if r.Method != "GET" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+
+	q := r.URL.Query()
+	repo := q.Get("repo")
+	number := 0
+	if pr := q.Get("pr"); pr != "" {
+		var err error
+		if number, err = strconv.Atoi(pr); err != nil {
+			writeError(w, 400, errInvalidRequest, fmt.Errorf("invalid pr %q", pr))
+			return
+		}
+	}
+	var types []string
+	if t := q.Get("type"); t != "" {
+		types = strings.Split(t, ",")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, 500, errInternal, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	watched, stop := events.Watch(streamBuffer)
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-watched:
+			if (repo != "" && e.Repo != repo) || (number != 0 && e.PR != number) ||
+				(len(types) > 0 && !containsString(types, string(e.Type))) {
+				continue
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const defaultFullBuildLabel = "full-build"
+
+// Subproject is a named group of paths of a monorepo along with the
+// builds changes to them need, eg. "docs" with the "docs/" prefix and
+// the docs builds. Subprojects can be shared by several repos.
+type Subproject struct {
+	Name string `json:"name"`
+	// prefixes ending with a slash or path.Match patterns
+	Paths    []string `json:"paths"`
+	Contexts []string `json:"contexts"`
+}
+
+// SubprojectBuilds only runs the builds of the subprojects a pull
+// request of the repo changes
+type SubprojectBuilds struct {
+	Repo        string   `json:"github_repo"`
+	Subprojects []string `json:"subprojects"`
+	// pull requests with the label run all the builds
+	FullLabel string `json:"full_label"`
+}
+
+func (s SubprojectBuilds) fullLabel() string {
+	if s.FullLabel != "" {
+		return s.FullLabel
+	}
+	return defaultFullBuildLabel
+}
+
+// subprojectBuilds returns the subproject builds of the repo, if any
+func (c Config) subprojectBuilds(repo string) *SubprojectBuilds {
+	for i := range c.SubprojectBuilds {
+		if c.SubprojectBuilds[i].Repo == repo {
+			return &c.SubprojectBuilds[i]
+		}
+	}
+	return nil
+}
+
+// subproject returns the subproject called name, if any
+func (c Config) subproject(name string) *Subproject {
+	for i := range c.Subprojects {
+		if c.Subprojects[i].Name == name {
+			return &c.Subprojects[i]
+		}
+	}
+	return nil
+}
+
+// changedSubprojects returns the subprojects the pull request changes,
+// or nil if it changes files outside of all of them
+func (c Config) changedSubprojects(s SubprojectBuilds, pr *github.PullRequest) []Subproject {
+	files := pr.Content.Files()
+	if len(files) == 0 {
+		return nil
+	}
+
+	changed := map[string]bool{}
+	for _, f := range files {
+		found := false
+		for _, name := range s.Subprojects {
+			if p := c.subproject(name); p != nil && matchesAny(f.FileName, p.Paths) {
+				changed[name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	var subprojects []Subproject
+	for _, name := range s.Subprojects {
+		if changed[name] {
+			subprojects = append(subprojects, *c.subproject(name))
+		}
+	}
+	return subprojects
+}
+
+// selectSubprojectBuilds returns the builds of the subprojects changed by
+// the pull request, skipping the other builds as not needed. All the builds run when the pull request changes
+// files outside of the subprojects or has the full build label.
+func (c Config) selectSubprojectBuilds(repo string, pr *github.PullRequest, extras pullRequestHookExtras, builds []Build) []Build {
+	s := c.subprojectBuilds(repo)
+	if s == nil || extras.hasLabel(s.fullLabel()) {
+		return builds
+	}
+
+	subprojects := c.changedSubprojects(*s, pr)
+	if subprojects == nil {
+		return builds
+	}
+
+	var names, contexts []string
+	for _, p := range subprojects {
+		names = append(names, p.Name)
+		contexts = append(contexts, p.Contexts...)
+	}
+	log.Infof("%s #%d only changes the subprojects %s", repo, pr.Number, strings.Join(names, ", "))
+
+	var selected []Build
+	for _, build := range builds {
+		if containsString(contexts, build.Context) {
+			selected = append(selected, build)
+			continue
+		}
+		if build.Downstream {
+			continue
+		}
+		c.skipNotNeeded(repo, pr, build, msg(repo, "Not needed, only %s changed", strings.Join(names, ", ")))
+	}
+	return selected
+}
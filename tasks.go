@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	leaderKey = "leader"
+	// how long the leadership lasts without being renewed
+	leaderTTL = 30 * time.Second
+)
+
+// duration is a time.Duration read from a config string like "24h"
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// task is a periodic background job, it only runs on the instance
+// which is the current leader
+type task struct {
+	name     string
+	interval time.Duration
+	run      func(c Config)
+}
+
+var (
+	tasks []task
+
+	// instanceID identifies this instance in the leader election
+	instanceID = fmt.Sprintf("%s-%d-%d", hostname(), os.Getpid(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63())
+
+	leaderMu sync.RWMutex
+	leader   bool
+)
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "leeroy"
+	}
+	return h
+}
+
+// registerTask adds a task to run every interval once startTasks is called
+func registerTask(name string, interval time.Duration, run func(c Config)) {
+	tasks = append(tasks, task{
+		name:     name,
+		interval: interval,
+		run:      run,
+	})
+}
+
+// isLeader reports whether this instance currently runs the tasks
+func isLeader() bool {
+	leaderMu.RLock()
+	defer leaderMu.RUnlock()
+	return leader
+}
+
+// campaign tries to become or stay the leader through the state store
+func campaign() {
+	id := []byte(instanceID)
+
+	elected, err := state.SetNX(leaderKey, id, leaderTTL)
+	if err != nil {
+		log.Warnf("leader election failed: %v", err)
+	}
+	if !elected && err == nil {
+		// renew the lease only if we still hold it, it may have expired and
+		// been taken by another instance since it was last renewed
+		if elected, err = state.CompareAndSwap(leaderKey, id, id, leaderTTL); err != nil {
+			log.Warnf("renewing leadership failed: %v", err)
+		}
+	}
+
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	if elected != leader {
+		if elected {
+			log.Infof("Instance %s is now the leader", instanceID)
+		} else {
+			log.Infof("Instance %s is no longer the leader", instanceID)
+		}
+	}
+	leader = elected
+}
+
+// startTasks runs the leader election and the registered tasks in the
+// background
+func startTasks(c Config) {
+	if len(tasks) == 0 {
+		return
+	}
+
+	campaign()
+	go func() {
+		for range time.Tick(leaderTTL / 3) {
+			campaign()
+		}
+	}()
+
+	for _, t := range tasks {
+		go func(t task) {
+			for range time.Tick(t.interval) {
+				if !isLeader() {
+					continue
+				}
+
+				log.Debugf("Running task %s", t.name)
+				t.run(c)
+			}
+		}(t)
+	}
+}
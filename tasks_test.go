@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCampaign(t *testing.T) {
+	setup(t, Config{})
+	oldID := instanceID
+	instanceID = "a"
+	t.Cleanup(func() {
+		instanceID = oldID
+		leader = false
+	})
+
+	campaign()
+	if !isLeader() {
+		t.Fatal("not elected with no leader")
+	}
+
+	// renewing keeps the lease
+	campaign()
+	if !isLeader() {
+		t.Fatal("lost the leadership when renewing it")
+	}
+
+	// the lease expired and another instance took it over
+	state.Set(leaderKey, []byte("b"), leaderTTL)
+	campaign()
+	if isLeader() {
+		t.Fatal("still the leader after another instance took over")
+	}
+	if v, _ := state.Get(leaderKey); string(v) != "b" {
+		t.Errorf("the lease of the other instance was overwritten with %q", v)
+	}
+
+	state.Delete(leaderKey)
+	campaign()
+	if !isLeader() {
+		t.Error("not elected once the lease was released")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	var d duration
+	if err := d.UnmarshalJSON([]byte(`"90m"`)); err != nil {
+		t.Fatal(err)
+	}
+	if d.Duration != 90*time.Minute {
+		t.Errorf("got %v, want 1h30m", d.Duration)
+	}
+	if err := d.UnmarshalJSON([]byte(`"soon"`)); err == nil {
+		t.Error("got no error for an invalid duration")
+	}
+}
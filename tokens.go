@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"leeroy/events"
+	"leeroy/github"
+	"leeroy/metrics"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	tokenCheckInterval = time.Hour
+	// how long before their expiration the tokens are reported by default
+	defaultTokenWarning = 7 * 24 * time.Hour
+	// the warnings about a token are repeated daily
+	tokenWarningTTL = 24 * time.Hour
+)
+
+func init() {
+	registerPlugin("token-checks", func(c Config) bool {
+		return len(c.githubTokens()) > 0
+	}, func(c Config) error {
+		registerTask("token-checks", tokenCheckInterval, checkTokens)
+		return nil
+	})
+}
+
+// githubTokens returns github_token followed by the other github_tokens
+func (c Config) githubTokens() []string {
+	tokens := []string{}
+	if token := c.githubToken(); token != "" {
+		tokens = append(tokens, token)
+	}
+	for _, t := range c.GHTokens {
+		if !containsString(tokens, t) {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// checkedTokens returns the tokens to check: the configured ones, the
+// one of the secret manager and the ones it rotated into the pool
+func (c Config) checkedTokens() []string {
+	tokens := c.githubTokens()
+	if tokenPool == nil {
+		return tokens
+	}
+	for _, t := range tokenPool.Tokens() {
+		if !containsString(tokens, t) {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// tokenWarning returns how long before their expiration the tokens are
+// reported
+func (c Config) tokenWarning() time.Duration {
+	if c.GHTokenWarning.Duration > 0 {
+		return c.GHTokenWarning.Duration
+	}
+	return defaultTokenWarning
+}
+
+// checkTokens reports the GitHub tokens which expire soon or miss some
+// of the github_scopes, along with the days left before they expire
+func checkTokens(c Config) {
+	for _, token := range c.checkedTokens() {
+		g := c.githubClient()
+		g.AuthToken, g.Tokens = token, nil
+		masked := github.MaskToken(token)
+
+		info, err := g.TokenInfo()
+		if err != nil {
+			log.Errorf("Checking the GitHub token ending in %s failed: %v", masked, err)
+			continue
+		}
+
+		var warnings []string
+		if !info.Expires.IsZero() {
+			left := time.Until(info.Expires)
+			emitter.Gauge("github.token.expiry_days", left.Hours()/24, metrics.Tags{"token": masked})
+			if left < c.tokenWarning() {
+				warnings = append(warnings, fmt.Sprintf("expires on %s", info.Expires.Format(time.RFC1123)))
+			}
+		}
+		// fine-grained tokens report no scopes to check
+		if len(info.Scopes) > 0 {
+			var missing []string
+			for _, scope := range c.GHScopes {
+				if !containsString(info.Scopes, scope) {
+					missing = append(missing, scope)
+				}
+			}
+			if len(missing) > 0 {
+				warnings = append(warnings, "misses the scopes "+strings.Join(missing, ", "))
+			}
+		}
+		if len(warnings) == 0 {
+			continue
+		}
+
+		desc := fmt.Sprintf("The GitHub token ending in %s %s", masked, strings.Join(warnings, " and "))
+		log.Warn(desc)
+
+		// only notify once a day
+		if ok, err := state.SetNX("token-warning/"+masked, []byte(desc), tokenWarningTTL); err != nil || !ok {
+			continue
+		}
+		events.Publish(events.Event{
+			Type:        events.TokenWarning,
+			Description: desc,
+		})
+	}
+}
+
+// tokenPool returns the pool of the GitHub tokens, nil when only
+// github_token is set
+func (c Config) tokenPool() *github.TokenPool {
+	if len(c.GHTokens) == 0 {
+		return nil
+	}
+	return github.NewTokenPool(c.githubTokens())
+}
+
+// tokensHandler returns the rate limits and health of the GitHub tokens
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	health := []github.TokenHealth{}
+	if tokenPool != nil {
+		health = tokenPool.Health()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
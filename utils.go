@@ -1,21 +1,128 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"leeroy/events"
+	"leeroy/github"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/crosbymichael/octokat"
+	"github.com/pkg/errors"
 )
 
-type Commit struct {
-	CommentsURL string `json:"comments_url,omitempty"`
-	HtmlURL     string `json:"html_url,omitempty"`
-	Sha         string `json:"sha,omitempty"`
-	URL         string `json:"url,omitempty"`
+// statusWriter records the status code written to a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.status = code
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// isAuthorized checks the request's basic auth against the configured
+// user and pass
+func isAuthorized(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	return ok && user == config.User && pass == config.Pass
+}
+
+// githubClient returns a client for the GitHub API authenticated
+// with the configured token
+func (c Config) githubClient() github.GitHub {
+	return github.GitHub{
+		AuthToken:       c.githubToken(),
+		Tokens:          tokenPool,
+		User:            c.GHUser,
+		ContextPrefix:   c.contextPrefix(),
+		Retry:           c.githubRetryPolicy(),
+		MergeableWindow: c.mergeableWindow(),
+		Templates:       github.Templates{Dir: c.CommentTemplates, Messages: catalog},
+		Messages:        catalog,
+		ReadOnly:        c.shadow,
+		StatusCache:     state,
+	}
+}
+
+// msg formats the translation of a message reported on the repo, like
+// fmt.Sprintf
+func msg(repo, format string, args ...interface{}) string {
+	return catalog.Sprintf(repo, format, args...)
+}
+
+// the longest wait for the mergeability, the hooks wait for it and GitHub
+// gives up on a delivery after 10 seconds
+const maxMergeableWindow = 5 * time.Second
+
+// mergeableWindow returns how long to wait for GitHub to compute if a
+// pull request is mergeable before building it anyway
+func (c Config) mergeableWindow() time.Duration {
+	if c.MergeableWindow.Duration > 0 && c.MergeableWindow.Duration < maxMergeableWindow {
+		return c.MergeableWindow.Duration
+	}
+	return maxMergeableWindow
+}
+
+// githubRetryPolicy returns the configured retry policy of the reads of
+// the GitHub API
+func (c Config) githubRetryPolicy() *github.RetryPolicy {
+	p := github.DefaultRetryPolicy
+	if r := c.GHRetry; r != nil {
+		if r.Attempts > 0 {
+			p.Attempts = r.Attempts
+		}
+		if r.BaseDelay.Duration > 0 {
+			p.BaseDelay = r.BaseDelay.Duration
+		}
+		if r.MaxDelay.Duration > 0 {
+			p.MaxDelay = r.MaxDelay.Duration
+		}
+		if r.Retryable != nil {
+			p.Retryable = r.Retryable
+		}
+	}
+	return &p
+}
+
+// contextPrefix returns the namespace of the status contexts leeroy
+// reports for its own checks
+func (c Config) contextPrefix() string {
+	if c.ContextPrefix != "" {
+		return c.ContextPrefix
+	}
+	return "mantid/"
+}
+
+// context returns the status context of one of leeroy's own checks
+func (c Config) context(name string) string {
+	return c.contextPrefix() + name
+}
+
+// repos returns the repos which have builds
+func (c Config) repos() (repos []string) {
+	for _, build := range c.Builds {
+		if !containsString(repos, build.Repo) {
+			repos = append(repos, build.Repo)
+		}
+	}
+	return repos
 }
 
 func (c Config) getBuilds(baseRepo string, isCustom bool) (builds []Build, err error) {
@@ -26,20 +133,48 @@ func (c Config) getBuilds(baseRepo string, isCustom bool) (builds []Build, err e
 	}
 
 	if len(builds) <= 0 {
-		return builds, fmt.Errorf("Could not find config for %s", baseRepo)
+		return builds, unknownBuildError(fmt.Sprintf("Could not find config for %s", baseRepo))
 	}
 
 	return builds, nil
 }
 
+// pullRequestBuilds returns the builds of the pull request before their
+// labels, triage and holds are checked
+func (c Config) pullRequestBuilds(repo string, pr *github.PullRequest, extras pullRequestHookExtras) ([]Build, error) {
+	builds, err := c.getBuilds(repo, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// members changing only trusted paths skip the heavy builds
+	if selected, ok := c.selectFastLaneBuilds(repo, pr, builds); ok {
+		return selected, nil
+	}
+	// pull requests owned by a single team may only need some builds
+	builds = c.selectOwnerBuilds(repo, pr, builds)
+	// and monorepo pull requests only the builds of their subprojects
+	return c.selectSubprojectBuilds(repo, pr, extras, builds), nil
+}
+
 func (c Config) getBuildByJob(job string) (build Build, err error) {
 	for _, build := range c.Builds {
-		if build.Job == job {
+		if build.Job == job || (build.ForkJob != "" && build.ForkJob == job) {
 			return build, nil
 		}
 	}
 
-	return build, fmt.Errorf("Could not find config for %s", job)
+	return build, unknownBuildError(fmt.Sprintf("Could not find config for %s", job))
+}
+
+func (c Config) getBuildByAzurePipeline(pipeline int) (build Build, err error) {
+	for _, build := range c.Builds {
+		if build.Backend == "azure" && build.AzurePipeline == pipeline {
+			return build, nil
+		}
+	}
+
+	return build, unknownBuildError(fmt.Sprintf("Could not find config for azure pipeline %d", pipeline))
 }
 
 func (c Config) getBuildByContextAndRepo(context, repo string) (build Build, err error) {
@@ -53,7 +188,7 @@ func (c Config) getBuildByContextAndRepo(context, repo string) (build Build, err
 		}
 	}
 
-	return build, fmt.Errorf("Could not find config for context: %s, repo: %s", context, repo)
+	return build, unknownBuildError(fmt.Sprintf("Could not find config for context: %s, repo: %s", context, repo))
 }
 
 func (c Config) updateGithubStatus(repoName, context, sha, state, desc, buildUrl string) error {
@@ -65,8 +200,7 @@ func (c Config) updateGithubStatus(repoName, context, sha, state, desc, buildUrl
 	}
 
 	// initialize github client
-	gh := octokat.NewClient()
-	gh = gh.WithToken(c.GHToken)
+	g := c.githubClient()
 	repo := octokat.Repo{
 		Name:     r[1],
 		UserName: r[0],
@@ -78,72 +212,169 @@ func (c Config) updateGithubStatus(repoName, context, sha, state, desc, buildUrl
 		URL:         buildUrl,
 		Context:     context,
 	}
-	if _, err := gh.SetStatus(repo, sha, status); err != nil {
-		return fmt.Errorf("setting status for repo: %s, sha: %s failed: %v", repoName, sha, err)
+
+	// the statuses are set once GitHub is back rather than lost
+	if _, down := github.Outage(); down && !c.shadow {
+		log.Debugf("Queueing status on %s %s for %s during the GitHub outage", repoName, sha, context)
+		return queueStatus(repoName, sha, status)
+	}
+
+	changed, err := g.SetStatus(repo, sha, status)
+	if err != nil && isOutageError(err) && !c.shadow {
+		log.Debugf("Queueing status on %s %s for %s: %v", repoName, sha, context, err)
+		return queueStatus(repoName, sha, status)
+	}
+	if err != nil {
+		return githubError{errors.Wrapf(err, "setting status for repo: %s, sha: %s failed", repoName, sha)}
+	}
+	if !changed {
+		log.Debugf("Status on %s %s for %s is already %s", repoName, sha, context, state)
+		return nil
 	}
 
 	log.Infof("Setting status on %s %s to %s for %s succeeded", repoName, sha, state, context)
 	return nil
 }
 
-func hasStatus(gh *octokat.Client, repo octokat.Repo, sha, context string) bool {
-	statuses, err := gh.Statuses(repo, sha, &octokat.Options{
-		QueryParams: map[string]string{"per_page": "100"},
-	})
+// buildCategory returns the category of the build of context on sha from
+// its latest status, counting builds scheduled by leeroy and pending for
+// longer than stuckAfter as stuck. The pending statuses of held builds
+// have no build record, they are never stuck.
+func buildCategory(g github.GitHub, repo octokat.Repo, sha, context string, stuckAfter time.Duration) (string, error) {
+	statuses, err := g.Statuses(repo, sha)
 	if err != nil {
-		log.Warnf("getting status for %s for %s/%s failed: %v", sha, repo.UserName, repo.Name, err)
-		return false
+		return "", githubError{errors.Wrapf(err, "getting the statuses of %s for %s/%s failed", sha, repo.UserName, repo.Name)}
 	}
 
+	// the latest statuses come first
 	for _, status := range statuses {
-		if status.Context == context {
-			return true
+		if status.Context != context {
+			continue
+		}
+		switch status.State {
+		case "success":
+			return buildSucceeded, nil
+		case "failure":
+			return buildFailed, nil
+		case "error":
+			return buildErrored, nil
+		}
+		if time.Since(status.UpdatedAt) <= stuckAfter {
+			return buildPending, nil
+		}
+		record, err := getBuildRecord(repo.UserName+"/"+repo.Name, sha, context)
+		if err != nil || record.Scheduled.IsZero() {
+			return buildPending, nil
 		}
+		return buildStuck, nil
 	}
 
-	return false
+	return neverBuilt, nil
 }
 
-func (c Config) getShas(owner, name, context string, number int) (shas []string, pr *octokat.PullRequest, err error) {
-	// initialize github client
-	gh := octokat.NewClient()
-	gh = gh.WithToken(c.GHToken)
+// buildCommits returns the commit build mode for a build, falling back
+// to the global build_commits setting
+func (c Config) buildCommits(build Build) string {
+	if build.BuildCommits != "" {
+		return build.BuildCommits
+	}
+	if c.BuildCommits != "" {
+		return c.BuildCommits
+	}
+	return "last"
+}
+
+// loadPullRequest fetches a pull request of repoName along with its content
+func (c Config) loadPullRequest(repoName string, number int) (*github.PullRequest, error) {
+	// parse git repo for username
+	// and repo name
+	r := strings.SplitN(repoName, "/", 2)
+	if len(r) < 2 {
+		return nil, fmt.Errorf("repo name could not be parsed: %s", repoName)
+	}
 	repo := octokat.Repo{
-		Name:     name,
-		UserName: owner,
+		Name:     r[1],
+		UserName: r[0],
 	}
 
-	// get the pull request so we can get the commits
-	pr, err = gh.PullRequest(repo, strconv.Itoa(number), &octokat.Options{})
+	pr, err := c.githubClient().GetPullRequest(repo, number)
 	if err != nil {
-		return shas, pr, fmt.Errorf("getting pull request %d for %s/%s failed: %v", number, owner, name, err)
+		return nil, githubError{errors.Wrapf(err, "getting pull request %d for %s failed", number, repoName)}
 	}
 
-	// check which commits we want to get
-	// from the original flag --build-commits
-	if c.BuildCommits == "all" || c.BuildCommits == "new" {
+	return pr, nil
+}
 
-		// get the commits url
-		req, err := http.Get(pr.CommitsURL)
-		if err != nil {
-			return shas, pr, err
-		}
-		defer req.Body.Close()
+// commitSha resolves a branch or (abbreviated) sha of repoName to the
+// full sha of the commit
+func (c Config) commitSha(repoName, ref string) (string, error) {
+	r := strings.SplitN(repoName, "/", 2)
+	if len(r) < 2 {
+		return "", fmt.Errorf("repo name could not be parsed: %s", repoName)
+	}
+	repo := octokat.Repo{
+		Name:     r[1],
+		UserName: r[0],
+	}
 
-		// parse the response
-		var commits []Commit
-		decoder := json.NewDecoder(req.Body)
-		if err := decoder.Decode(&commits); err != nil {
-			return shas, pr, fmt.Errorf("parsing the response from %s failed: %v", pr.CommitsURL, err)
-		}
+	sha, err := c.githubClient().CommitSha(repo, ref)
+	if err != nil {
+		return "", githubError{errors.Wrapf(err, "resolving %s of %s failed", ref, repoName)}
+	}
+
+	return sha, nil
+}
+
+// withDelivery adds the GitHub delivery which scheduled a build to the
+// target url of its statuses, so they can be traced back to the hook
+func withDelivery(target, delivery string) string {
+	if target == "" || delivery == "" {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	q := u.Query()
+	q.Set("github_delivery", delivery)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// forceRebuild makes a build in the "new" mode build the last commit
+// again even though it already has a status
+func (c Config) forceRebuild(build Build) Build {
+	if c.buildCommits(build) == "new" {
+		build.BuildCommits = "last"
+	}
+	return build
+}
+
+// manualRebuild is forceRebuild for the builds a user asked for, which
+// also bypass the cooldown of a build which just failed
+func (c Config) manualRebuild(build Build) Build {
+	build = c.forceRebuild(build)
+	build.Manual = true
+	return build
+}
+
+func (c Config) getShas(pr *github.PullRequest, context, mode string) (shas []string) {
+	// check which commits we want to get
+	// from the build_commits setting
+	if mode == "all" || mode == "new" {
+		g := c.githubClient()
 
 		// append the commit shas
-		for _, commit := range commits {
+		for _, commit := range pr.Content.Commits() {
 			// if we only want the new shas
 			// check to make sure the status
 			// has not been set before appending
-			if c.BuildCommits == "new" {
-				if hasStatus(gh, repo, commit.Sha, context) {
+			if mode == "new" {
+				found, err := g.HasStatus(pr, commit.Sha, context)
+				if err != nil {
+					log.Warnf("getting status for %s for %s/%s failed: %v", commit.Sha, pr.Repo.UserName, pr.Repo.Name, err)
+				}
+				if found {
 					continue
 				}
 			}
@@ -151,101 +382,516 @@ func (c Config) getShas(owner, name, context string, number int) (shas []string,
 			shas = append(shas, commit.Sha)
 		}
 	} else {
-		// this is the case where buildCommits == "last"
-		// just get the sha of the pr
+		// this is the case where buildCommits == "last" or "merge"
+		// just get the sha of the pr, for "merge" the merge ref
+		// is passed along to jenkins when scheduling
 		shas = append(shas, pr.Head.Sha)
 	}
 
-	return shas, pr, nil
+	return shas
 }
 
-func (c Config) scheduleJenkinsBuild(baseRepo string, number int, build Build) error {
-	// parse git repo for username
-	// and repo name
-	r := strings.SplitN(baseRepo, "/", 2)
-	if len(r) < 2 {
-		return fmt.Errorf("repo name could not be parsed: %s", baseRepo)
+func (c Config) scheduleBuild(baseRepo string, pr *github.PullRequest, build Build) error {
+	// pull requests from forks run the sandboxed job
+	if isFork(pr) {
+		build = build.sandboxed()
 	}
 
 	// get the shas to build
-	shas, pr, err := c.getShas(r[0], r[1], build.Context, number)
-	if err != nil {
-		return err
-	}
+	mode := c.buildCommits(build)
+	shas := c.getShas(pr, build.Context, mode)
 
 	for _, sha := range shas {
-
-		// update the github status
-		if err := c.updateGithubStatus(baseRepo, build.Context, sha, "pending", "Jenkins build is being scheduled", c.Jenkins.Baseurl+"/job/"+build.Job); err != nil {
+		if c.coolingDown(baseRepo, build, sha) {
+			continue
+		}
+		c.saveChangedFiles(baseRepo, pr, sha)
+		// for "merge" the merge ref is passed along to jenkins,
+		// statuses are still reported against the head sha
+		if err := c.scheduleCommit(baseRepo, pr, build, sha, mode == "merge"); err != nil {
 			return err
 		}
+	}
 
-		// setup the jenkins client
-		j := &c.Jenkins
-		// setup the parameters
-		htmlUrl := fmt.Sprintf("https://github.com/%s/pull/%d", baseRepo, pr.Number)
-		headRepo := fmt.Sprintf("%s/%s", pr.Head.Repo.Owner.Login, pr.Head.Repo.Name)
-		parameters := fmt.Sprintf("GIT_BASE_REPO=%s&GIT_HEAD_REPO=%s&GIT_SHA1=%s&GITHUB_URL=%s&PR=%d&BASE_BRANCH=%s", baseRepo, headRepo, sha, htmlUrl, pr.Number, pr.Base.Ref)
-		// schedule the build
-		if err := j.BuildWithParameters(build.Job, parameters); err != nil {
-			return fmt.Errorf("scheduling jenkins build failed: %v", err)
+	return nil
+}
+
+// rebuildUnlessHeld schedules the builds of a pull request again, eg.
+// once it was authorized, unless they have to wait for a maintainer. It
+// returns the hold for the callers to report.
+func (c Config) rebuildUnlessHeld(repo string, pr *github.PullRequest, extras pullRequestHookExtras) (hold, error) {
+	defer lockPR(repo, pr.Number)()
+
+	all, err := c.getBuilds(repo, false)
+	if err != nil {
+		return hold{}, err
+	}
+
+	var builds []Build
+	for _, build := range all {
+		if build.Downstream {
+			continue
 		}
+		build.Delivery = extras.Delivery
+		builds = append(builds, c.forceRebuild(build))
+	}
+	return c.scheduleUnlessHeld(repo, pr, extras, builds, false)
+}
+
+// scheduleUnlessHeld schedules the builds of a pull request unless they
+// have to wait for a maintainer, skipping the ones waiting for their
+// label or for triage. resume overrides the hold of a stale pull request,
+// eg. for a /retest, but no other hold. It returns the hold for the
+// callers to report, the pull request has to be locked.
+func (c Config) scheduleUnlessHeld(repo string, pr *github.PullRequest, extras pullRequestHookExtras, builds []Build, resume bool) (hold, error) {
+	h, err := c.holdReason(repo, pr, extras)
+	if err != nil {
+		return h, err
+	}
+	if h.Stale && resume {
+		h.Reason, h.Stale = "", false
+	}
+	if h.held() {
+		log.Infof("Not building %s #%d: %s", repo, pr.Number, h.Reason)
+		return h, nil
+	}
+
+	for _, build := range builds {
+		if !extras.labelled(build) || !extras.triaged(build) {
+			log.Debugf("Skipping %s for %s #%d waiting for its label or triage", build.Context, repo, pr.Number)
+			continue
+		}
+		if err := c.scheduleBuild(repo, pr, build); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// scheduleCommit schedules the build of one commit of the pr, or of the
+// result of merging the pr into its base if merge is set
+func (c Config) scheduleCommit(baseRepo string, pr *github.PullRequest, build Build, sha string, merge bool) error {
+	// update the github status
+	if err := c.updateGithubStatus(baseRepo, build.Context, sha, "pending", msg(baseRepo, "Build is being scheduled"), withDelivery(c.buildURL(build), build.Delivery)); err != nil {
+		return err
+	}
+
+	// setup the parameters
+	htmlUrl := fmt.Sprintf("https://github.com/%s/pull/%d", baseRepo, pr.Number)
+	headRepo := fmt.Sprintf("%s/%s", pr.Head.Repo.Owner.Login, pr.Head.Repo.Name)
+	parameters := map[string]string{
+		"GIT_BASE_REPO": baseRepo,
+		"GIT_HEAD_REPO": headRepo,
+		"GIT_SHA1":      sha,
+		"GITHUB_URL":    htmlUrl,
+		"PR":            strconv.Itoa(pr.Number),
+		"BASE_BRANCH":   pr.Base.Ref,
+	}
+	if merge {
+		parameters["GIT_MERGE_REF"] = fmt.Sprintf("refs/pull/%d/merge", pr.Number)
+	}
+	if build.ForwardDelivery && build.Delivery != "" {
+		parameters["GITHUB_DELIVERY"] = build.Delivery
+	}
+	// schedule the build
+	deferred, err := c.triggerBuild(build, parameters)
+	if err != nil {
+		return err
+	}
+
+	saveHead(baseRepo, pr.Number, pr.Head.Sha, pr.UpdatedAt)
+	saveBuildRecord(buildRecord{
+		Repo:      baseRepo,
+		PR:        pr.Number,
+		Sha:       sha,
+		Context:   build.Context,
+		Job:       build.Job,
+		State:     "pending",
+		URL:       c.buildURL(build),
+		Scheduled: time.Now(),
+		Delivery:  build.Delivery,
+		Deferred:  deferred,
+	})
+
+	events.Publish(events.Event{
+		Type:     events.BuildScheduled,
+		Repo:     baseRepo,
+		PR:       pr.Number,
+		Sha:      sha,
+		Context:  build.Context,
+		Job:      build.Job,
+		URL:      htmlUrl,
+		Delivery: build.Delivery,
+	})
+
+	return nil
+}
+
+// scheduleRefBuild schedules the build of a commit outside of any pull
+// request, eg. the head of a branch. The branch is passed along as
+// BASE_BRANCH when it is known.
+func (c Config) scheduleRefBuild(repo string, build Build, sha, branch string, extra map[string]string) error {
+	// update the github status
+	if err := c.updateGithubStatus(repo, build.Context, sha, "pending", msg(repo, "Build is being scheduled"), c.buildURL(build)); err != nil {
+		return err
 	}
 
+	// setup the parameters
+	htmlUrl := fmt.Sprintf("https://github.com/%s/commit/%s", repo, sha)
+	parameters := map[string]string{
+		"GIT_BASE_REPO": repo,
+		"GIT_HEAD_REPO": repo,
+		"GIT_SHA1":      sha,
+		"GITHUB_URL":    htmlUrl,
+	}
+	if branch != "" {
+		parameters["BASE_BRANCH"] = branch
+	}
+	for k, v := range extra {
+		parameters[k] = v
+	}
+	// schedule the build
+	deferred, err := c.triggerBuild(build, parameters)
+	if err != nil {
+		return err
+	}
+
+	saveBuildRecord(buildRecord{
+		Repo:      repo,
+		Sha:       sha,
+		Context:   build.Context,
+		Job:       build.Job,
+		State:     "pending",
+		URL:       c.buildURL(build),
+		Scheduled: time.Now(),
+		Deferred:  deferred,
+	})
+
+	events.Publish(events.Event{
+		Type:    events.BuildScheduled,
+		Repo:    repo,
+		Sha:     sha,
+		Context: build.Context,
+		Job:     build.Job,
+		URL:     htmlUrl,
+	})
+
 	return nil
 }
 
-func (c Config) scheduleJenkinsDownstreamBuild(baseRepo string, headRepo string, number int, build Build, sha string) error {
+func (c Config) scheduleDownstreamBuild(baseRepo string, headRepo string, number int, build Build, sha string) error {
+	if headRepo != baseRepo {
+		build = build.sandboxed()
+	}
+
 	// update the github status
-	if err := c.updateGithubStatus(baseRepo, build.Context, sha, "pending", "Jenkins build is being scheduled", c.Jenkins.Baseurl+"/job/"+build.Job); err != nil {
+	if err := c.updateGithubStatus(baseRepo, build.Context, sha, "pending", msg(baseRepo, "Build is being scheduled"), c.buildURL(build)); err != nil {
 		return err
 	}
 
-	// setup the jenkins client
-	j := &c.Jenkins
 	// setup the parameters
 	htmlUrl := fmt.Sprintf("https://github.com/%s/pull/%d", baseRepo, number)
-	parameters := fmt.Sprintf("GIT_BASE_REPO=%s&GIT_HEAD_REPO=%s&GIT_SHA1=%s&GITHUB_URL=%s&PR=%d", baseRepo, headRepo, sha, htmlUrl, number)
+	parameters := map[string]string{
+		"GIT_BASE_REPO": baseRepo,
+		"GIT_HEAD_REPO": headRepo,
+		"GIT_SHA1":      sha,
+		"GITHUB_URL":    htmlUrl,
+		"PR":            strconv.Itoa(number),
+	}
 	// schedule the build
-	if err := j.BuildWithParameters(build.Job, parameters); err != nil {
-		return fmt.Errorf("scheduling jenkins build failed: %v", err)
+	deferred, err := c.triggerBuild(build, parameters)
+	if err != nil {
+		return err
+	}
+
+	saveBuildRecord(buildRecord{
+		Repo:      baseRepo,
+		PR:        number,
+		Sha:       sha,
+		Context:   build.Context,
+		Job:       build.Job,
+		State:     "pending",
+		URL:       c.buildURL(build),
+		Scheduled: time.Now(),
+		Deferred:  deferred,
+	})
+
+	events.Publish(events.Event{
+		Type:    events.BuildScheduled,
+		Repo:    baseRepo,
+		PR:      number,
+		Sha:     sha,
+		Context: build.Context,
+		Job:     build.Job,
+		URL:     htmlUrl,
+	})
+
+	return nil
+}
+
+// prFilter restricts the open pull requests a retry sweep builds, so
+// abandoned pull requests are left alone
+type prFilter struct {
+	UpdatedWithin int      `json:"updated_within_days"`
+	BaseBranches  []string `json:"base_branches"`
+	SkipDrafts    bool     `json:"skip_drafts"`
+	// how many times the sweep retries the build of a sha, unlimited
+	// if zero
+	MaxRetries int `json:"max_retries"`
+	// the categories of builds retried, only the never built ones if empty
+	Categories []string `json:"categories"`
+	// how long a build stays pending before it counts as stuck
+	StuckAfter duration `json:"stuck_after"`
+}
+
+// the categories of the builds of the pull requests for the sweeps
+const (
+	neverBuilt   = "never_built"
+	buildFailed  = "failed"
+	buildErrored = "errored"
+	buildStuck   = "stuck"
+	// not retried
+	buildPending   = "pending"
+	buildSucceeded = "succeeded"
+)
+
+var sweepCategories = []string{neverBuilt, buildFailed, buildErrored, buildStuck}
+
+// how long a build stays pending before it counts as stuck by default
+const defaultStuckAfter = 6 * time.Hour
+
+// validate checks the categories of the filter
+func (f prFilter) validate() error {
+	for _, category := range f.Categories {
+		if !containsString(sweepCategories, category) {
+			return fmt.Errorf("unknown category %q, expected one of %s", category, strings.Join(sweepCategories, ", "))
+		}
+	}
+	return nil
+}
+
+// retries checks if the sweep retries the builds of the category
+func (f prFilter) retries(category string) bool {
+	if len(f.Categories) == 0 {
+		return category == neverBuilt
+	}
+	return containsString(f.Categories, category)
+}
+
+func (f prFilter) stuckAfter() time.Duration {
+	if f.StuckAfter.Duration > 0 {
+		return f.StuckAfter.Duration
+	}
+	return defaultStuckAfter
+}
+
+// matches checks if the pull request passes the filter
+func (f prFilter) matches(pr *github.ListedPullRequest) bool {
+	if f.UpdatedWithin > 0 && time.Since(pr.UpdatedAt) > time.Duration(f.UpdatedWithin)*24*time.Hour {
+		return false
+	}
+	if len(f.BaseBranches) > 0 && !containsString(f.BaseBranches, pr.Base.Ref) {
+		return false
+	}
+	return !f.SkipDrafts || !pr.Draft
+}
+
+// retryFailedPRs schedules the build for context on all the open pull
+// requests of repo matching the filter it has not succeeded for
+func (c Config) retryFailedPRs(repo, context string, filter prFilter) error {
+	// get the build
+	build, err := c.getBuildByContextAndRepo(context, repo)
+	if err != nil {
+		return err
+	}
+
+	// get PRs that have failed for the context
+	nums, err := c.getFailedPRs(context, repo, filter)
+	if err != nil {
+		return err
+	}
+
+	for _, prNum := range nums {
+		unlock := lockPR(repo, prNum)
+		// get the pull request
+		pr, err := c.loadPullRequest(repo, prNum)
+		if err != nil {
+			unlock()
+			log.Error(err)
+			continue
+		}
+
+		extras, err := c.pullRequestExtras(pr)
+		if err != nil {
+			unlock()
+			log.Error(err)
+			continue
+		}
+
+		// schedule the build, unless it waits for a maintainer
+		h, err := c.scheduleUnlessHeld(repo, pr, extras, []Build{build}, false)
+		unlock()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if h.held() {
+			continue
+		}
+		saveRetry(repo, pr.Head.Sha, context)
 	}
 
 	return nil
 }
 
-func (c Config) getFailedPRs(context, repoName string) (nums []int, err error) {
+func (c Config) getFailedPRs(context, repoName string, filter prFilter) (nums []int, err error) {
+	decisions, err := c.sweepDecisions(context, repoName, filter)
+	if err != nil {
+		return nums, err
+	}
+	for _, d := range decisions {
+		if d.Retry {
+			nums = append(nums, d.PR)
+		} else {
+			log.Debugf("Not retrying %s #%d (%s): %s", repoName, d.PR, context, d.Reason)
+		}
+	}
+	return nums, nil
+}
+
+// sweepDecision is whether a sweep of the failed builds retries the
+// build of a pull request, and why
+type sweepDecision struct {
+	PR       int    `json:"pr"`
+	Title    string `json:"title"`
+	Category string `json:"category,omitempty"`
+	Retry    bool   `json:"retry"`
+	Reason   string `json:"reason"`
+}
+
+// sweepDecisions decides for each open pull request of repoName whether
+// its build of context is retried
+func (c Config) sweepDecisions(context, repoName string, filter prFilter) (decisions []sweepDecision, err error) {
+	build, err := c.getBuildByContextAndRepo(context, repoName)
+	if err != nil {
+		return nil, err
+	}
+
 	// parse git repo for username
 	// and repo name
 	r := strings.SplitN(repoName, "/", 2)
 	if len(r) < 2 {
-		return nums, fmt.Errorf("repo name could not be parsed: %s", repoName)
+		return nil, fmt.Errorf("repo name could not be parsed: %s", repoName)
 	}
 
 	// initialize github client
-	gh := octokat.NewClient()
-	gh = gh.WithToken(c.GHToken)
+	g := c.githubClient()
 	repo := octokat.Repo{
 		Name:     r[1],
 		UserName: r[0],
 	}
 
 	// get pull requests
-	prs, err := gh.PullRequests(repo, &octokat.Options{
-		QueryParams: map[string]string{
-			"state":    "open",
-			"per_page": "100",
-		},
-	})
+	prs, err := g.PullRequests(repo, "open")
 	if err != nil {
-		return nums, fmt.Errorf("requesting open repos for %s failed: %v", repoName, err)
+		return nil, githubError{errors.Wrapf(err, "requesting open repos for %s failed", repoName)}
 	}
 
+	// only the pull requests whose combined status fails can have failed
+	// builds, which a search finds without reading the statuses of all
+	failing, searched := c.searchFailingPRs(g, repoName, filter)
+
+	decisions = []sweepDecision{}
 	for _, pr := range prs {
-		if !hasStatus(gh, repo, pr.Head.Sha, context) {
+		d := sweepDecision{PR: pr.Number, Title: pr.Title}
+		retry := getRetryRecord(repoName, pr.Head.Sha, context)
+		switch {
+		case !filter.matches(pr):
+			d.Reason = "filtered out of the sweep"
+		// back off from builds which keep failing
+		case filter.MaxRetries > 0 && retry.Retries >= filter.MaxRetries:
+			d.Reason = fmt.Sprintf("already retried %d times", retry.Retries)
+		case time.Now().Before(retry.Next):
+			d.Reason = fmt.Sprintf("backing off until %s", retry.Next.Format(time.RFC3339))
+		case searched && !containsInt(failing, pr.Number):
+			d.Reason = "the combined status is not failing"
+		case !listedExtras(pr).labelled(build) || !listedExtras(pr).triaged(build):
+			d.Reason = "waiting for its label or triage"
+		default:
+			category, err := buildCategory(g, repo, pr.Head.Sha, context, filter.stuckAfter())
+			if err != nil {
+				// skipped rather than retried, the build may be held
+				log.Warn(err)
+				d.Reason = "its statuses could not be read"
+				break
+			}
+			d.Category = category
+			d.Retry = filter.retries(d.Category)
+			if d.Retry {
+				d.Reason = "the build is " + strings.Replace(d.Category, "_", " ", -1)
+			} else {
+				d.Reason = "the sweep does not retry " + strings.Replace(d.Category, "_", " ", -1) + " builds"
+			}
+		}
+		decisions = append(decisions, d)
+	}
+
+	return decisions, nil
+}
+
+// searchFailingPRs returns the open pull requests of repoName whose
+// combined status fails when the filter only retries failed or errored
+// builds. It reports false when the search cannot be used and all the
+// pull requests need to be checked.
+func (c Config) searchFailingPRs(g github.GitHub, repoName string, filter prFilter) ([]int, bool) {
+	if len(filter.Categories) == 0 {
+		return nil, false
+	}
+	for _, category := range filter.Categories {
+		if category != buildFailed && category != buildErrored {
+			return nil, false
+		}
+	}
+
+	nums, err := g.SearchPullRequests("is:pr is:open status:failure repo:" + repoName)
+	if err != nil {
+		log.Warnf("Searching the failing pull requests of %s failed, checking all of them: %v", repoName, err)
+		return nil, false
+	}
+	return nums, true
+}
+
+// getOpenPRs returns the numbers of the open pull requests of repoName,
+// only the ones targeting base if it is set
+func (c Config) getOpenPRs(repoName, base string) (nums []int, err error) {
+	r := strings.SplitN(repoName, "/", 2)
+	if len(r) < 2 {
+		return nums, fmt.Errorf("repo name could not be parsed: %s", repoName)
+	}
+	repo := octokat.Repo{
+		Name:     r[1],
+		UserName: r[0],
+	}
+
+	prs, err := c.githubClient().PullRequests(repo, "open")
+	if err != nil {
+		return nums, githubError{errors.Wrapf(err, "requesting open pull requests for %s failed", repoName)}
+	}
+
+	for _, pr := range prs {
+		if base == "" || pr.Base.Ref == base {
 			nums = append(nums, pr.Number)
 		}
 	}
 
 	return nums, nil
 }
+
+func containsString(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SignatureHeader holds the hmac of the request body, both for the builds
+// sent and for the results received on the callback endpoint
+const SignatureHeader = "X-Leeroy-Signature"
+
+// EventHeader tells what was posted: "build" for the builds sent, or the
+// type of the events sent to the outbound webhooks
+const EventHeader = "X-Leeroy-Event"
+
+// how long a post may take before it is given up
+const requestTimeout = 30 * time.Second
+
+type Client struct {
+	Secret      string `json:"secret"`
+	CallbackURL string `json:"callback_url"`
+}
+
+// Payload is posted to the build's url to request a build
+type Payload struct {
+	Repo        string            `json:"repo"`
+	PR          int               `json:"pr"`
+	Sha         string            `json:"sha"`
+	Context     string            `json:"context"`
+	Parameters  map[string]string `json:"parameters"`
+	CallbackURL string            `json:"callback_url"`
+}
+
+// Result is posted back to the callback url to report the state of a build
+type Result struct {
+	Repo        string `json:"repo"`
+	HeadRepo    string `json:"head_repo"`
+	PR          int    `json:"pr"`
+	Sha         string `json:"sha"`
+	Context     string `json:"context"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	TargetURL   string `json:"target_url"`
+}
+
+// Send posts the signed payload to url
+func (c *Client) Send(url string, payload Payload) error {
+	payload.CallbackURL = c.CallbackURL
+	return c.Post(url, "build", payload)
+}
+
+// Post posts v as signed json to url, along with the kind of the post in
+// the event header
+func (c *Client) Post(url, event string, v interface{}) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// set up the request
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(d))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, c.Sign(d))
+	req.Header.Set(EventHeader, event)
+
+	// do the request, a hung receiver must not hold back the builds
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// check the status code
+	// anything 2xx means the post was accepted
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook post to %s responded with status %d", url, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the signature header value for body
+func (c *Client) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header value sent along with body
+func (c *Client) Verify(body []byte, signature string) bool {
+	if c.Secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(c.Sign(body)))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"leeroy/github"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/crosbymichael/octokat"
+)
+
+const (
+	webhookCheckInterval = 24 * time.Hour
+	// only one of the instances starting together checks the webhooks
+	webhookCheckKey = "webhook-check"
+	webhookCheckTTL = 10 * time.Minute
+)
+
+// States of the webhook of a repo
+const (
+	hookOK       = "ok"
+	hookMissing  = "missing"
+	hookDrifted  = "drifted"
+	hookCreated  = "created"
+	hookRepaired = "repaired"
+	hookError    = "error"
+)
+
+func init() {
+	registerPlugin("webhook-checks", func(c Config) bool {
+		return c.GHWebhook.URL != ""
+	}, func(c Config) error {
+		go func() {
+			if ok, err := state.SetNX(webhookCheckKey, []byte(instanceID), webhookCheckTTL); err != nil || !ok {
+				return
+			}
+			checkHooks(c)
+		}()
+		registerTask("webhook-checks", webhookCheckInterval, checkHooks)
+		return nil
+	})
+}
+
+// hookCheck is the state of the webhook of a repo
+type hookCheck struct {
+	Repo     string   `json:"repo"`
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// hookProblems returns how the webhook differs from the one leeroy needs.
+// GitHub does not return the secret, so only a missing one is found.
+func (c Config) hookProblems(hook github.Hook) (problems []string) {
+	if !hook.Active {
+		problems = append(problems, "inactive")
+	}
+	for _, event := range hookEvents {
+		if !containsString(hook.Events, event) && !containsString(hook.Events, "*") {
+			problems = append(problems, fmt.Sprintf("missing the %s event", event))
+		}
+	}
+	if hook.Config.ContentType != "json" {
+		problems = append(problems, fmt.Sprintf("content type %q instead of json", hook.Config.ContentType))
+	}
+	if c.GHWebhook.Secret != "" && hook.Config.Secret == "" {
+		problems = append(problems, "no secret")
+	}
+	return problems
+}
+
+// checkHook checks the webhook of the repo, and creates or repairs it
+// if repair is set
+func (c Config) checkHook(g github.GitHub, name string, repair bool) hookCheck {
+	check := hookCheck{Repo: name}
+	r := strings.SplitN(name, "/", 2)
+	if len(r) < 2 {
+		check.Status, check.Error = hookError, fmt.Sprintf("repo name could not be parsed: %s", name)
+		return check
+	}
+	repo := octokat.Repo{UserName: r[0], Name: r[1]}
+
+	hook, err := c.repoHook(g, repo)
+	if err != nil {
+		check.Status, check.Error = hookError, err.Error()
+		return check
+	}
+
+	if hook == nil {
+		check.Status = hookMissing
+		if repair {
+			if _, err := g.CreateHook(repo, c.leeroyHook()); err != nil {
+				check.Status, check.Error = hookError, err.Error()
+				return check
+			}
+			check.Status = hookCreated
+		}
+		return check
+	}
+
+	check.Problems = c.hookProblems(*hook)
+	if len(check.Problems) == 0 {
+		check.Status = hookOK
+		return check
+	}
+	check.Status = hookDrifted
+	if repair {
+		if err := g.EditHook(repo, hook.ID, c.leeroyHook()); err != nil {
+			check.Status, check.Error = hookError, err.Error()
+			return check
+		}
+		check.Status = hookRepaired
+	}
+	return check
+}
+
+// checkHooks checks the webhooks of all the repos with builds, repairing
+// them if github_webhook.repair is set
+func checkHooks(c Config) {
+	g := c.githubClient()
+	for _, repo := range c.repos() {
+		check := c.checkHook(g, repo, c.GHWebhook.Repair)
+		switch check.Status {
+		case hookOK:
+			log.Debugf("The webhook of %s is up to date", repo)
+		case hookCreated, hookRepaired:
+			log.Infof("The webhook of %s was %s: %s", repo, check.Status, strings.Join(check.Problems, ", "))
+		case hookError:
+			log.Errorf("Checking the webhook of %s failed: %s", repo, check.Error)
+		default:
+			log.Warnf("The webhook of %s is %s, no builds are triggered by the events it misses: %s", repo, check.Status, strings.Join(check.Problems, ", "))
+		}
+	}
+}
+
+// webhooksHandler reports the state of the webhooks of the repos, and
+// creates or repairs them on POST
+func webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	// setup auth
+	if !isAuthorized(r) {
+		writeError(w, 401, errUnauthorized, nil)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "POST" {
+		writeError(w, 405, errMethodNotAllowed, fmt.Errorf("%q is not a valid method", r.Method))
+		return
+	}
+	if config.GHWebhook.URL == "" {
+		writeError(w, 400, errInvalidRequest, fmt.Errorf("checking the webhooks needs github_webhook.url in the config"))
+		return
+	}
+
+	repos := config.repos()
+	if repo := r.URL.Query().Get("repo"); repo != "" {
+		repos = []string{repo}
+	}
+	g := config.githubClient()
+	checks := []hookCheck{}
+	for _, repo := range repos {
+		checks = append(checks, config.checkHook(g, repo, r.Method == "POST"))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checks)
+}